@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GetModCompatibility checks the dependencies, incompatibilities and
+// Minecraft/loader versions of a server's mods against each other and the
+// server's metadata, and returns the resulting report.
+func (h *ServerHandler) GetModCompatibility(w http.ResponseWriter, r *http.Request) {
+	serverName := mux.Vars(r)["serverName"]
+	if !isValidServerName(serverName) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return
+	}
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		log.Printf("Error getting server %s from database: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	// Hidden mods are still installed by the modpack exports.
+	tree, err := h.Index.FullTree(serverName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, fmt.Sprintf("Mod directory for server %s not found", serverName), http.StatusNotFound)
+		} else {
+			log.Printf("Error scanning mod directory for server %s: %v", serverName, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	report := modmanager.CheckCompatibility(tree, modmanager.EnvironmentFromMetadata(server.Metadata))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error encoding compatibility report for server %s: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// modSetSource is one side of a mod set comparison.
+type modSetSource struct {
+	Ref     string `json:"ref"`
+	Server  string `json:"server"`
+	Release string `json:"release,omitempty"`
+	Mods    int    `json:"mods"`
+}
+
+// modDiffResponse is the result of GetModDiff.
+type modDiffResponse struct {
+	A modSetSource `json:"a"`
+	B modSetSource `json:"b"`
+	*modmanager.ModDiff
+}
+
+// loadModSet resolves a comparison reference, either a server name for its
+// current mod directory or "server@version" for a release. On failure it
+// writes an error response and returns false.
+func (h *ServerHandler) loadModSet(w http.ResponseWriter, ref string) (modSetSource, []modmanager.ModSetEntry, bool) {
+	serverName, version, isRelease := strings.Cut(ref, "@")
+	src := modSetSource{Ref: ref, Server: serverName, Release: version}
+	if serverName == "" || !isValidServerName(serverName) || (isRelease && version == "") {
+		http.Error(w, fmt.Sprintf("Invalid reference %q, expected a server name or server@release", ref), http.StatusBadRequest)
+		return src, nil, false
+	}
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		log.Printf("Error getting server %s from database: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return src, nil, false
+	}
+	if server == nil {
+		http.Error(w, fmt.Sprintf("Server %s not found", serverName), http.StatusNotFound)
+		return src, nil, false
+	}
+
+	var mods []modmanager.ModSetEntry
+	if isRelease {
+		_, files, ok := h.loadRelease(w, server, version)
+		if !ok {
+			return src, nil, false
+		}
+		mods = modmanager.ModSetFromSnapshot(files)
+	} else {
+		tree, err := h.Index.Tree(serverName)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				http.Error(w, fmt.Sprintf("Mod directory for server %s not found", serverName), http.StatusNotFound)
+			} else {
+				log.Printf("Error scanning mod directory for server %s: %v", serverName, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return src, nil, false
+		}
+		mods = modmanager.ModSetFromTree(tree)
+	}
+	src.Mods = len(mods)
+	return src, mods, true
+}
+
+// GetModDiff compares the mods of two servers or releases, given as the
+// "a" and "b" query parameters, by mod ID.
+func (h *ServerHandler) GetModDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("a") == "" || q.Get("b") == "" {
+		http.Error(w, "Both \"a\" and \"b\" parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	srcA, modsA, ok := h.loadModSet(w, q.Get("a"))
+	if !ok {
+		return
+	}
+	srcB, modsB, ok := h.loadModSet(w, q.Get("b"))
+	if !ok {
+		return
+	}
+
+	resp := modDiffResponse{A: srcA, B: srcB, ModDiff: modmanager.DiffModSets(modsA, modsB)}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding mod diff of %s and %s: %v", srcA.Ref, srcB.Ref, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// botAgents are substrings of the lower-cased User-Agent of crawlers and
+// link previews, whose requests are not counted as downloads.
+var botAgents = []string{"bot", "crawl", "spider", "slurp", "facebookexternalhit", "embedly", "preview", "whatsapp"}
+
+// isBot reports whether the request comes from a crawler or link preview.
+func isBot(r *http.Request) bool {
+	agent := strings.ToLower(r.UserAgent())
+	for _, bot := range botAgents {
+		if strings.Contains(agent, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// countsAsDownload reports whether a request starts a new download. HEAD
+// requests, bots and range requests resuming a download are not counted.
+func countsAsDownload(r *http.Request) bool {
+	if r.Method != http.MethodGet || isBot(r) {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	return rangeHeader == "" || strings.HasPrefix(strings.ReplaceAll(rangeHeader, " ", ""), "bytes=0-")
+}
+
+// downloadRecorder remembers the status of a response, so only downloads
+// actually sent are counted and not e.g. 304 Not Modified.
+type downloadRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (d *downloadRecorder) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *downloadRecorder) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	return d.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps the sendfile optimisation of the wrapped writer for
+// http.ServeContent.
+func (d *downloadRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	if rf, ok := d.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(d.ResponseWriter, src)
+}
+
+func (d *downloadRecorder) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// serveCounted calls serve and counts a download of rel, a slash-separated
+// path in serverName's mod directory, if the request starts a new download
+// and the response succeeded.
+func (h *ServerHandler) serveCounted(w http.ResponseWriter, r *http.Request, serverName, rel string, serve func(w http.ResponseWriter)) {
+	if !countsAsDownload(r) {
+		serve(w)
+		return
+	}
+	rec := &downloadRecorder{ResponseWriter: w}
+	serve(rec)
+	if rec.status != http.StatusOK && rec.status != http.StatusPartialContent {
+		return
+	}
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err == nil && server != nil {
+		err = h.Store.RecordDownload(server.ID, rel, time.Now())
+	}
+	if err != nil {
+		log.Printf("Error counting download of %s on server %s: %v", rel, serverName, err)
+	}
+}
+
+// downloadCounts returns the number of downloads of each file of a server
+// over all time, keyed by path.
+func (h *ServerHandler) downloadCounts(serverName string) (map[string]int, error) {
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		return nil, err
+	}
+	return h.Store.GetDownloadCounts(server.ID, "")
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// publicBaseURL returns the externally visible base URL of the application
+// (without trailing slash), used for absolute download links.
+func (h *ServerHandler) publicBaseURL(r *http.Request) string {
+	if h.Config.PublicURL != "" {
+		return strings.TrimSuffix(h.Config.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// modFileURL returns the absolute download URL of a file in a server's mod directory.
+func modFileURL(baseURL, serverName, rel string) string {
+	segments := strings.Split(rel, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return fmt.Sprintf("%s/files/%s/mods/%s", baseURL, serverName, strings.Join(segments, "/"))
+}
+
+// mrpackDependencies collects the Modrinth dependency versions from the
+// server metadata, e.g. "minecraft" = "1.20.1" and "fabric-loader" = "0.15.11".
+func mrpackDependencies(server *database.Server) map[string]string {
+	deps := make(map[string]string)
+	for _, key := range modmanager.MrpackDependencyKeys {
+		for k, v := range server.Metadata {
+			if strings.EqualFold(k, key) && v != "" {
+				deps[key] = v
+			}
+		}
+	}
+	return deps
+}
+
+// loadPackServer looks up the server named in the request and its mod
+// directory. On failure it writes an error response and returns false.
+func (h *ServerHandler) loadPackServer(w http.ResponseWriter, r *http.Request) (*database.Server, string, bool) {
+	serverName := mux.Vars(r)["serverName"]
+	if !isValidServerName(serverName) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		log.Printf("Error getting server %s from database: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	if server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return nil, "", false
+	}
+
+	dir := filepath.Join(h.Config.ModDataPath, serverName)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		http.Error(w, fmt.Sprintf("Mod directory for server %s not found", serverName), http.StatusNotFound)
+		return nil, "", false
+	}
+	return server, dir, true
+}
+
+// ServeMrpack serves a Modrinth .mrpack generated from the server's mod directory.
+// Mods are referenced by their mcow download URLs so launchers fetch them directly.
+func (h *ServerHandler) ServeMrpack(w http.ResponseWriter, r *http.Request) {
+	server, dir, ok := h.loadPackServer(w, r)
+	if !ok {
+		return
+	}
+	serverName := server.Name
+
+	deps := mrpackDependencies(server)
+	if deps["minecraft"] == "" {
+		http.Error(w, "Modpack export requires a \"minecraft\" metadata entry (e.g. 1.20.1) on the server", http.StatusUnprocessableEntity)
+		return
+	}
+
+	side, ok := sideParam(w, r)
+	if !ok {
+		return
+	}
+	overrides, err := h.Store.GetSideOverrides(server.ID)
+	if err != nil {
+		log.Printf("Error loading side overrides for server %s: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sideOf, err := h.sideLookup(serverName, "/")
+	if err != nil {
+		log.Printf("Error classifying mod files for server %s: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := h.publicBaseURL(r)
+	opts := modmanager.MrpackOptions{
+		Name:         server.Name,
+		Summary:      strings.SplitN(server.Description, "\n", 2)[0],
+		Dependencies: deps,
+		DownloadURL: func(rel string) string {
+			return modFileURL(baseURL, serverName, rel)
+		},
+		SideOf: sideOf,
+		Side:   side,
+	}
+
+	dirFingerprint, err := modmanager.DirFingerprint(dir, modmanager.ZipOptions{})
+	if err != nil {
+		log.Printf("Error fingerprinting mod directory for server %s: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	opts.VersionID = server.Metadata["version"]
+	if opts.VersionID == "" {
+		opts.VersionID = dirFingerprint[:8]
+	}
+
+	// The pack also depends on server settings and the URL it was requested under.
+	settings, _ := json.Marshal([]interface{}{opts.Name, opts.Summary, opts.VersionID, deps, baseURL, side, overrides})
+	sum := sha256.Sum256(append([]byte(dirFingerprint), settings...))
+	fingerprint := hex.EncodeToString(sum[:8])
+
+	name := serverName + ".mrpack"
+	if side != "" {
+		name = serverName + "-" + side + ".mrpack"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("ETag", `"`+fingerprint+`"`)
+
+	key := "mrpack:" + serverName + ":" + side
+	if cached, ok := h.Archives.Lookup(key, fingerprint); ok {
+		if f, err := os.Open(cached); err == nil {
+			defer f.Close()
+			if info, err := f.Stat(); err == nil {
+				w.Header().Set("Content-Type", "application/x-modrinth-modpack+zip")
+				http.ServeContent(w, r, name, info.ModTime(), f)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-modrinth-modpack+zip")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var out io.Writer = w
+	pending, err := h.Archives.Create(key, fingerprint)
+	if err != nil && h.Archives.Enabled() {
+		log.Printf("Error creating cached modpack for %s: %v", serverName, err)
+	}
+	if pending != nil {
+		out = io.MultiWriter(w, pending)
+	}
+
+	if err := modmanager.WriteMrpack(out, dir, h.Hashes, opts); err != nil {
+		log.Printf("Error writing modpack for server %s: %v", serverName, err)
+		if pending != nil {
+			pending.Abort()
+		}
+		return
+	}
+
+	if pending != nil {
+		if err := pending.Commit(); err != nil {
+			log.Printf("Error caching modpack for %s: %v", serverName, err)
+		}
+	}
+}
+
+// packwizComponents maps Modrinth dependency keys to packwiz version keys.
+var packwizComponents = map[string]string{
+	"minecraft":     "minecraft",
+	"fabric-loader": "fabric",
+	"quilt-loader":  "quilt",
+	"forge":         "forge",
+	"neoforge":      "neoforge",
+}
+
+// ServePackwiz serves a packwiz pack generated from the server's mod
+// directory below /packwiz/{serverName}/, for use with packwiz-installer:
+// pack.toml, index.toml, the generated .pw.toml metafiles and all other
+// files of the pack. The pack is regenerated whenever the directory
+// changes, so clients pick up uploaded files on their next launch.
+func (h *ServerHandler) ServePackwiz(w http.ResponseWriter, r *http.Request) {
+	server, dir, ok := h.loadPackServer(w, r)
+	if !ok {
+		return
+	}
+	serverName := server.Name
+
+	versions := make(map[string]string)
+	for key, v := range mrpackDependencies(server) {
+		versions[packwizComponents[key]] = v
+	}
+	if versions["minecraft"] == "" {
+		http.Error(w, "Packwiz export requires a \"minecraft\" metadata entry (e.g. 1.20.1) on the server", http.StatusUnprocessableEntity)
+		return
+	}
+
+	baseURL := h.publicBaseURL(r)
+	pack, err := h.packwizPack(server, dir, baseURL, versions)
+	if err != nil {
+		log.Printf("Error generating packwiz pack for server %s: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	rel := strings.TrimPrefix(r.URL.Path, "/packwiz/"+serverName+"/")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	switch {
+	case rel == "pack.toml":
+		writeToml(w, pack.PackToml)
+	case rel == "index.toml":
+		writeToml(w, pack.IndexToml)
+	case pack.MetaFiles[rel] != nil:
+		writeToml(w, pack.MetaFiles[rel])
+	case pack.Files[rel]:
+		http.ServeFile(w, r, filepath.Join(dir, filepath.FromSlash(rel)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// packwizCache keeps the last generated packwiz pack of each server, since
+// packwiz-installer requests every metafile separately. Packs are keyed by
+// server name only; a pack requested under another base URL replaces the
+// cached one, so clients varying the Host header cannot grow the cache.
+type packwizCache struct {
+	mu    sync.Mutex
+	packs map[string]cachedPackwiz
+}
+
+// drop removes the cached pack of a server.
+func (c *packwizCache) drop(serverName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.packs, serverName)
+}
+
+type cachedPackwiz struct {
+	fingerprint string
+	pack        *modmanager.PackwizPack
+}
+
+// packwizPack returns the packwiz pack of a server, generating it only if
+// the mod directory or the server settings changed since the last request.
+func (h *ServerHandler) packwizPack(server *database.Server, dir, baseURL string, versions map[string]string) (*modmanager.PackwizPack, error) {
+	overrides, err := h.Store.GetSideOverrides(server.ID)
+	if err != nil {
+		return nil, err
+	}
+	dirFingerprint, err := modmanager.DirFingerprint(dir, modmanager.ZipOptions{})
+	if err != nil {
+		return nil, err
+	}
+	settings, _ := json.Marshal([]interface{}{server.Name, server.Metadata["version"], versions, baseURL, overrides})
+	sum := sha256.Sum256(append([]byte(dirFingerprint), settings...))
+	fingerprint := hex.EncodeToString(sum[:8])
+
+	// The base URL is part of the fingerprint, not the key.
+	key := server.Name
+	h.packwiz.mu.Lock()
+	cached, ok := h.packwiz.packs[key]
+	h.packwiz.mu.Unlock()
+	if ok && cached.fingerprint == fingerprint {
+		return cached.pack, nil
+	}
+
+	tree, err := h.classifiedTree(server.Name)
+	if err != nil {
+		return nil, err
+	}
+	sides := modmanager.SideMap(tree)
+	pack, err := modmanager.BuildPackwiz(dir, h.Hashes, modmanager.PackwizOptions{
+		Name:     server.Name,
+		Version:  server.Metadata["version"],
+		Versions: versions,
+		DownloadURL: func(rel string) string {
+			return modFileURL(baseURL, server.Name, rel)
+		},
+		SideOf: func(rel string) string { return sides[rel] },
+		Files:  modmanager.FileMap(tree),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.packwiz.mu.Lock()
+	if h.packwiz.packs == nil {
+		h.packwiz.packs = make(map[string]cachedPackwiz)
+	}
+	h.packwiz.packs[key] = cachedPackwiz{fingerprint: fingerprint, pack: pack}
+	h.packwiz.mu.Unlock()
+	return pack, nil
+}
+
+func writeToml(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/toml")
+	w.Write(data)
+}
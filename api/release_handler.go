@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// releaseInfo is a release as returned by the API, with download links.
+type releaseInfo struct {
+	database.Release
+	ZipURL string            `json:"zipUrl"`
+	Files  []releaseFileInfo `json:"files,omitempty"`
+}
+
+// releaseFileInfo is a file of a release with its download link.
+type releaseFileInfo struct {
+	modmanager.SnapshotFile
+	URL string `json:"url"`
+}
+
+// releaseZipURL returns the absolute download URL of a release archive.
+func releaseZipURL(baseURL, serverName, version string) string {
+	return fmt.Sprintf("%s/files/%s/releases/%s.zip", baseURL, serverName, url.PathEscape(version))
+}
+
+// releaseFileURL returns the absolute download URL of a file in a release.
+func releaseFileURL(baseURL, serverName, version, rel string) string {
+	segments := strings.Split(rel, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return fmt.Sprintf("%s/files/%s/releases/%s/%s", baseURL, serverName, url.PathEscape(version), strings.Join(segments, "/"))
+}
+
+// loadReleaseServer looks up the server named in the request. On failure it
+// writes an error response and returns nil.
+func (h *ServerHandler) loadReleaseServer(w http.ResponseWriter, r *http.Request) *database.Server {
+	serverName := mux.Vars(r)["serverName"]
+	if !isValidServerName(serverName) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return nil
+	}
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		log.Printf("Error getting server %s from database: %v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil
+	}
+	if server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return nil
+	}
+	return server
+}
+
+// GetReleases returns the releases of a server, newest first, with their
+// changelogs and archive download links.
+func (h *ServerHandler) GetReleases(w http.ResponseWriter, r *http.Request) {
+	server := h.loadReleaseServer(w, r)
+	if server == nil {
+		return
+	}
+
+	releases, err := h.Store.ListReleases(server.ID)
+	if err != nil {
+		log.Printf("Error listing releases for server %s: %v", server.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := h.publicBaseURL(r)
+	infos := make([]releaseInfo, 0, len(releases))
+	for _, rel := range releases {
+		infos = append(infos, releaseInfo{Release: rel, ZipURL: releaseZipURL(baseURL, server.Name, rel.Version)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		log.Printf("Error encoding releases for server %s: %v", server.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// GetRelease returns a single release including its files and their download links.
+func (h *ServerHandler) GetRelease(w http.ResponseWriter, r *http.Request) {
+	server := h.loadReleaseServer(w, r)
+	if server == nil {
+		return
+	}
+	rel, files, ok := h.loadRelease(w, server, mux.Vars(r)["version"])
+	if !ok {
+		return
+	}
+
+	baseURL := h.publicBaseURL(r)
+	info := releaseInfo{Release: *rel, ZipURL: releaseZipURL(baseURL, server.Name, rel.Version)}
+	for _, f := range files {
+		info.Files = append(info.Files, releaseFileInfo{SnapshotFile: f, URL: releaseFileURL(baseURL, server.Name, rel.Version, f.Path)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("Error encoding release %s for server %s: %v", rel.Version, server.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// loadRelease fetches a release and its files. On failure it writes an
+// error response and returns false.
+func (h *ServerHandler) loadRelease(w http.ResponseWriter, server *database.Server, version string) (*database.Release, []modmanager.SnapshotFile, bool) {
+	rel, err := h.Store.GetRelease(server.ID, version)
+	if err != nil {
+		log.Printf("Error getting release %s for server %s: %v", version, server.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if rel == nil {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	files, err := h.Store.ListReleaseFiles(rel.ID)
+	if err != nil {
+		log.Printf("Error listing files of release %s for server %s: %v", version, server.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return rel, files, true
+}
+
+// ServeReleaseFiles serves release downloads below /files/{serverName}/releases/:
+// "{version}.zip" for the whole release and "{version}/{path}" for single
+// files. Release contents never change, so responses may be cached forever.
+func (h *ServerHandler) ServeReleaseFiles(w http.ResponseWriter, r *http.Request) {
+	server := h.loadReleaseServer(w, r)
+	if server == nil {
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/files/"+server.Name+"/releases/")
+	version, rel, isFile := strings.Cut(rest, "/")
+	if !isFile {
+		if !strings.HasSuffix(version, ".zip") {
+			http.NotFound(w, r)
+			return
+		}
+		version = strings.TrimSuffix(version, ".zip")
+	}
+
+	release, files, ok := h.loadRelease(w, server, version)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if isFile {
+		rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+		for _, f := range files {
+			if f.Path == rel {
+				h.serveReleaseBlob(w, r, f)
+				return
+			}
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	opts := modmanager.ZipOptions{SkipHelpers: r.URL.Query().Get("skip_helpers") == "1"}
+	name := fmt.Sprintf("%s-%s.zip", server.Name, release.Version)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("ETag", fmt.Sprintf(`"release-%d-%t"`, release.ID, opts.SkipHelpers))
+	if match := r.Header.Get("If-None-Match"); match != "" && match == w.Header().Get("ETag") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := modmanager.WriteReleaseZip(w, h.Releases, files, opts); err != nil {
+		// Headers are already sent, so the client just sees a truncated download.
+		log.Printf("Error streaming release %s for server %s: %v", release.Version, server.Name, err)
+	}
+}
+
+// serveReleaseBlob sends a single release file from the blob store.
+func (h *ServerHandler) serveReleaseBlob(w http.ResponseWriter, r *http.Request, f modmanager.SnapshotFile) {
+	blob, err := h.Releases.Open(f.SHA256)
+	if err != nil {
+		log.Printf("Error opening release blob %s (%s): %v", f.SHA256, f.Path, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+	info, err := blob.Stat()
+	if err != nil {
+		log.Printf("Error reading release blob %s (%s): %v", f.SHA256, f.Path, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+f.SHA256+`"`)
+	if hashes, err := h.Hashes.Hash(h.Releases.Path(f.SHA256)); err == nil {
+		w.Header().Set("Digest", hashes.Digest())
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(f.Path)))
+	http.ServeContent(w, r, path.Base(f.Path), info.ModTime(), blob)
+}
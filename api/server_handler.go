@@ -1,8 +1,10 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"github.com/tionis/mcow/auth"
 	"github.com/tionis/mcow/config"
@@ -12,6 +14,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -21,20 +25,37 @@ import (
 
 // ServerHandler holds dependencies for API handlers.
 type ServerHandler struct {
-	Store  *database.Store
-	Config *config.Config
-	Cache  *mcstatus.ServerStatusCache
-	Auth   *auth.Authenticator
+	Store    *database.Store
+	Config   *config.Config
+	Cache    *mcstatus.ServerStatusCache
+	Auth     *auth.Authenticator
+	Archives *modmanager.ArchiveCache
+	Hashes   *modmanager.Hasher
+	Index    *modmanager.Index
+	Releases *modmanager.BlobStore
+
+	packwiz packwizCache
 }
 
 // NewServerHandler creates a new ServerHandler.
 func NewServerHandler(store *database.Store, cfg *config.Config, cache *mcstatus.ServerStatusCache, auth *auth.Authenticator) *ServerHandler {
-	return &ServerHandler{
-		Store:  store,
-		Config: cfg,
-		Cache:  cache,
-		Auth:   auth,
+	hashes := modmanager.NewHasher(store)
+	h := &ServerHandler{
+		Store:    store,
+		Config:   cfg,
+		Cache:    cache,
+		Auth:     auth,
+		Archives: modmanager.NewArchiveCache(cfg.ArchiveCachePath),
+		Hashes:   hashes,
+		Index:    modmanager.NewIndex(cfg.ModDataPath, hashes, time.Duration(cfg.ModRescanInterval)*time.Second),
+		Releases: modmanager.NewBlobStore(cfg.ReleaseStorePath),
 	}
+	// Packs are checked against the directory fingerprint on every request
+	// anyway; dropping them on changes keeps stale packs out of memory.
+	h.Index.Subscribe(func(ev modmanager.ChangeEvent) {
+		h.packwiz.drop(ev.Server)
+	})
+	return h
 }
 
 // GetServers handles the API request to retrieve all servers.
@@ -121,7 +142,12 @@ func (h *ServerHandler) GetServerMods(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	modTree, err := modmanager.ScanModDirectory(h.Config.ModDataPath, serverName)
+	side, ok := sideParam(w, r)
+	if !ok {
+		return
+	}
+
+	modTree, err := h.classifiedTree(serverName)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") { // Check if directory doesn't exist
 			http.Error(w, fmt.Sprintf("Mod directory for server %s not found", serverName), http.StatusNotFound)
@@ -131,6 +157,14 @@ func (h *ServerHandler) GetServerMods(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if side != "" {
+		modTree = modmanager.FilterTree(modTree, side)
+	}
+	if counts, err := h.downloadCounts(serverName); err != nil {
+		log.Printf("Error loading download counts for server %s: %v", serverName, err)
+	} else {
+		modTree = modmanager.CountDownloads(modTree, counts)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(modTree); err != nil {
@@ -139,6 +173,34 @@ func (h *ServerHandler) GetServerMods(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetModIcon serves the icon embedded in a mod jar, given by the "path" query parameter.
+func (h *ServerHandler) GetModIcon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverName := vars["serverName"]
+
+	if !isValidServerName(serverName) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return
+	}
+
+	relPath := path.Clean("/" + r.URL.Query().Get("path"))
+	if !strings.HasSuffix(relPath, ".jar") {
+		http.Error(w, "Not a jar file", http.StatusBadRequest)
+		return
+	}
+
+	jarPath := filepath.Join(h.Config.ModDataPath, serverName, filepath.FromSlash(relPath))
+	data, _, err := modmanager.ReadJarIcon(jarPath)
+	if err != nil {
+		http.Error(w, "Icon not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
+
 // BlueMapProxy handles requests to proxy BlueMap instances.
 func (h *ServerHandler) BlueMapProxy(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -205,9 +267,211 @@ func (h *ServerHandler) ServeModFiles(w http.ResponseWriter, r *http.Request) {
 	// Construct the base directory for the server's mods using config
 	modBaseDir := filepath.Join(h.Config.ModDataPath, serverName)
 
+	// Directories can be downloaded as zip via "{dir}.zip" or "{dir}?download=zip"
+	prefix := fmt.Sprintf("/files/%s/mods", serverName)
+	relPath := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+	for _, part := range strings.Split(relPath, "/") {
+		if modmanager.IsInternalFile(part) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if dir, ok := zipRequestDir(modBaseDir, relPath, r.URL.Query().Get("download") == "zip"); ok {
+		opts := modmanager.ZipOptions{SkipHelpers: r.URL.Query().Get("skip_helpers") == "1", Root: modBaseDir}
+		if opts.Side, ok = sideParam(w, r); !ok {
+			return
+		}
+		if opts.Side != "" {
+			sideOf, err := h.sideLookup(serverName, dir)
+			if err != nil {
+				log.Printf("Error classifying mod files for server %s: %v", serverName, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			opts.SideOf = sideOf
+		}
+		h.serveCounted(w, r, serverName, modmanager.ZipDownloadPath(dir), func(w http.ResponseWriter) {
+			h.serveDirectoryZip(w, r, serverName, dir, opts)
+		})
+		return
+	}
+
+	// Every directory has a generated SHA256SUMS file unless a real one exists.
+	filePath := filepath.Join(modBaseDir, filepath.FromSlash(relPath))
+	info, statErr := os.Stat(filePath)
+	if path.Base(relPath) == "SHA256SUMS" && os.IsNotExist(statErr) {
+		h.serveSHA256Sums(w, r, serverName, path.Dir(relPath))
+		return
+	}
+
+	// Send content digests so clients can verify what they downloaded.
+	// http.FileServer honours the ETag for conditional requests. Files that
+	// were not hashed yet are sent right away without them and hashed in
+	// the background, so large files do not delay the first byte.
+	isFile := statErr == nil && info.Mode().IsRegular()
+	if isFile {
+		hashes, ok, err := h.Hashes.Lookup(filePath, info)
+		if err != nil {
+			log.Printf("Error hashing %s for server %s: %v", relPath, serverName, err)
+		} else if ok {
+			w.Header().Set("ETag", `"`+hashes.SHA256+`"`)
+			w.Header().Set("Digest", hashes.Digest())
+		}
+	}
+
 	// Create a file server for the constructed directory
 	// http.StripPrefix is needed to remove the part of the URL path that gorilla/mux matched.
-	http.StripPrefix(fmt.Sprintf("/files/%s/mods", serverName), http.FileServer(http.Dir(modBaseDir))).ServeHTTP(w, r)
+	fileServer := http.StripPrefix(fmt.Sprintf("/files/%s/mods", serverName), http.FileServer(internalHidingFS{http.Dir(modBaseDir)}))
+	if !isFile {
+		fileServer.ServeHTTP(w, r)
+		return
+	}
+	h.serveCounted(w, r, serverName, strings.TrimPrefix(relPath, "/"), func(w http.ResponseWriter) {
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// internalHidingFS leaves sidecar files and unfinished uploads out of
+// directory listings.
+type internalHidingFS struct {
+	http.FileSystem
+}
+
+func (fs internalHidingFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return internalHidingFile{f}, nil
+}
+
+type internalHidingFile struct {
+	http.File
+}
+
+func (f internalHidingFile) Readdir(count int) ([]os.FileInfo, error) {
+	entries, err := f.File.Readdir(count)
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !modmanager.IsInternalFile(entry.Name()) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, err
+}
+
+// serveSHA256Sums sends a sha256sum compatible checksum list for relDir.
+func (h *ServerHandler) serveSHA256Sums(w http.ResponseWriter, r *http.Request, serverName, relDir string) {
+	dir := filepath.Join(h.Config.ModDataPath, serverName, filepath.FromSlash(relDir))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.Hashes.WriteSHA256Sums(&buf, filepath.Join(h.Config.ModDataPath, serverName), dir); err != nil {
+		log.Printf("Error building SHA256SUMS for %s on server %s: %v", relDir, serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "SHA256SUMS", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// zipRequestDir determines whether the request for relPath asks for a
+// directory archive and returns the slash-separated directory to archive.
+// A real file named "*.zip" always takes precedence.
+func zipRequestDir(baseDir, relPath string, explicit bool) (string, bool) {
+	isDir := func(rel string) bool {
+		info, err := os.Stat(filepath.Join(baseDir, filepath.FromSlash(rel)))
+		return err == nil && info.IsDir()
+	}
+
+	if explicit && isDir(relPath) {
+		return relPath, true
+	}
+	if strings.HasSuffix(relPath, ".zip") {
+		if _, err := os.Stat(filepath.Join(baseDir, filepath.FromSlash(relPath))); err == nil {
+			return "", false
+		}
+		dir := strings.TrimSuffix(relPath, ".zip")
+		if dir == "" {
+			dir = "/"
+		}
+		if isDir(dir) {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// serveDirectoryZip sends a zip of relDir, reusing a cached archive if the
+// directory has not changed since it was built. Otherwise the archive is
+// streamed to the client while being written to the cache.
+func (h *ServerHandler) serveDirectoryZip(w http.ResponseWriter, r *http.Request, serverName, relDir string, opts modmanager.ZipOptions) {
+	dir := filepath.Join(h.Config.ModDataPath, serverName, filepath.FromSlash(relDir))
+
+	name := path.Base(relDir)
+	if relDir == "/" {
+		name = serverName
+	}
+	if opts.Side != "" && opts.SideOf != nil {
+		name += "-" + opts.Side
+	}
+	name += ".zip"
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	fingerprint, err := modmanager.DirFingerprint(dir, opts)
+	if err != nil {
+		log.Printf("Error fingerprinting %s for server %s: %v", relDir, serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	key := serverName + ":" + relDir + ":" + fmt.Sprint(opts.SkipHelpers) + ":" + opts.Side
+	if cached, ok := h.Archives.Lookup(key, fingerprint); ok {
+		f, err := os.Open(cached)
+		if err == nil {
+			defer f.Close()
+			if info, err := f.Stat(); err == nil {
+				w.Header().Set("ETag", `"`+fingerprint+`"`)
+				http.ServeContent(w, r, name, info.ModTime(), f)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("ETag", `"`+fingerprint+`"`)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var out io.Writer = w
+	pending, err := h.Archives.Create(key, fingerprint)
+	if err != nil && h.Archives.Enabled() {
+		log.Printf("Error creating cached archive for %s/%s: %v", serverName, relDir, err)
+	}
+	if pending != nil {
+		out = io.MultiWriter(w, pending)
+	}
+
+	if err := modmanager.WriteZip(out, dir, opts); err != nil {
+		// Headers are already sent, so the client just sees a truncated download.
+		log.Printf("Error streaming zip of %s for server %s: %v", relDir, serverName, err)
+		if pending != nil {
+			pending.Abort()
+		}
+		return
+	}
+
+	if pending != nil {
+		if err := pending.Commit(); err != nil {
+			log.Printf("Error caching archive for %s/%s: %v", serverName, relDir, err)
+		}
+	}
 }
 
 // isValidServerName checks if the server name is safe to use in file paths.
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"github.com/tionis/mcow/modmanager"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sideParam reads the optional "side" query parameter used to filter files
+// down to what a client or a server needs. On an invalid value it writes an
+// error response and returns false.
+func sideParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	side := r.URL.Query().Get("side")
+	if side != "" && side != modmanager.SideClient && side != modmanager.SideServer {
+		http.Error(w, fmt.Sprintf("Invalid side %q, expected %q or %q", side, modmanager.SideClient, modmanager.SideServer), http.StatusBadRequest)
+		return "", false
+	}
+	return side, true
+}
+
+// classifiedTree returns the server's mod tree with the side of every file
+// resolved from the jar metadata and the admin overrides.
+func (h *ServerHandler) classifiedTree(serverName string) (*modmanager.ModItem, error) {
+	tree, err := h.Index.Tree(serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides map[string]string
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		return nil, err
+	}
+	if server != nil {
+		if overrides, err = h.Store.GetSideOverrides(server.ID); err != nil {
+			return nil, err
+		}
+	}
+	return modmanager.ClassifyTree(tree, overrides), nil
+}
+
+// sideLookup returns a function resolving the side of a file given its path
+// relative to relDir, a slash-separated directory below the server root.
+func (h *ServerHandler) sideLookup(serverName, relDir string) (func(rel string) string, error) {
+	tree, err := h.classifiedTree(serverName)
+	if err != nil {
+		return nil, err
+	}
+	sides := modmanager.SideMap(tree)
+	prefix := strings.TrimPrefix(path.Clean("/"+relDir), "/")
+	return func(rel string) string {
+		return sides[path.Join(prefix, rel)]
+	}, nil
+}
@@ -4,82 +4,251 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/tionis/mcow/config"
+	"log"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
 )
 
-// Authenticator handles OIDC authentication.
+// discoveryRetryInterval limits how often a failed OIDC discovery is retried.
+const discoveryRetryInterval = 30 * time.Second
+
+// Authenticator handles OIDC authentication and the optional local admin login.
 type Authenticator struct {
-	Provider     *oidc.Provider
-	Config       oauth2.Config
-	Verifier     *oidc.IDTokenVerifier
-	SessionStore *sessions.CookieStore
+	SessionStore          *sessions.CookieStore
+	PostLogoutRedirectURL string
+
+	// LocalAdmin is the break-glass account, nil if not configured.
+	LocalAdmin *LocalAdmin
+	// Policy restricts which OIDC identities are accepted.
+	Policy AccessPolicy
+	// OnAudit, if set, is called for every login, denied login and logout.
+	OnAudit func(r *http.Request, user, action, detail string)
+
+	cfg *config.Config
+
+	mu            sync.Mutex
+	oidc          *oidcClient
+	lastDiscovery time.Time
+	discoveryErr  error
+}
+
+// oidcClient holds everything obtained from OIDC provider discovery.
+type oidcClient struct {
+	provider *oidc.Provider
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	// endSessionEndpoint is the provider's RP-initiated logout endpoint.
+	// Empty if the provider does not advertise one.
+	endSessionEndpoint string
+}
+
+// providerMetadata holds discovery fields not exposed by oidc.Provider directly.
+type providerMetadata struct {
+	EndSessionEndpoint string `json:"end_session_endpoint"`
 }
 
 // NewAuthenticator creates a new Authenticator.
+// It returns nil if neither OIDC nor a local admin account is configured.
+// A failing OIDC provider does not prevent startup; discovery is retried
+// lazily on the next login attempt.
 func NewAuthenticator(cfg *config.Config) (*Authenticator, error) {
-	ctx := context.Background()
+	localAdmin, err := newLocalAdmin(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.OIDCProviderURL == "" && localAdmin == nil {
+		return nil, nil // Authentication disabled
+	}
+	if cfg.OIDCProviderURL != "" {
+		if cfg.OIDCClientID == "" {
+			return nil, errors.New("OIDC_CLIENT_ID is required with OIDC_PROVIDER_URL")
+		}
+		if u, err := url.Parse(cfg.OIDCRedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("OIDC_REDIRECT_URL must be an absolute URL, got %q", cfg.OIDCRedirectURL)
+		}
+	}
+
+	postLogoutURL := cfg.OIDCPostLogoutRedirectURL
+	if postLogoutURL == "" {
+		postLogoutURL = baseURL(cfg.OIDCRedirectURL)
+	}
+
+	a := &Authenticator{
+		SessionStore:          sessions.NewCookieStore([]byte(cfg.SessionSecret)),
+		PostLogoutRedirectURL: postLogoutURL,
+		LocalAdmin:            localAdmin,
+		Policy:                newAccessPolicy(cfg),
+		cfg:                   cfg,
+	}
+
+	if a.OIDCEnabled() {
+		if _, err := a.client(); err != nil {
+			log.Printf("Warning: OIDC provider discovery failed, will retry on next login: %v", err)
+		}
+	}
+
+	return a, nil
+}
+
+// OIDCEnabled reports whether an OIDC provider is configured.
+func (a *Authenticator) OIDCEnabled() bool {
+	return a.cfg.OIDCProviderURL != ""
+}
+
+// client returns the discovered OIDC client, performing discovery if it has
+// not succeeded yet. Failed attempts are retried at most once per
+// discoveryRetryInterval so an unreachable provider is not hammered.
+func (a *Authenticator) client() (*oidcClient, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	// If OIDC is not configured, return nil (or handle graceful fallback)
-	if cfg.OIDCProviderURL == "" {
-		return nil, nil // OIDC disabled
+	if a.oidc != nil {
+		return a.oidc, nil
 	}
+	if !a.OIDCEnabled() {
+		return nil, errors.New("OIDC is not configured")
+	}
+	if a.discoveryErr != nil && time.Since(a.lastDiscovery) < discoveryRetryInterval {
+		return nil, a.discoveryErr
+	}
+
+	a.lastDiscovery = time.Now()
+	c, err := discover(a.cfg)
+	if err != nil {
+		a.discoveryErr = err
+		return nil, err
+	}
+
+	log.Println("OIDC provider discovery succeeded.")
+	a.oidc = c
+	a.discoveryErr = nil
+	return c, nil
+}
+
+// discover queries the provider's discovery document and builds an oidcClient.
+func discover(cfg *config.Config) (*oidcClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	provider, err := oidc.NewProvider(ctx, cfg.OIDCProviderURL)
 	if err != nil {
 		return nil, err
 	}
 
-	oidcConfig := &oidc.Config{
-		ClientID: cfg.OIDCClientID,
+	var meta providerMetadata
+	if err := provider.Claims(&meta); err != nil {
+		return nil, err
 	}
 
-	return &Authenticator{
-		Provider: provider,
-		Config: oauth2.Config{
+	return &oidcClient{
+		provider: provider,
+		config: oauth2.Config{
 			ClientID:     cfg.OIDCClientID,
 			ClientSecret: cfg.OIDCClientSecret,
 			RedirectURL:  cfg.OIDCRedirectURL,
 			Endpoint:     provider.Endpoint(),
 			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
 		},
-		Verifier:     provider.Verifier(oidcConfig),
-		SessionStore: sessions.NewCookieStore([]byte(cfg.SessionSecret)),
+		verifier:           provider.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID}),
+		endSessionEndpoint: meta.EndSessionEndpoint,
 	}, nil
 }
 
 // HandleLogin redirects the user to the OIDC provider.
+// An optional return_to query parameter selects the page shown after login.
+// If OIDC is unavailable and a local admin is configured, the user is sent to
+// the local login form instead.
 func (a *Authenticator) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	returnTo := safeReturnPath(r.URL.Query().Get("return_to"))
+
+	if !a.OIDCEnabled() {
+		http.Redirect(w, r, localLoginURL(returnTo, ""), http.StatusFound)
+		return
+	}
+
+	client, err := a.client()
+	if err != nil {
+		log.Printf("OIDC provider unavailable: %v", err)
+		if a.LocalAdmin != nil {
+			http.Redirect(w, r, localLoginURL(returnTo, "oidc_unavailable"), http.StatusFound)
+			return
+		}
+		http.Error(w, "Identity provider is currently unavailable, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
 	state, err := generateRandomState()
 	if err != nil {
 		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
 		return
 	}
+	nonce, err := generateRandomState()
+	if err != nil {
+		http.Error(w, "Failed to generate nonce", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
 
 	session, _ := a.SessionStore.Get(r, "mc-webui-session")
 	session.Values["state"] = state
-	session.Save(r, w)
+	session.Values["nonce"] = nonce
+	session.Values["pkce_verifier"] = verifier
+	if returnTo != "" {
+		session.Values["return_to"] = returnTo
+	} else {
+		delete(session.Values, "return_to")
+	}
+	if err := saveSession(w, r, session); err != nil {
+		http.Error(w, "Failed to start login session", http.StatusInternalServerError)
+		return
+	}
 
-	http.Redirect(w, r, a.Config.AuthCodeURL(state), http.StatusFound)
+	authURL := client.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
 // HandleCallback handles the OIDC callback.
 func (a *Authenticator) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	client, err := a.client()
+	if err != nil {
+		http.Error(w, "Identity provider is currently unavailable, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
 	session, _ := a.SessionStore.Get(r, "mc-webui-session")
 
 	// Validate state
 	state := r.URL.Query().Get("state")
-	if session.Values["state"] != state {
+	if expected, ok := session.Values["state"].(string); !ok || expected == "" || expected != state {
 		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
 		return
 	}
 
+	nonce, _ := session.Values["nonce"].(string)
+	verifier, _ := session.Values["pkce_verifier"].(string)
+	if nonce == "" || verifier == "" {
+		http.Error(w, "Login session expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	// The state, nonce and verifier are single-use.
+	delete(session.Values, "state")
+	delete(session.Values, "nonce")
+	delete(session.Values, "pkce_verifier")
+
 	// Exchange code for token
-	oauth2Token, err := a.Config.Exchange(r.Context(), r.URL.Query().Get("code"))
+	oauth2Token, err := client.config.Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(verifier))
 	if err != nil {
 		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -93,50 +262,134 @@ func (a *Authenticator) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify ID Token
-	idToken, err := a.Verifier.Verify(r.Context(), rawIDToken)
+	idToken, err := client.verifier.Verify(r.Context(), rawIDToken)
 	if err != nil {
 		http.Error(w, "Failed to verify ID Token: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Get claims
-	var claims struct {
-		Email string `json:"email"`
-		Sub   string `json:"sub"`
+	// Bind the ID token to this login request
+	if idToken.Nonce != nonce {
+		http.Error(w, "Invalid nonce in ID Token", http.StatusBadRequest)
+		return
 	}
+
+	// Get claims
+	var claims map[string]interface{}
 	if err := idToken.Claims(&claims); err != nil {
 		http.Error(w, "Failed to parse claims: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	email, _ := claims["email"].(string)
+
+	// Enforce access restrictions. The login method is kept so that logging
+	// out from the denial page also ends the provider session, letting the
+	// user switch accounts.
+	if reason := a.Policy.Evaluate(claims); reason != "" {
+		a.audit(r, email, "auth.login_denied", reason)
+		delete(session.Values, "return_to")
+		session.Values["authenticated"] = false
+		session.Values["auth_method"] = "oidc"
+		saveSession(w, r, session)
+		http.Redirect(w, r, "/login/denied?reason="+url.QueryEscape(reason), http.StatusFound)
+		return
+	}
+
+	returnTo, _ := session.Values["return_to"].(string)
+	if returnTo = safeReturnPath(returnTo); returnTo == "" {
+		returnTo = defaultReturnPath
+	}
+	delete(session.Values, "return_to")
 
-	// Save session
-	session.Values["user_email"] = claims.Email
+	a.audit(r, email, "auth.login", "oidc")
+
+	// Only the claims needed later are kept. The raw ID token is not stored:
+	// with group claims it easily exceeds the 4096 bytes a cookie may hold.
+	session.Values["user_email"] = email
+	session.Values["auth_method"] = "oidc"
 	session.Values["authenticated"] = true
-	session.Save(r, w)
+	delete(session.Values, "id_token") // stored by earlier versions
+	if err := saveSession(w, r, session); err != nil {
+		http.Error(w, "Failed to save login session", http.StatusInternalServerError)
+		return
+	}
 
-	http.Redirect(w, r, "/admin", http.StatusFound)
+	http.Redirect(w, r, returnTo, http.StatusFound)
 }
 
 // Middleware protects routes that require authentication.
+// Browsers are redirected to the login page and returned to the requested URL
+// afterwards; API clients receive a 401 JSON response instead.
 func (a *Authenticator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		session, _ := a.SessionStore.Get(r, "mc-webui-session")
 		if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			returnTo := requestReturnPath(r)
+			if WantsJSON(r) {
+				writeUnauthorized(w, returnTo)
+				return
+			}
+			http.Redirect(w, r, loginURL(returnTo), http.StatusFound)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// HandleLogout logs the user out.
+// HandleLogout logs the user out locally and, if supported, at the provider.
 func (a *Authenticator) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	session, _ := a.SessionStore.Get(r, "mc-webui-session")
+	method, _ := session.Values["auth_method"].(string)
+	if auth, ok := session.Values["authenticated"].(bool); ok && auth {
+		email, _ := session.Values["user_email"].(string)
+		a.audit(r, email, "auth.logout", method)
+	}
+
 	session.Values["authenticated"] = false
 	session.Values["user_email"] = ""
+	delete(session.Values, "id_token")
+	delete(session.Values, "auth_method")
 	session.Options.MaxAge = -1 // delete cookie
-	session.Save(r, w)
-	http.Redirect(w, r, "/", http.StatusFound)
+	saveSession(w, r, session)
+
+	// Local admin sessions have no provider session to end.
+	if method != "oidc" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	client, err := a.client()
+	if err != nil || client.endSessionEndpoint == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, a.endSessionURL(client), http.StatusFound)
+}
+
+// endSessionURL builds the RP-initiated logout URL for the provider. The
+// client is identified by client_id; no id_token_hint is sent since the ID
+// token is not kept, so some providers ask the user to confirm the logout.
+func (a *Authenticator) endSessionURL(client *oidcClient) string {
+	u, err := url.Parse(client.endSessionEndpoint)
+	if err != nil {
+		return "/"
+	}
+	q := u.Query()
+	q.Set("client_id", client.config.ClientID)
+	if a.PostLogoutRedirectURL != "" {
+		q.Set("post_logout_redirect_uri", a.PostLogoutRedirectURL)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// audit logs an authentication event and forwards it to OnAudit.
+func (a *Authenticator) audit(r *http.Request, user, action, detail string) {
+	log.Printf("AUDIT: %s user=%q detail=%q ip=%s", action, user, detail, ClientIP(r))
+	if a.OnAudit != nil {
+		a.OnAudit(r, user, action, detail)
+	}
 }
 
 // IsAuthenticated checks if the user is currently authenticated.
@@ -156,6 +409,16 @@ func (a *Authenticator) GetUserEmail(r *http.Request) string {
 	return email
 }
 
+// saveSession writes the session cookie. Failures, e.g. a cookie larger than
+// browsers accept, are logged so logins do not fail silently.
+func saveSession(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	err := session.Save(r, w)
+	if err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return err
+}
+
 func generateRandomState() (string, error) {
 	b := make([]byte, 32)
 	_, err := rand.Read(b)
@@ -164,3 +427,12 @@ func generateRandomState() (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(b), nil
 }
+
+// baseURL returns the scheme and host of rawURL with a trailing slash.
+func baseURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
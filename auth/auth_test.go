@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/tionis/mcow/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a minimal OIDC provider. Authorization codes are issued by
+// the test with authorize; the token endpoint checks the PKCE verifier
+// against the challenge of the code and returns an ID token with the nonce
+// the code was issued for.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, codes: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+			"n": b64(key.N.Bytes()),
+			"e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		grant, ok := p.codes[r.FormValue("code")]
+		delete(p.codes, r.FormValue("code"))
+		p.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || b64(sum[:]) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t, grant.nonce),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize issues code for the given PKCE challenge and nonce.
+func (p *fakeProvider) authorize(code, challenge, nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = fakeGrant{challenge: challenge, nonce: nonce}
+}
+
+func (p *fakeProvider) idToken(t *testing.T, nonce string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   "mcow",
+		"sub":   "user",
+		"email": "user@example.com",
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	signed := b64(header) + "." + b64(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	provider := newFakeProvider(t)
+	a, err := NewAuthenticator(&config.Config{
+		OIDCProviderURL: provider.URL,
+		OIDCClientID:    "mcow",
+		OIDCRedirectURL: "http://mcow.test/auth/callback",
+		SessionSecret:   "test-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		state      func(state string) string
+		challenge  func(challenge string) string // registered with the provider
+		nonce      func(nonce string) string     // put into the ID token
+		noCookie   bool
+		wantStatus int
+	}{
+		{name: "valid", wantStatus: http.StatusFound},
+		{name: "wrong state", state: func(string) string { return "forged" }, wantStatus: http.StatusBadRequest},
+		{name: "empty state", state: func(string) string { return "" }, wantStatus: http.StatusBadRequest},
+		{name: "no login session", noCookie: true, wantStatus: http.StatusBadRequest},
+		{name: "wrong PKCE verifier", challenge: func(string) string { return b64(make([]byte, 32)) }, wantStatus: http.StatusInternalServerError},
+		{name: "wrong nonce", nonce: func(string) string { return "other" }, wantStatus: http.StatusBadRequest},
+		{name: "missing nonce", nonce: func(string) string { return "" }, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := httptest.NewRecorder()
+			a.HandleLogin(login, httptest.NewRequest("GET", "/login?return_to=/admin/files/x", nil))
+			if login.Code != http.StatusFound {
+				t.Fatalf("login: status %d", login.Code)
+			}
+			authURL, err := url.Parse(login.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := authURL.Query()
+			if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+				t.Fatalf("authorization URL lacks PKCE or nonce: %s", authURL)
+			}
+
+			state, challenge, nonce := q.Get("state"), q.Get("code_challenge"), q.Get("nonce")
+			if tt.state != nil {
+				state = tt.state(state)
+			}
+			if tt.challenge != nil {
+				challenge = tt.challenge(challenge)
+			}
+			if tt.nonce != nil {
+				nonce = tt.nonce(nonce)
+			}
+			provider.authorize("code-"+tt.name, challenge, nonce)
+
+			req := httptest.NewRequest("GET", "/auth/callback?"+url.Values{"state": {state}, "code": {"code-" + tt.name}}.Encode(), nil)
+			if !tt.noCookie {
+				for _, c := range login.Result().Cookies() {
+					req.AddCookie(c)
+				}
+			}
+			rec := httptest.NewRecorder()
+			a.HandleCallback(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("callback: status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+
+			if loc := rec.Header().Get("Location"); loc != "/admin/files/x" {
+				t.Errorf("redirected to %q, want the return_to path", loc)
+			}
+			after := httptest.NewRequest("GET", "/admin", nil)
+			for _, c := range rec.Result().Cookies() {
+				after.AddCookie(c)
+			}
+			if !a.IsAuthenticated(after) || a.GetUserEmail(after) != "user@example.com" {
+				t.Error("session is not authenticated as the token's user")
+			}
+			session, _ := a.SessionStore.Get(after, "mc-webui-session")
+			for _, key := range []string{"id_token", "state", "nonce", "pkce_verifier"} {
+				if _, ok := session.Values[key]; ok {
+					t.Errorf("session still holds %q", key)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorConfig(t *testing.T) {
+	const hash = "$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA"
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		disabled bool
+		wantErr  bool
+	}{
+		{name: "nothing configured", cfg: config.Config{}, disabled: true},
+		{name: "local admin", cfg: config.Config{LocalAdminUsername: "admin", LocalAdminPasswordHash: hash}},
+		{name: "malformed password hash", cfg: config.Config{LocalAdminUsername: "admin", LocalAdminPasswordHash: "$argon2id$broken"}, wantErr: true},
+		{name: "empty username", cfg: config.Config{LocalAdminPasswordHash: hash}, wantErr: true},
+		{name: "invalid TOTP secret", cfg: config.Config{LocalAdminUsername: "admin", LocalAdminPasswordHash: hash, LocalAdminTOTPSecret: "not base32!"}, wantErr: true},
+		{name: "OIDC without client ID", cfg: config.Config{OIDCProviderURL: "http://127.0.0.1:1", OIDCRedirectURL: "http://mcow.test/auth/callback"}, wantErr: true},
+		{name: "OIDC with relative redirect URL", cfg: config.Config{OIDCProviderURL: "http://127.0.0.1:1", OIDCClientID: "mcow", OIDCRedirectURL: "/auth/callback"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAuthenticator(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuthenticator() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && (a == nil) != tt.disabled {
+				t.Errorf("NewAuthenticator() = %v, want disabled %t", a, tt.disabled)
+			}
+		})
+	}
+}
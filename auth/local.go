@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/tionis/mcow/config"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// localLoginMaxFailures is the number of failed attempts before an IP is locked out.
+	localLoginMaxFailures = 5
+	// localLoginLockout is how long an IP stays locked out after too many failures.
+	localLoginLockout = 15 * time.Minute
+)
+
+// LocalAdmin is a break-glass admin account configured via environment
+// variables, usable when the OIDC provider is unavailable.
+type LocalAdmin struct {
+	Username     string
+	passwordHash string
+	totpKey      []byte // nil if TOTP is not required
+
+	limiter *loginLimiter
+
+	// lastTOTPStep is the time step of the last accepted code. Codes of it
+	// and earlier steps are refused, so a code cannot be replayed.
+	totpMu       sync.Mutex
+	lastTOTPStep int64
+}
+
+// newLocalAdmin builds the local admin from config, or returns nil if no
+// password hash is configured.
+func newLocalAdmin(cfg *config.Config) (*LocalAdmin, error) {
+	if cfg.LocalAdminPasswordHash == "" {
+		return nil, nil
+	}
+	if cfg.LocalAdminUsername == "" {
+		return nil, fmt.Errorf("local admin username must not be empty")
+	}
+	if err := validatePasswordHash(cfg.LocalAdminPasswordHash); err != nil {
+		return nil, fmt.Errorf("invalid local admin password hash: %w", err)
+	}
+
+	admin := &LocalAdmin{
+		Username:     cfg.LocalAdminUsername,
+		passwordHash: cfg.LocalAdminPasswordHash,
+		limiter:      newLoginLimiter(),
+	}
+
+	if cfg.LocalAdminTOTPSecret != "" {
+		key, err := decodeTOTPSecret(cfg.LocalAdminTOTPSecret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local admin TOTP secret: %w", err)
+		}
+		admin.totpKey = key
+	}
+
+	return admin, nil
+}
+
+// TOTPEnabled reports whether a one-time code is required to log in.
+func (l *LocalAdmin) TOTPEnabled() bool {
+	return l.totpKey != nil
+}
+
+// check validates the submitted credentials.
+func (l *LocalAdmin) check(username, password, code string) bool {
+	// Always verify the password to keep timing independent of the username.
+	ok, err := verifyPassword(l.passwordHash, password)
+	if err != nil {
+		log.Printf("Error verifying local admin password: %v", err)
+		return false
+	}
+	if !ok || username != l.Username {
+		return false
+	}
+	if l.totpKey != nil {
+		return l.useTOTP(code, time.Now())
+	}
+	return true
+}
+
+// useTOTP validates a one-time code and marks its time step as used.
+func (l *LocalAdmin) useTOTP(code string, now time.Time) bool {
+	step, ok := validateTOTP(l.totpKey, code, now)
+	if !ok {
+		return false
+	}
+	l.totpMu.Lock()
+	defer l.totpMu.Unlock()
+	if step <= l.lastTOTPStep {
+		return false
+	}
+	l.lastTOTPStep = step
+	return true
+}
+
+// HandleLocalLogin processes the local admin login form.
+// Every attempt is logged, as this path bypasses the identity provider.
+func (a *Authenticator) HandleLocalLogin(w http.ResponseWriter, r *http.Request) {
+	if a.LocalAdmin == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	ip := ClientIP(r)
+	returnTo := safeReturnPath(r.FormValue("return_to"))
+	username := r.FormValue("username")
+
+	if a.LocalAdmin.limiter.locked(ip) {
+		a.audit(r, "local:"+username, "auth.login_failed", "locked out")
+		http.Redirect(w, r, localLoginURL(returnTo, "locked"), http.StatusFound)
+		return
+	}
+
+	if !a.LocalAdmin.check(username, r.FormValue("password"), r.FormValue("totp")) {
+		a.LocalAdmin.limiter.fail(ip)
+		a.audit(r, "local:"+username, "auth.login_failed", "invalid credentials")
+		http.Redirect(w, r, localLoginURL(returnTo, "invalid"), http.StatusFound)
+		return
+	}
+
+	a.LocalAdmin.limiter.reset(ip)
+	a.audit(r, "local:"+a.LocalAdmin.Username, "auth.login", "local")
+
+	if returnTo == "" {
+		returnTo = defaultReturnPath
+	}
+
+	session, _ := a.SessionStore.Get(r, "mc-webui-session")
+	session.Values["user_email"] = "local:" + a.LocalAdmin.Username
+	session.Values["auth_method"] = "local"
+	session.Values["authenticated"] = true
+	delete(session.Values, "id_token") // stored by earlier versions
+	if err := saveSession(w, r, session); err != nil {
+		http.Error(w, "Failed to save login session", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// localLoginURL returns the local login form path with an optional error code.
+func localLoginURL(returnTo, errCode string) string {
+	q := url.Values{}
+	if returnTo != "" {
+		q.Set("return_to", returnTo)
+	}
+	if errCode != "" {
+		q.Set("error", errCode)
+	}
+	if len(q) == 0 {
+		return "/login/local"
+	}
+	return "/login/local?" + q.Encode()
+}
+
+// loginLimiter tracks failed login attempts per IP address. Entries expire
+// localLoginLockout after the last failure or the end of the lockout, and are
+// swept out while recording failures so the map stays small even when many
+// addresses are tried.
+type loginLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// limiterSweepInterval is how often expired entries are removed.
+const limiterSweepInterval = time.Minute
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{entries: make(map[string]*limiterEntry)}
+}
+
+// expired reports whether the entry no longer affects logins.
+func (e *limiterEntry) expired(now time.Time) bool {
+	return !now.Before(e.lockedUntil) && now.Sub(e.lastFailure) >= localLoginLockout
+}
+
+func (l *loginLimiter) locked(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[ip]
+	return ok && time.Now().Before(e.lockedUntil)
+}
+
+func (l *loginLimiter) fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	e, ok := l.entries[ip]
+	if !ok || e.expired(now) {
+		e = &limiterEntry{}
+		l.entries[ip] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures >= localLoginMaxFailures {
+		e.lockedUntil = now.Add(localLoginLockout)
+		e.failures = 0
+	}
+}
+
+// sweep removes expired entries, at most once per limiterSweepInterval.
+// l.mu must be held.
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for ip, e := range l.entries {
+		if e.expired(now) {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+func (l *loginLimiter) reset(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, ip)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalAdminTOTPReplay(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	step := uint64(now.Unix() / totpPeriod)
+
+	// Each step is a login attempt at now with the code of the given step.
+	tests := []struct {
+		name  string
+		steps []uint64
+		want  []bool
+	}{
+		{"single use", []uint64{step}, []bool{true}},
+		{"replayed code", []uint64{step, step}, []bool{true, false}},
+		{"later code", []uint64{step, step + 1}, []bool{true, true}},
+		{"earlier code after later one", []uint64{step + 1, step}, []bool{true, false}},
+		{"skewed code after current one", []uint64{step, step - 1}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &LocalAdmin{totpKey: key}
+			for i, s := range tt.steps {
+				if got := admin.useTOTP(totpCode(key, s), now); got != tt.want[i] {
+					t.Errorf("attempt %d with code of step %d: accepted = %t, want %t", i+1, s, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	admin := &LocalAdmin{totpKey: key}
+	if admin.useTOTP("000000", now) {
+		t.Fatal("wrong code accepted")
+	}
+	if !admin.useTOTP(totpCode(key, step), now) {
+		t.Error("a failed attempt blocked the valid code")
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	l := newLoginLimiter()
+	for i := 1; i < localLoginMaxFailures; i++ {
+		l.fail("192.0.2.1")
+		if l.locked("192.0.2.1") {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	l.fail("192.0.2.1")
+	if !l.locked("192.0.2.1") {
+		t.Fatalf("not locked after %d failures", localLoginMaxFailures)
+	}
+	if l.locked("192.0.2.2") {
+		t.Error("lockout affects other addresses")
+	}
+	l.reset("192.0.2.1")
+	if l.locked("192.0.2.1") {
+		t.Error("still locked after reset")
+	}
+}
+
+func TestLoginLimiterExpiry(t *testing.T) {
+	l := newLoginLimiter()
+	past := time.Now().Add(-2 * localLoginLockout)
+	l.entries["192.0.2.1"] = &limiterEntry{failures: localLoginMaxFailures - 1, lastFailure: past}
+	l.entries["192.0.2.2"] = &limiterEntry{lastFailure: past, lockedUntil: past.Add(localLoginLockout)}
+	l.entries["192.0.2.3"] = &limiterEntry{failures: 1, lastFailure: time.Now()}
+
+	// Old failures are forgotten instead of adding up to a lockout.
+	l.fail("192.0.2.1")
+	if l.locked("192.0.2.1") {
+		t.Error("failures older than the lockout period still count")
+	}
+	if e := l.entries["192.0.2.1"]; e == nil || e.failures != 1 {
+		t.Errorf("entry after expiry = %+v, want 1 failure", e)
+	}
+	if _, ok := l.entries["192.0.2.2"]; ok {
+		t.Error("expired lockout was not swept")
+	}
+	if _, ok := l.entries["192.0.2.3"]; !ok {
+		t.Error("recent failure was swept")
+	}
+}
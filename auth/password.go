@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errUnsupportedHash is returned for password hashes in an unknown format.
+var errUnsupportedHash = errors.New("unsupported password hash format")
+
+// verifyPassword checks password against a bcrypt ($2a$/$2b$/$2y$) or
+// argon2id ($argon2id$v=19$m=...,t=...,p=...$salt$hash) encoded hash.
+func verifyPassword(encodedHash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"), strings.HasPrefix(encodedHash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		return verifyArgon2id(encodedHash, password)
+	default:
+		return false, errUnsupportedHash
+	}
+}
+
+// validatePasswordHash reports whether encodedHash can be used by verifyPassword.
+func validatePasswordHash(encodedHash string) error {
+	switch {
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"), strings.HasPrefix(encodedHash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(encodedHash))
+		return err
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		_, _, _, err := parseArgon2id(encodedHash)
+		return err
+	default:
+		return errUnsupportedHash
+	}
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2id decodes a PHC-formatted argon2id hash.
+func parseArgon2id(encodedHash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, errUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	return p, salt, hash, nil
+}
+
+func verifyArgon2id(encodedHash, password string) (bool, error) {
+	p, salt, hash, err := parseArgon2id(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, computed) == 1, nil
+}
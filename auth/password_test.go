@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2idHash encodes a PHC-formatted argon2id hash of password.
+func argon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash := argon2idHash("secret")
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"bcrypt", string(bcryptHash), "secret", true, false},
+		{"bcrypt wrong password", string(bcryptHash), "wrong", false, false},
+		{"bcrypt empty password", string(bcryptHash), "", false, false},
+		{"argon2id", argonHash, "secret", true, false},
+		{"argon2id wrong password", argonHash, "wrong", false, false},
+		{"argon2id empty password", argonHash, "", false, false},
+		{"plain text", "secret", "secret", false, true},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", "secret", false, true},
+		{"empty hash", "", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyPassword(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyPassword() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("verifyPassword() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"valid", argon2idHash("secret"), false},
+		{"missing hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", true},
+		{"extra part", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA$x", true},
+		{"old version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA", true},
+		{"no version", "$argon2id$m=64,t=1,p=1$c2FsdA$aGFzaA$x", true},
+		{"bad parameters", "$argon2id$v=19$m=64;t=1;p=1$c2FsdA$aGFzaA", true},
+		{"non-numeric parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$aGFzaA", true},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA", true},
+		{"bad hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := parseArgon2id(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseArgon2id() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error // nil for valid hashes; only checked with errors.Is if set
+		valid   bool
+	}{
+		{"bcrypt", string(bcryptHash), nil, true},
+		{"truncated bcrypt", string(bcryptHash[:10]), nil, false},
+		{"argon2id", argon2idHash("secret"), nil, true},
+		{"broken argon2id", "$argon2id$v=19$m=64", errUnsupportedHash, false},
+		{"sha256", "$5$rounds=5000$salt$hash", errUnsupportedHash, false},
+		{"plain text", "secret", errUnsupportedHash, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePasswordHash(tt.hash)
+			if tt.valid != (err == nil) {
+				t.Fatalf("validatePasswordHash() error = %v, want valid %t", err, tt.valid)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("validatePasswordHash() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
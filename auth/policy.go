@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"github.com/tionis/mcow/config"
+	"strings"
+)
+
+// Reasons a login can be denied by the access policy. They are passed to the
+// denial page as query parameter, so they must stay stable.
+const (
+	DenyEmailNotAllowed  = "email_not_allowed"
+	DenyEmailNotVerified = "email_not_verified"
+	DenyMissingGroup     = "missing_group"
+)
+
+// AccessPolicy restricts which OIDC identities may log in as admin.
+// An empty policy allows every identity issued by the provider.
+//
+// An allowlist of addresses is worthless if anybody can claim any address,
+// so with Emails or Domains the email_verified claim must be true unless
+// AllowUnverifiedEmail is set. RequireEmailVerified requires it without
+// an allowlist.
+type AccessPolicy struct {
+	Emails               []string // exact addresses, lower-case
+	Domains              []string // domains without "@", lower-case
+	RequireEmailVerified bool
+	AllowUnverifiedEmail bool
+	RequiredGroup        string
+	GroupsClaim          string
+}
+
+// newAccessPolicy builds the policy from config, normalising entries.
+func newAccessPolicy(cfg *config.Config) AccessPolicy {
+	p := AccessPolicy{
+		RequireEmailVerified: cfg.OIDCRequireEmailVerified,
+		AllowUnverifiedEmail: !cfg.OIDCRequireEmailVerified,
+		RequiredGroup:        cfg.OIDCRequiredGroup,
+		GroupsClaim:          cfg.OIDCGroupsClaim,
+	}
+	for _, e := range cfg.OIDCAllowedEmails {
+		p.Emails = append(p.Emails, strings.ToLower(e))
+	}
+	for _, d := range cfg.OIDCAllowedDomains {
+		p.Domains = append(p.Domains, strings.ToLower(strings.TrimPrefix(d, "@")))
+	}
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = "groups"
+	}
+	return p
+}
+
+// Evaluate checks the ID token claims against the policy and returns an
+// empty string if access is granted, or one of the Deny* reasons otherwise.
+func (p AccessPolicy) Evaluate(claims map[string]interface{}) string {
+	email, _ := claims["email"].(string)
+	email = strings.ToLower(email)
+
+	allowlist := len(p.Emails) > 0 || len(p.Domains) > 0
+	if allowlist && (email == "" || !p.emailAllowed(email)) {
+		return DenyEmailNotAllowed
+	}
+
+	requireVerified := p.RequireEmailVerified || (allowlist && !p.AllowUnverifiedEmail)
+	if requireVerified && !claimBool(claims["email_verified"]) {
+		return DenyEmailNotVerified
+	}
+
+	if p.RequiredGroup != "" && !claimContains(claims[p.GroupsClaim], p.RequiredGroup) {
+		return DenyMissingGroup
+	}
+
+	return ""
+}
+
+func (p AccessPolicy) emailAllowed(email string) bool {
+	for _, e := range p.Emails {
+		if e == email {
+			return true
+		}
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range p.Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// claimBool interprets a claim as boolean. Some providers send "true" as string.
+func claimBool(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return strings.EqualFold(b, "true")
+	default:
+		return false
+	}
+}
+
+// claimContains reports whether a string or string-array claim contains want.
+// Group paths like "/admins" (Keycloak) also match "admins".
+func claimContains(v interface{}, want string) bool {
+	match := func(s string) bool {
+		return s == want || strings.TrimPrefix(s, "/") == strings.TrimPrefix(want, "/")
+	}
+	switch vals := v.(type) {
+	case string:
+		return match(vals)
+	case []interface{}:
+		for _, item := range vals {
+			if s, ok := item.(string); ok && match(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"github.com/tionis/mcow/config"
+	"testing"
+)
+
+func TestAccessPolicyEvaluate(t *testing.T) {
+	type claims = map[string]interface{}
+	emails := []string{"alice@example.com"}
+	domains := []string{"ieee.org"}
+
+	tests := []struct {
+		name   string
+		policy AccessPolicy
+		claims claims
+		want   string
+	}{
+		{"empty policy", AccessPolicy{}, claims{}, ""},
+		{"empty policy ignores verification", AccessPolicy{}, claims{"email": "a@b.c", "email_verified": false}, ""},
+
+		// Allowlists
+		{"allowed email", AccessPolicy{Emails: emails}, claims{"email": "Alice@Example.com", "email_verified": true}, ""},
+		{"other email", AccessPolicy{Emails: emails}, claims{"email": "bob@example.com", "email_verified": true}, DenyEmailNotAllowed},
+		{"missing email", AccessPolicy{Emails: emails}, claims{"email_verified": true}, DenyEmailNotAllowed},
+		{"allowed domain", AccessPolicy{Domains: domains}, claims{"email": "bob@ieee.org", "email_verified": true}, ""},
+		{"subdomain", AccessPolicy{Domains: domains}, claims{"email": "bob@evil.ieee.org", "email_verified": true}, DenyEmailNotAllowed},
+		{"domain suffix", AccessPolicy{Domains: domains}, claims{"email": "bob@notieee.org", "email_verified": true}, DenyEmailNotAllowed},
+		{"domain in local part", AccessPolicy{Domains: domains}, claims{"email": "ieee.org@evil.com", "email_verified": true}, DenyEmailNotAllowed},
+		{"either list", AccessPolicy{Emails: emails, Domains: domains}, claims{"email": "alice@example.com", "email_verified": true}, ""},
+
+		// Verification
+		{"allowlist requires verification", AccessPolicy{Domains: domains}, claims{"email": "bob@ieee.org", "email_verified": false}, DenyEmailNotVerified},
+		{"allowlist without claim", AccessPolicy{Emails: emails}, claims{"email": "alice@example.com"}, DenyEmailNotVerified},
+		{"verified as string", AccessPolicy{Domains: domains}, claims{"email": "bob@ieee.org", "email_verified": "true"}, ""},
+		{"unverified allowed explicitly", AccessPolicy{Domains: domains, AllowUnverifiedEmail: true}, claims{"email": "bob@ieee.org", "email_verified": false}, ""},
+		{"unverified not on the list", AccessPolicy{Domains: domains, AllowUnverifiedEmail: true}, claims{"email": "bob@evil.com"}, DenyEmailNotAllowed},
+		{"verification without allowlist", AccessPolicy{RequireEmailVerified: true}, claims{"email": "a@b.c"}, DenyEmailNotVerified},
+		{"verified without allowlist", AccessPolicy{RequireEmailVerified: true}, claims{"email": "a@b.c", "email_verified": true}, ""},
+
+		// Groups
+		{"group", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"groups": []interface{}{"users", "admins"}}, ""},
+		{"keycloak group path", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"groups": []interface{}{"/admins"}}, ""},
+		{"single group string", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "roles"}, claims{"roles": "admins"}, ""},
+		{"missing group", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"groups": []interface{}{"users"}}, DenyMissingGroup},
+		{"no groups claim", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "groups"}, claims{}, DenyMissingGroup},
+		{"other claim", AccessPolicy{RequiredGroup: "admins", GroupsClaim: "roles"}, claims{"groups": []interface{}{"admins"}}, DenyMissingGroup},
+
+		// Combinations are checked in order: address, verification, group.
+		{"domain and group", AccessPolicy{Domains: domains, RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"email": "bob@ieee.org", "email_verified": true, "groups": []interface{}{"admins"}}, ""},
+		{"domain without group", AccessPolicy{Domains: domains, RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"email": "bob@ieee.org", "email_verified": true}, DenyMissingGroup},
+		{"group with unverified domain", AccessPolicy{Domains: domains, RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"email": "bob@ieee.org", "groups": []interface{}{"admins"}}, DenyEmailNotVerified},
+		{"group with other domain", AccessPolicy{Domains: domains, RequiredGroup: "admins", GroupsClaim: "groups"}, claims{"email": "bob@evil.com", "email_verified": true, "groups": []interface{}{"admins"}}, DenyEmailNotAllowed},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Evaluate(tt.claims); got != tt.want {
+			t.Errorf("%s: Evaluate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewAccessPolicy(t *testing.T) {
+	p := newAccessPolicy(&config.Config{
+		OIDCAllowedEmails:        []string{"Alice@Example.com"},
+		OIDCAllowedDomains:       []string{"@IEEE.org"},
+		OIDCRequireEmailVerified: true,
+	})
+	if p.Emails[0] != "alice@example.com" || p.Domains[0] != "ieee.org" || p.GroupsClaim != "groups" {
+		t.Errorf("newAccessPolicy() = %+v", p)
+	}
+	unverified := map[string]interface{}{"email": "bob@ieee.org"}
+	if got := p.Evaluate(unverified); got != DenyEmailNotVerified {
+		t.Errorf("Evaluate(unverified) = %q, want %q", got, DenyEmailNotVerified)
+	}
+
+	// Turning verification off explicitly allows unverified addresses on the list.
+	p = newAccessPolicy(&config.Config{OIDCAllowedDomains: []string{"ieee.org"}})
+	if got := p.Evaluate(unverified); got != "" {
+		t.Errorf("Evaluate(unverified) with verification off = %q, want access", got)
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.1", "172.16.0.0/12", "::1"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "198.51.100.7:4321", nil, "198.51.100.7"},
+		{"spoofed header from untrusted client", "198.51.100.7:4321", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"trusted proxy", "10.0.0.1:4321", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"trusted proxy without header", "10.0.0.1:4321", nil, "10.0.0.1"},
+		{"client-supplied entries are ignored", "10.0.0.1:4321", []string{"1.2.3.4, 203.0.113.9"}, "203.0.113.9"},
+		{"chain of trusted proxies", "10.0.0.1:4321", []string{"203.0.113.9, 172.16.5.5"}, "203.0.113.9"},
+		{"several headers", "10.0.0.1:4321", []string{"1.2.3.4", "203.0.113.9, 172.20.0.1"}, "203.0.113.9"},
+		{"only trusted hops", "10.0.0.1:4321", []string{"172.16.5.5"}, "172.16.5.5"},
+		{"malformed hop", "10.0.0.1:4321", []string{"203.0.113.9, garbage"}, "10.0.0.1"},
+		{"ipv6 proxy", "[::1]:4321", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"address next to a trusted proxy", "10.0.0.2:4321", []string{"203.0.113.9"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+	for _, bad := range []string{"localhost", "10.0.0.0/33", "10.0.0.1/", "300.1.1.1"} {
+		if err := SetTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("SetTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultReturnPath is where users land after login if no destination was requested.
+const defaultReturnPath = "/admin"
+
+// safeReturnPath validates that raw is a same-origin path and returns it,
+// or an empty string if it could redirect the user off-site.
+func safeReturnPath(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return ""
+	}
+	// Reject protocol-relative ("//evil") and backslash variants browsers normalise.
+	if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.HasPrefix(raw, "/\\") {
+		return ""
+	}
+	if strings.ContainsAny(raw, "\r\n") {
+		return ""
+	}
+	// Never bounce back into the login flow itself.
+	if u.Path == "/login" || u.Path == "/logout" || u.Path == "/auth/callback" {
+		return ""
+	}
+	return u.RequestURI()
+}
+
+// requestReturnPath determines where a user hitting a protected route should
+// be sent after logging in. Non-GET requests fall back to the referring page,
+// since replaying a form submission after login is not possible.
+func requestReturnPath(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return safeReturnPath(r.URL.RequestURI())
+	}
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host {
+		return ""
+	}
+	return safeReturnPath(ref.RequestURI())
+}
+
+// loginURL returns the login path carrying the given return destination.
+func loginURL(returnTo string) string {
+	if returnTo == "" {
+		return "/login"
+	}
+	return "/login?return_to=" + url.QueryEscape(returnTo)
+}
+
+// WantsJSON reports whether the client expects a JSON response rather than
+// an HTML page, e.g. fetch() calls from the frontend or API consumers.
+func WantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// writeUnauthorized responds with a 401 JSON body pointing at the login URL.
+func writeUnauthorized(w http.ResponseWriter, returnTo string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    "authentication required",
+		"loginUrl": loginURL(returnTo),
+	})
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafeReturnPath(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"/admin", "/admin"},
+		{"/admin/files/creative?path=mods", "/admin/files/creative?path=mods"},
+		{"/files/a%20b/", "/files/a%20b/"},
+
+		// Off-site destinations
+		{"https://evil.example", ""},
+		{"http://evil.example/admin", ""},
+		{"//evil.example", ""},
+		{"//evil.example/admin", ""},
+		{"/\\evil.example", ""},
+		{"\\\\evil.example", ""},
+		{"javascript:alert(1)", ""},
+		{"data:text/html,<script>alert(1)</script>", ""},
+		{"admin", ""},
+		{"evil.example/admin", ""},
+		{"https://user@evil.example", ""},
+
+		// Header injection
+		{"/admin\r\nSet-Cookie: x=y", ""},
+		{"/admin\nLocation: //evil.example", ""},
+
+		// Loops into the login flow
+		{"/login", ""},
+		{"/login?return_to=/admin", ""},
+		{"/logout", ""},
+		{"/auth/callback?code=x", ""},
+	}
+	for _, tt := range tests {
+		if got := safeReturnPath(tt.raw); got != tt.want {
+			t.Errorf("safeReturnPath(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestRequestReturnPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		referer string
+		want    string
+	}{
+		{"get", "GET", "/admin/files/creative", "", "/admin/files/creative"},
+		{"get with query", "GET", "/admin/stats/creative?days=7", "", "/admin/stats/creative?days=7"},
+		{"post uses referer", "POST", "/admin/files/delete", "http://mcow.test/admin/files/creative", "/admin/files/creative"},
+		{"post from other site", "POST", "/admin/files/delete", "http://evil.example/admin", ""},
+		{"post without referer", "POST", "/admin/files/delete", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://mcow.test"+tt.target, nil)
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			if got := requestReturnPath(r); got != tt.want {
+				t.Errorf("requestReturnPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
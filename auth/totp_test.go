@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 test key of RFC 6238, base32 encoded as
+// authenticator apps show it.
+const rfc6238Key = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestDecodeTOTPSecret(t *testing.T) {
+	for _, secret := range []string{
+		rfc6238Key,
+		"gezdgnbvgy3tqojqgezdgnbvgy3tqojq",
+		"GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ",
+		rfc6238Key + "====",
+	} {
+		key, err := decodeTOTPSecret(secret)
+		if err != nil {
+			t.Errorf("decodeTOTPSecret(%q): %v", secret, err)
+			continue
+		}
+		if string(key) != "12345678901234567890" {
+			t.Errorf("decodeTOTPSecret(%q) = %q", secret, key)
+		}
+	}
+	if _, err := decodeTOTPSecret("not base32!"); err == nil {
+		t.Error("decodeTOTPSecret accepted an invalid secret")
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	// RFC 6238 appendix B, truncated to six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, uint64(tt.unix/totpPeriod)); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", "050471", step, true},
+		{"surrounding whitespace", " 050471\n", step, true},
+		{"previous period", totpCode(key, uint64(step-1)), step - 1, true},
+		{"next period", totpCode(key, uint64(step+1)), step + 1, true},
+		{"beyond skew", totpCode(key, uint64(step-2)), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", "05047", 0, false},
+		{"too long", "0504710", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := validateTOTP(key, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("validateTOTP(%q) = %d, %t, want %d, %t", tt.code, got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -2,14 +2,40 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Config holds the application configuration.
 type Config struct {
-	Port           string
-	DatabasePath   string
-	ModDataPath    string
-	CacheDuration  int // Seconds
+	Port              string
+	DatabasePath      string
+	ModDataPath       string
+	ArchiveCachePath  string // Pre-built directory zips; empty disables caching
+	CacheDuration     int    // Seconds
+	ReleaseStorePath  string // Content-addressed storage for release snapshots
+	UploadStagingPath string // Partially received resumable uploads
+	TrashPath         string // Deleted files kept for restoring; empty deletes immediately
+
+	// TrashRetentionDays is how long deleted files are kept before they are
+	// purged automatically. 0 keeps them until purged manually.
+	TrashRetentionDays int
+
+	// Limits for archives extracted on upload, as protection against zip bombs.
+	ExtractMaxFiles int
+	ExtractMaxSize  int64 // Bytes
+
+	// ModRescanInterval is how often mod directories are fully rescanned in
+	// case filesystem notifications were missed. 0 disables rescanning.
+	ModRescanInterval int // Seconds
+
+	// PublicURL is the externally visible base URL, used for absolute links
+	// in generated modpacks. Derived from the request if empty.
+	PublicURL string
+
+	// TrustedProxies are the reverse proxies (IPs or CIDR ranges) whose
+	// X-Forwarded-For header is used to determine client IPs.
+	TrustedProxies []string
 
 	// OIDC Configuration
 	OIDCProviderURL  string
@@ -17,21 +43,64 @@ type Config struct {
 	OIDCClientSecret string
 	OIDCRedirectURL  string
 	SessionSecret    string
+
+	// OIDCPostLogoutRedirectURL is where the provider sends users after logout.
+	// Defaults to the root of OIDCRedirectURL.
+	OIDCPostLogoutRedirectURL string
+
+	// OIDC access restrictions (all empty allows any identity)
+	OIDCAllowedEmails        []string
+	OIDCAllowedDomains       []string
+	OIDCRequireEmailVerified bool
+	OIDCRequiredGroup        string
+	OIDCGroupsClaim          string
+
+	// Local break-glass admin (disabled if LocalAdminPasswordHash is empty)
+	LocalAdminUsername     string
+	LocalAdminPasswordHash string // bcrypt or argon2id (PHC format)
+	LocalAdminTOTPSecret   string // base32, optional
 }
 
 // LoadConfig reads configuration from environment variables or sets defaults.
 func LoadConfig() *Config {
+	allowedEmails := getEnvList("OIDC_ALLOWED_EMAILS")
+	allowedDomains := getEnvList("OIDC_ALLOWED_DOMAINS")
 	return &Config{
-		Port:           getEnv("PORT", "8080"),
-		DatabasePath:   getEnv("DB_PATH", "./mcow.db"),
-		ModDataPath:    getEnv("MOD_DATA_PATH", "data/mods"),
-		CacheDuration:  60,
-		
+		Port:              getEnv("PORT", "8080"),
+		DatabasePath:      getEnv("DB_PATH", "./mcow.db"),
+		ModDataPath:       getEnv("MOD_DATA_PATH", "data/mods"),
+		ArchiveCachePath:  getEnv("ARCHIVE_CACHE_PATH", "data/cache/archives"),
+		CacheDuration:     60,
+		ReleaseStorePath:  getEnv("RELEASE_STORE_PATH", "data/releases"),
+		UploadStagingPath: getEnv("UPLOAD_STAGING_PATH", "data/uploads"),
+		TrashPath:         getEnv("TRASH_PATH", "data/trash"),
+		PublicURL:         getEnv("PUBLIC_URL", ""),
+		TrustedProxies:    getEnvList("TRUSTED_PROXIES"),
+
+		ModRescanInterval:  getEnvInt("MOD_RESCAN_INTERVAL", 300),
+		TrashRetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 30),
+
+		ExtractMaxFiles: getEnvInt("EXTRACT_MAX_FILES", 10000),
+		ExtractMaxSize:  int64(getEnvInt("EXTRACT_MAX_SIZE_MB", 4096)) << 20,
+
 		OIDCProviderURL:  getEnv("OIDC_PROVIDER_URL", ""),
 		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
 		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
 		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/callback"),
 		SessionSecret:    getEnv("SESSION_SECRET", "super-secret-key-change-me"),
+
+		OIDCPostLogoutRedirectURL: getEnv("OIDC_POST_LOGOUT_REDIRECT_URL", ""),
+
+		OIDCAllowedEmails:  allowedEmails,
+		OIDCAllowedDomains: allowedDomains,
+		// Allowlists require verified addresses unless explicitly disabled.
+		OIDCRequireEmailVerified: getEnvBool("OIDC_REQUIRE_EMAIL_VERIFIED", len(allowedEmails)+len(allowedDomains) > 0),
+		OIDCRequiredGroup:        getEnv("OIDC_REQUIRED_GROUP", ""),
+		OIDCGroupsClaim:          getEnv("OIDC_GROUPS_CLAIM", "groups"),
+
+		LocalAdminUsername:     getEnv("LOCAL_ADMIN_USERNAME", "admin"),
+		LocalAdminPasswordHash: getEnv("LOCAL_ADMIN_PASSWORD_HASH", ""),
+		LocalAdminTOTPSecret:   getEnv("LOCAL_ADMIN_TOTP_SECRET", ""),
 	}
 }
 
@@ -42,3 +111,41 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList retrieves a comma-separated environment variable as a list,
+// skipping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvBool retrieves a boolean environment variable or returns a default value.
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+// getEnvInt retrieves an integer environment variable or returns a default value.
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
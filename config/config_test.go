@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestRequireEmailVerifiedDefault(t *testing.T) {
+	tests := []struct {
+		emails, domains, require string
+		want                     bool
+	}{
+		{"", "", "", false},
+		{"alice@example.com", "", "", true},
+		{"", "ieee.org", "", true},
+		{"", "ieee.org", "false", false},
+		{"", "", "true", true},
+	}
+	for _, tt := range tests {
+		// An empty OIDC_REQUIRE_EMAIL_VERIFIED is invalid and uses the default.
+		for key, value := range map[string]string{"OIDC_ALLOWED_EMAILS": tt.emails, "OIDC_ALLOWED_DOMAINS": tt.domains, "OIDC_REQUIRE_EMAIL_VERIFIED": tt.require} {
+			t.Setenv(key, value)
+		}
+		if got := LoadConfig().OIDCRequireEmailVerified; got != tt.want {
+			t.Errorf("emails %q, domains %q, OIDC_REQUIRE_EMAIL_VERIFIED=%q: got %t, want %t", tt.emails, tt.domains, tt.require, got, tt.want)
+		}
+	}
+}
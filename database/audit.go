@@ -0,0 +1,118 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// AuditEntry is a single record of an administrative action.
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Before    string    `json:"before,omitempty"` // JSON snapshot before the change
+	After     string    `json:"after,omitempty"`  // JSON snapshot after the change
+	IP        string    `json:"ip"`
+}
+
+// AuditFilter narrows down the audit entries returned by ListAuditEntries.
+// Zero values are ignored.
+type AuditFilter struct {
+	User   string // substring match
+	Action string // prefix match, e.g. "file." matches all file actions
+	Target string // substring match
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// InsertAuditEntry stores a new audit entry. CreatedAt defaults to now.
+func (s *Store) InsertAuditEntry(e *AuditEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	res, err := s.DB.Exec(`INSERT INTO audit_log (created_at, user, action, target, before, after, ip) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt.UTC(), e.User, e.Action, e.Target, e.Before, e.After, e.IP)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err == nil {
+		e.ID = int(id)
+	}
+	return nil
+}
+
+// ListAuditEntries retrieves audit entries matching the filter, newest first.
+func (s *Store) ListAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	var conds []string
+	var args []interface{}
+
+	if f.User != "" {
+		conds = append(conds, "user LIKE ?")
+		args = append(args, "%"+f.User+"%")
+	}
+	if f.Action != "" {
+		conds = append(conds, "action LIKE ?")
+		args = append(args, f.Action+"%")
+	}
+	if f.Target != "" {
+		conds = append(conds, "target LIKE ?")
+		args = append(args, "%"+f.Target+"%")
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	query := "SELECT id, created_at, user, action, target, before, after, ip FROM audit_log"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.User, &e.Action, &e.Target, &e.Before, &e.After, &e.IP); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ListAuditActions returns the distinct actions present in the audit log.
+func (s *Store) ListAuditActions() ([]string, error) {
+	rows, err := s.DB.Query("SELECT DISTINCT action FROM audit_log ORDER BY action")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -378,24 +378,41 @@ func (s *Store) UpdateServer(srv *Server) error {
 
 
 
-// DeleteServer deletes a server from the database by ID.
-
+// DeleteServer deletes a server from the database by ID, together with
+// everything stored for it: side overrides, quota, releases and download
+// counts.
 func (s *Store) DeleteServer(id int) error {
-
-	stmt, err := s.DB.Prepare("DELETE FROM servers WHERE id=?")
-
+	tx, err := s.DB.Begin()
 	if err != nil {
-
 		return err
-
 	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM mod_side_overrides WHERE server_id = ?",
+		"DELETE FROM server_quotas WHERE server_id = ?",
+		"DELETE FROM release_files WHERE release_id IN (SELECT id FROM releases WHERE server_id = ?)",
+		"DELETE FROM releases WHERE server_id = ?",
+		"DELETE FROM file_downloads WHERE server_id = ?",
+		"DELETE FROM servers WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
-	defer stmt.Close()
-
-
-
-	_, err = stmt.Exec(id)
-
-	return err
+// GetServerByID retrieves a single server from the database by its ID.
+func (s *Store) GetServerByID(id int) (*Server, error) {
+	row := s.DB.QueryRow("SELECT name FROM servers WHERE id = ?", id)
 
+	var name string
+	if err := row.Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Server not found
+		}
+		return nil, err
+	}
+	return s.GetServerByName(name)
 }
@@ -0,0 +1,92 @@
+package database
+
+import "time"
+
+// DownloadDayFormat is the format of the days downloads are counted by, in UTC.
+const DownloadDayFormat = "2006-01-02"
+
+// FileDownloads is the number of downloads of a single file.
+type FileDownloads struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// DayDownloads is the number of downloads of all files of a server on one day.
+type DayDownloads struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// RecordDownload counts a download of the file at path, slash-separated and
+// relative to the server's mod directory, on the day of t.
+func (s *Store) RecordDownload(serverID int, path string, t time.Time) error {
+	_, err := s.DB.Exec(`INSERT INTO file_downloads (server_id, path, day, count) VALUES (?, ?, ?, 1)
+		ON CONFLICT (server_id, path, day) DO UPDATE SET count = count + 1`,
+		serverID, path, t.UTC().Format(DownloadDayFormat))
+	return err
+}
+
+// GetDownloadCounts returns the number of downloads of a server's files
+// since the given day, keyed by path. An empty since counts all downloads.
+func (s *Store) GetDownloadCounts(serverID int, since string) (map[string]int, error) {
+	rows, err := s.DB.Query(`SELECT path, SUM(count) FROM file_downloads WHERE server_id = ? AND day >= ? GROUP BY path`, serverID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var path string
+		var count int
+		if err := rows.Scan(&path, &count); err != nil {
+			return nil, err
+		}
+		counts[path] = count
+	}
+	return counts, rows.Err()
+}
+
+// ListTopDownloads returns the most downloaded files of a server since the
+// given day, most downloaded first. A limit of 0 returns all files.
+func (s *Store) ListTopDownloads(serverID int, since string, limit int) ([]FileDownloads, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.DB.Query(`SELECT path, SUM(count) AS total FROM file_downloads WHERE server_id = ? AND day >= ?
+		GROUP BY path ORDER BY total DESC, path LIMIT ?`, serverID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []FileDownloads
+	for rows.Next() {
+		var f FileDownloads
+		if err := rows.Scan(&f.Path, &f.Count); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// ListDailyDownloads returns the total downloads of a server per day since
+// the given day, oldest first. Days without downloads are left out.
+func (s *Store) ListDailyDownloads(serverID int, since string) ([]DayDownloads, error) {
+	rows, err := s.DB.Query(`SELECT day, SUM(count) FROM file_downloads WHERE server_id = ? AND day >= ? GROUP BY day ORDER BY day`, serverID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []DayDownloads
+	for rows.Next() {
+		var d DayDownloads
+		if err := rows.Scan(&d.Day, &d.Count); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
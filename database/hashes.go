@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tionis/mcow/modmanager"
+)
+
+// GetFileHashes returns the cached hashes of the file at path, or nil if
+// there are none for the given size and modification time.
+func (s *Store) GetFileHashes(path string, size int64, modTime time.Time) (*modmanager.FileHashes, error) {
+	var h modmanager.FileHashes
+	err := s.DB.QueryRow(`SELECT sha1, sha256, sha512 FROM file_hashes WHERE path = ? AND size = ? AND mod_time = ?`,
+		path, size, modTime.UnixNano()).Scan(&h.SHA1, &h.SHA256, &h.SHA512)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// PutFileHashes stores the hashes of the file at path, replacing any entry
+// for an older version of the file.
+func (s *Store) PutFileHashes(path string, size int64, modTime time.Time, h modmanager.FileHashes) error {
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO file_hashes (path, size, mod_time, sha1, sha256, sha512) VALUES (?, ?, ?, ?, ?, ?)`,
+		path, size, modTime.UnixNano(), h.SHA1, h.SHA256, h.SHA512)
+	return err
+}
+
+// DeleteFileHashes removes the cached hashes of the given paths.
+func (s *Store) DeleteFileHashes(paths []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, path := range paths {
+		if _, err := tx.Exec(`DELETE FROM file_hashes WHERE path = ?`, path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FileHashPaths returns the paths of all cached hashes below dir.
+func (s *Store) FileHashPaths(dir string) ([]string, error) {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	rows, err := s.DB.Query(`SELECT path FROM file_hashes WHERE substr(path, 1, length(?)) = ?`, prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    "created_at" DATETIME NOT NULL,
+    "user" TEXT NOT NULL,
+    "action" TEXT NOT NULL,
+    "target" TEXT NOT NULL DEFAULT '',
+    "before" TEXT NOT NULL DEFAULT '',
+    "after" TEXT NOT NULL DEFAULT '',
+    "ip" TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS file_hashes (
+    "path" TEXT NOT NULL PRIMARY KEY,
+    "size" INTEGER NOT NULL,
+    "mod_time" INTEGER NOT NULL,
+    "sha1" TEXT NOT NULL,
+    "sha256" TEXT NOT NULL,
+    "sha512" TEXT NOT NULL
+);
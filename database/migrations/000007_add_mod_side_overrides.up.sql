@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS mod_side_overrides (
+    "server_id" INTEGER NOT NULL,
+    "path" TEXT NOT NULL,
+    "side" TEXT NOT NULL,
+    PRIMARY KEY ("server_id", "path")
+);
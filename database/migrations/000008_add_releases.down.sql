@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS release_files;
+DROP TABLE IF EXISTS releases;
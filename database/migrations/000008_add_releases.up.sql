@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS releases (
+    "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    "server_id" INTEGER NOT NULL,
+    "version" TEXT NOT NULL,
+    "notes" TEXT NOT NULL DEFAULT '',
+    "changelog" TEXT NOT NULL DEFAULT '',
+    "created_at" DATETIME NOT NULL,
+    "created_by" TEXT NOT NULL DEFAULT '',
+    UNIQUE ("server_id", "version")
+);
+CREATE TABLE IF NOT EXISTS release_files (
+    "release_id" INTEGER NOT NULL,
+    "path" TEXT NOT NULL,
+    "sha256" TEXT NOT NULL,
+    "size" INTEGER NOT NULL,
+    "mod_id" TEXT NOT NULL DEFAULT '',
+    "mod_name" TEXT NOT NULL DEFAULT '',
+    "mod_version" TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY ("release_id", "path")
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS server_quotas (
+    "server_id" INTEGER NOT NULL PRIMARY KEY,
+    "max_bytes" INTEGER NOT NULL DEFAULT 0,
+    "max_files" INTEGER NOT NULL DEFAULT 0,
+    "max_file_size" INTEGER NOT NULL DEFAULT 0,
+    "extensions" TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS file_downloads (
+    "server_id" INTEGER NOT NULL,
+    "path" TEXT NOT NULL,
+    "day" TEXT NOT NULL,
+    "count" INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY ("server_id", "path", "day")
+);
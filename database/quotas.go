@@ -0,0 +1,29 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/tionis/mcow/modmanager"
+)
+
+// GetQuota returns the quota and upload policy of a server. Servers without
+// one are unlimited.
+func (s *Store) GetQuota(serverID int) (modmanager.Quota, error) {
+	var q modmanager.Quota
+	var extensions string
+	err := s.DB.QueryRow(`SELECT max_bytes, max_files, max_file_size, extensions FROM server_quotas WHERE server_id = ?`, serverID).
+		Scan(&q.MaxBytes, &q.MaxFiles, &q.MaxFileSize, &extensions)
+	if err == sql.ErrNoRows {
+		return q, nil
+	}
+	q.Extensions = modmanager.ParseExtensions(extensions)
+	return q, err
+}
+
+// SetQuota replaces the quota and upload policy of a server.
+func (s *Store) SetQuota(serverID int, q modmanager.Quota) error {
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO server_quotas (server_id, max_bytes, max_files, max_file_size, extensions) VALUES (?, ?, ?, ?, ?)`,
+		serverID, q.MaxBytes, q.MaxFiles, q.MaxFileSize, strings.Join(q.Extensions, ","))
+	return err
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/tionis/mcow/modmanager"
+)
+
+// Release is an immutable snapshot of a server's mod directory.
+type Release struct {
+	ID        int                   `json:"id"`
+	ServerID  int                   `json:"-"`
+	Version   string                `json:"version"`
+	Notes     string                `json:"notes,omitempty"`
+	Changelog *modmanager.Changelog `json:"changelog"`
+	CreatedAt time.Time             `json:"createdAt"`
+	CreatedBy string                `json:"-"`
+	FileCount int                   `json:"fileCount"`
+	TotalSize int64                 `json:"totalSize"`
+}
+
+const releaseColumns = `r.id, r.server_id, r.version, r.notes, r.changelog, r.created_at, r.created_by,
+	(SELECT COUNT(*) FROM release_files f WHERE f.release_id = r.id),
+	(SELECT COALESCE(SUM(size), 0) FROM release_files f WHERE f.release_id = r.id)`
+
+// scanRelease reads a row selected with releaseColumns.
+func scanRelease(scan func(dest ...interface{}) error) (*Release, error) {
+	var r Release
+	var changelog string
+	if err := scan(&r.ID, &r.ServerID, &r.Version, &r.Notes, &changelog, &r.CreatedAt, &r.CreatedBy, &r.FileCount, &r.TotalSize); err != nil {
+		return nil, err
+	}
+	if changelog != "" {
+		r.Changelog = &modmanager.Changelog{}
+		if err := json.Unmarshal([]byte(changelog), r.Changelog); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// CreateRelease stores a release and its files in a single transaction.
+// CreatedAt defaults to now.
+func (s *Store) CreateRelease(r *Release, files []modmanager.SnapshotFile) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	changelog, err := json.Marshal(r.Changelog)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO releases (server_id, version, notes, changelog, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.ServerID, r.Version, r.Notes, string(changelog), r.CreatedAt.UTC(), r.CreatedBy)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO release_files (release_id, path, sha256, size, mod_id, mod_name, mod_version) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var total int64
+	for _, f := range files {
+		if _, err := stmt.Exec(id, f.Path, f.SHA256, f.Size, f.ModID, f.ModName, f.ModVersion); err != nil {
+			return err
+		}
+		total += f.Size
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.ID, r.FileCount, r.TotalSize = int(id), len(files), total
+	return nil
+}
+
+// ListReleases returns the releases of a server, newest first.
+func (s *Store) ListReleases(serverID int) ([]Release, error) {
+	rows, err := s.DB.Query(`SELECT `+releaseColumns+` FROM releases r WHERE r.server_id = ? ORDER BY r.created_at DESC, r.id DESC`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var releases []Release
+	for rows.Next() {
+		r, err := scanRelease(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, *r)
+	}
+	return releases, rows.Err()
+}
+
+// GetRelease returns a server's release by version, or nil if there is none.
+func (s *Store) GetRelease(serverID int, version string) (*Release, error) {
+	row := s.DB.QueryRow(`SELECT `+releaseColumns+` FROM releases r WHERE r.server_id = ? AND r.version = ?`, serverID, version)
+	r, err := scanRelease(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetLatestRelease returns the newest release of a server, or nil if there is none.
+func (s *Store) GetLatestRelease(serverID int) (*Release, error) {
+	row := s.DB.QueryRow(`SELECT `+releaseColumns+` FROM releases r WHERE r.server_id = ? ORDER BY r.created_at DESC, r.id DESC LIMIT 1`, serverID)
+	r, err := scanRelease(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListReleaseFiles returns the files of a release sorted by path.
+func (s *Store) ListReleaseFiles(releaseID int) ([]modmanager.SnapshotFile, error) {
+	rows, err := s.DB.Query(`SELECT path, sha256, size, mod_id, mod_name, mod_version FROM release_files WHERE release_id = ? ORDER BY path`, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []modmanager.SnapshotFile
+	for rows.Next() {
+		var f modmanager.SnapshotFile
+		if err := rows.Scan(&f.Path, &f.SHA256, &f.Size, &f.ModID, &f.ModName, &f.ModVersion); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,32 @@
+package database
+
+// GetSideOverrides returns the admin-set sides of a server's files, keyed by
+// slash-separated path relative to the server's mod directory.
+func (s *Store) GetSideOverrides(serverID int) (map[string]string, error) {
+	rows, err := s.DB.Query(`SELECT path, side FROM mod_side_overrides WHERE server_id = ?`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make(map[string]string)
+	for rows.Next() {
+		var path, side string
+		if err := rows.Scan(&path, &side); err != nil {
+			return nil, err
+		}
+		overrides[path] = side
+	}
+	return overrides, rows.Err()
+}
+
+// SetSideOverride sets the side of a file. An empty side removes the
+// override so the side declared by the mod is used again.
+func (s *Store) SetSideOverride(serverID int, path, side string) error {
+	if side == "" {
+		_, err := s.DB.Exec(`DELETE FROM mod_side_overrides WHERE server_id = ? AND path = ?`, serverID, path)
+		return err
+	}
+	_, err := s.DB.Exec(`INSERT OR REPLACE INTO mod_side_overrides (server_id, path, side) VALUES (?, ?, ?)`, serverID, path, side)
+	return err
+}
@@ -26,19 +26,31 @@ func main() {
 	// 3. Initialize Cache
 	cache := mcstatus.NewServerStatusCache()
 
+	if err := auth.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %s\n", err)
+	}
+
 	// 4. Initialize Authenticator
+	// A broken configuration must not leave the admin routes open, only
+	// configuring nothing disables authentication.
 	authenticator, err := auth.NewAuthenticator(cfg)
 	if err != nil {
-		log.Printf("Warning: OIDC authentication could not be initialized: %v", err)
+		log.Fatalf("could not initialize authentication: %s\n", err)
 	} else if authenticator == nil {
-		log.Println("OIDC authentication is disabled (not configured).")
+		log.Println("Authentication is disabled (neither OIDC nor a local admin is configured).")
 	} else {
-		log.Println("OIDC authentication initialized.")
+		log.Printf("Authentication initialized (OIDC: %t, local admin: %t).", authenticator.OIDCEnabled(), authenticator.LocalAdmin != nil)
 	}
 
 	// 5. Initialize Handlers
 	serverHandler := api.NewServerHandler(store, cfg, cache, authenticator)
 	webHandler := web.NewWebHandler(store, cfg, authenticator)
+	webHandler.Index = serverHandler.Index
+	webHandler.Releases = serverHandler.Releases
+	if authenticator != nil {
+		authenticator.OnAudit = webHandler.RecordAuthEvent
+	}
+	go webHandler.PurgeTrashLoop()
 
 	router := mux.NewRouter()
 
@@ -47,6 +59,9 @@ func main() {
 	
 	if authenticator != nil {
 		router.HandleFunc("/login", authenticator.HandleLogin).Methods("GET")
+		router.HandleFunc("/login/local", webHandler.LocalLogin).Methods("GET")
+		router.HandleFunc("/login/local", authenticator.HandleLocalLogin).Methods("POST")
+		router.HandleFunc("/login/denied", webHandler.AccessDenied).Methods("GET")
 		router.HandleFunc("/logout", authenticator.HandleLogout).Methods("GET")
 		router.HandleFunc("/auth/callback", authenticator.HandleCallback).Methods("GET")
 		
@@ -55,12 +70,32 @@ func main() {
 		router.Handle("/admin/servers/add", authenticator.Middleware(http.HandlerFunc(webHandler.HandleServerCreate))).Methods("POST")
 		router.Handle("/admin/servers/update", authenticator.Middleware(http.HandlerFunc(webHandler.HandleServerUpdate))).Methods("POST")
 		router.Handle("/admin/servers/delete", authenticator.Middleware(http.HandlerFunc(webHandler.HandleServerDelete))).Methods("POST")
+		router.Handle("/admin/audit", authenticator.Middleware(http.HandlerFunc(webHandler.AuditLog))).Methods("GET")
+		router.Handle("/admin/audit/export", authenticator.Middleware(http.HandlerFunc(webHandler.AuditExport))).Methods("GET")
 		
 		// File Manager Routes
+		router.Handle("/admin/files/text", authenticator.Middleware(http.HandlerFunc(webHandler.HandleTextFileGet))).Methods("GET")
 		router.Handle("/admin/files/{serverName}", authenticator.Middleware(http.HandlerFunc(webHandler.FileManager))).Methods("GET")
 		router.Handle("/admin/files/upload", authenticator.Middleware(http.HandlerFunc(webHandler.HandleFileUpload))).Methods("POST")
 		router.Handle("/admin/files/delete", authenticator.Middleware(http.HandlerFunc(webHandler.HandleFileDelete))).Methods("POST")
 		router.Handle("/admin/files/mkdir", authenticator.Middleware(http.HandlerFunc(webHandler.HandleMkdir))).Methods("POST")
+		router.Handle("/admin/files/move", authenticator.Middleware(http.HandlerFunc(webHandler.HandleFileMove))).Methods("POST")
+		router.Handle("/admin/files/copy", authenticator.Middleware(http.HandlerFunc(webHandler.HandleFileCopy))).Methods("POST")
+		router.Handle("/admin/files/text", authenticator.Middleware(http.HandlerFunc(webHandler.HandleTextFileSave))).Methods("POST")
+		router.Handle("/admin/files/preview", authenticator.Middleware(http.HandlerFunc(webHandler.HandleMarkdownPreview))).Methods("POST")
+		router.Handle("/admin/files/side", authenticator.Middleware(http.HandlerFunc(webHandler.HandleSideOverride))).Methods("POST")
+		router.Handle("/admin/uploads", authenticator.Middleware(http.HandlerFunc(webHandler.HandleUploadCreate))).Methods("POST")
+		router.Handle("/admin/uploads/{id}", authenticator.Middleware(http.HandlerFunc(webHandler.HandleUploadStatus))).Methods("GET")
+		router.Handle("/admin/uploads/{id}", authenticator.Middleware(http.HandlerFunc(webHandler.HandleUploadChunk))).Methods("PUT")
+		router.Handle("/admin/uploads/{id}", authenticator.Middleware(http.HandlerFunc(webHandler.HandleUploadAbort))).Methods("DELETE")
+		router.Handle("/admin/uploads/{id}/complete", authenticator.Middleware(http.HandlerFunc(webHandler.HandleUploadComplete))).Methods("POST")
+		router.Handle("/admin/trash/{serverName}", authenticator.Middleware(http.HandlerFunc(webHandler.TrashList))).Methods("GET")
+		router.Handle("/admin/trash/restore", authenticator.Middleware(http.HandlerFunc(webHandler.HandleTrashRestore))).Methods("POST")
+		router.Handle("/admin/trash/purge", authenticator.Middleware(http.HandlerFunc(webHandler.HandleTrashPurge))).Methods("POST")
+		router.Handle("/admin/quota/{serverName}", authenticator.Middleware(http.HandlerFunc(webHandler.QuotaPage))).Methods("GET")
+		router.Handle("/admin/quota", authenticator.Middleware(http.HandlerFunc(webHandler.HandleQuotaUpdate))).Methods("POST")
+		router.Handle("/admin/stats/{serverName}", authenticator.Middleware(http.HandlerFunc(webHandler.StatsPage))).Methods("GET")
+		router.Handle("/admin/releases/create", authenticator.Middleware(http.HandlerFunc(webHandler.HandleReleaseCreate))).Methods("POST")
 	} else {
 		// Register placeholder routes when OIDC is disabled to prevent them from matching /{serverName}
 		router.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
@@ -78,15 +113,28 @@ func main() {
 	router.HandleFunc("/api/servers", serverHandler.GetServers).Methods("GET")
 	router.HandleFunc("/api/servers/{serverName}/status", serverHandler.GetServerStatus).Methods("GET")
 	router.HandleFunc("/api/servers/{serverName}/mods", serverHandler.GetServerMods).Methods("GET")
+	router.HandleFunc("/api/servers/{serverName}/mods/icon", serverHandler.GetModIcon).Methods("GET")
+	router.HandleFunc("/api/servers/{serverName}/mods/check", serverHandler.GetModCompatibility).Methods("GET")
+	router.HandleFunc("/api/mods/diff", serverHandler.GetModDiff).Methods("GET")
+	router.HandleFunc("/api/servers/{serverName}/releases", serverHandler.GetReleases).Methods("GET")
+	router.HandleFunc("/api/servers/{serverName}/releases/{version}", serverHandler.GetRelease).Methods("GET")
 	router.PathPrefix("/{serverName}/map/").HandlerFunc(serverHandler.BlueMapProxy)     // BlueMap Proxy route
+	router.HandleFunc("/files/{serverName}/pack.mrpack", serverHandler.ServeMrpack).Methods("GET", "HEAD")
+	router.PathPrefix("/packwiz/{serverName}/").HandlerFunc(serverHandler.ServePackwiz).Methods("GET", "HEAD")
+	router.PathPrefix("/files/{serverName}/releases/").HandlerFunc(serverHandler.ServeReleaseFiles).Methods("GET", "HEAD")
 	router.PathPrefix("/files/{serverName}/mods/").Handler(http.HandlerFunc(serverHandler.ServeModFiles)) // Serve static mod files
 	router.PathPrefix("/assets/").Handler(http.HandlerFunc(webHandler.ServeAssets)) // Static Assets
 	
-	// Server Detail Page (catch-all for server names)
+	router.HandleFunc("/compare", webHandler.Compare).Methods("GET")
+
+	// Server Detail Page (catch-all for server names). Top-level paths
+	// registered above must be listed in reservedServerNames in web/handler.go.
 	router.HandleFunc("/{serverName}", webHandler.ServerDetail).Methods("GET")
+	router.HandleFunc("/{serverName}/releases", webHandler.ReleaseList).Methods("GET")
 
 	log.Printf("Starting server on :%s", cfg.Port)
 	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
+		serverHandler.Index.Close()
 		log.Fatalf("could not start server: %s\n", err)
 	}
 }
@@ -0,0 +1,235 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ZipOptions controls which files are included in a directory archive.
+type ZipOptions struct {
+	// SkipHelpers excludes the .md and .url files used for the file browser.
+	SkipHelpers bool
+	// Side limits the archive to files needed on that side (see SideIncludes).
+	// SideOf returns the side of a file given its path relative to the
+	// archived directory; Side is ignored if SideOf is nil.
+	Side   string
+	SideOf func(rel string) string
+	// Root is the server directory the archived directory is in. Files
+	// hidden by its sidecar files and those of the directories in between
+	// are left out. Defaults to the archived directory itself.
+	Root string
+}
+
+// key returns a short string identifying the options for cache keys.
+func (o ZipOptions) key() string {
+	key := "all"
+	if o.SkipHelpers {
+		key = "nohelpers"
+	}
+	if o.Side != "" && o.SideOf != nil {
+		key += ":" + o.Side
+	}
+	return key
+}
+
+// includes reports whether the file rel is selected by the side filter.
+func (o ZipOptions) includes(rel string) bool {
+	return o.SideOf == nil || SideIncludes(o.Side, o.SideOf(rel))
+}
+
+// isHelperFile reports whether name is a .md or .url file rendered by the browser.
+func isHelperFile(name string) bool {
+	return strings.HasSuffix(name, ".md") || strings.HasSuffix(name, ".url")
+}
+
+// walkArchiveFiles calls fn for every regular file below dir that should be
+// part of an archive, in lexical order. Symlinks are skipped so an archive
+// can never include files outside dir, and so are files hidden by the
+// sidecar files (see dirSettings.hidden).
+func walkArchiveFiles(dir string, opts ZipOptions, fn func(path, rel string, info fs.FileInfo) error) error {
+	root := opts.Root
+	if root == "" {
+		root = dir
+	}
+	base, err := settingsAt(root, dir)
+	if err != nil {
+		return err
+	}
+	settings := map[string]dirSettings{dir: base}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		parent := settings[filepath.Dir(path)]
+		if isTempFile(d.Name()) || parent.hidden(d.Name(), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			settings[path] = parent.enter(path, filepath.Join(parent.dir, d.Name()))
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if opts.SkipHelpers && isHelperFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !opts.includes(rel) {
+			return nil
+		}
+		return fn(path, rel, info)
+	})
+}
+
+// DirFingerprint returns a hash over the names, sizes and modification times
+// of all files that would be archived. It changes whenever the directory
+// contents change and is cheap compared to building the archive.
+func DirFingerprint(dir string, opts ZipOptions) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", opts.key())
+	err := walkArchiveFiles(dir, opts, func(_, rel string, info fs.FileInfo) error {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", rel, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// WriteZip streams a zip archive of dir to w.
+func WriteZip(w io.Writer, dir string, opts ZipOptions) error {
+	zw := zip.NewWriter(w)
+	err := walkArchiveFiles(dir, opts, func(_, rel string, _ fs.FileInfo) error {
+		return addZipFile(zw, dir, rel, rel)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// isCompressed reports whether a file is an archive format that does not
+// benefit from deflate.
+func isCompressed(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jar", ".zip", ".gz", ".xz", ".7z", ".png", ".jpg", ".jpeg", ".mrpack":
+		return true
+	}
+	return false
+}
+
+// ArchiveCache stores pre-built directory archives on disk. Archives are
+// named after their key and directory fingerprint, so a changed directory
+// simply misses the cache and the stale archive is replaced on next build.
+type ArchiveCache struct {
+	Dir string
+}
+
+// NewArchiveCache creates a cache rooted at dir. An empty dir disables caching.
+func NewArchiveCache(dir string) *ArchiveCache {
+	return &ArchiveCache{Dir: dir}
+}
+
+// Enabled reports whether archives are cached.
+func (c *ArchiveCache) Enabled() bool {
+	return c != nil && c.Dir != ""
+}
+
+// keyPrefix derives a file name prefix from the archive key.
+func (c *ArchiveCache) keyPrefix(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (c *ArchiveCache) path(key, fingerprint string) string {
+	return filepath.Join(c.Dir, c.keyPrefix(key)+"-"+fingerprint+".zip")
+}
+
+// Lookup returns the path of a cached archive for key, if one exists for
+// the given fingerprint.
+func (c *ArchiveCache) Lookup(key, fingerprint string) (string, bool) {
+	if !c.Enabled() {
+		return "", false
+	}
+	p := c.path(key, fingerprint)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// PendingArchive is an archive being written to the cache. It only becomes
+// visible to Lookup after Commit.
+type PendingArchive struct {
+	*os.File
+	cache       *ArchiveCache
+	key         string
+	fingerprint string
+}
+
+// Create starts writing a new cached archive for key and fingerprint.
+func (c *ArchiveCache) Create(key, fingerprint string) (*PendingArchive, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("archive cache disabled")
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(c.Dir, ".building-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	return &PendingArchive{File: f, cache: c, key: key, fingerprint: fingerprint}, nil
+}
+
+// Commit atomically moves the archive into place and removes older archives
+// for the same key.
+func (p *PendingArchive) Commit() error {
+	if err := p.File.Close(); err != nil {
+		os.Remove(p.Name())
+		return err
+	}
+	final := p.cache.path(p.key, p.fingerprint)
+	if err := os.Rename(p.Name(), final); err != nil {
+		os.Remove(p.Name())
+		return err
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(p.cache.Dir, p.cache.keyPrefix(p.key)+"-*.zip"))
+	for _, s := range stale {
+		if s != final {
+			os.Remove(s)
+		}
+	}
+	return nil
+}
+
+// Abort discards the partially written archive.
+func (p *PendingArchive) Abort() {
+	p.File.Close()
+	os.Remove(p.Name())
+}
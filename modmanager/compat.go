@@ -0,0 +1,337 @@
+package modmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severities of compatibility issues.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Kinds of compatibility issues.
+const (
+	IssueMissing      = "missing"      // a required mod is not present
+	IssueVersion      = "version"      // a required mod is present in an unsupported version
+	IssueIncompatible = "incompatible" // a mod breaks another present mod
+	IssueConflict     = "conflict"     // a mod discourages another present mod
+	IssueDuplicate    = "duplicate"    // several jars contain the same mod
+	IssueMinecraft    = "minecraft"    // the mod does not support the server's Minecraft version
+	IssueLoader       = "loader"       // the mod is for a different loader
+)
+
+// Environment is the Minecraft setup of a server that mods are checked against.
+// Empty fields are unknown and skip the respective checks.
+type Environment struct {
+	Minecraft     string `json:"minecraft,omitempty"`
+	Loader        string `json:"loader,omitempty"`
+	LoaderVersion string `json:"loaderVersion,omitempty"`
+}
+
+// environmentLoaders maps server metadata keys to loaders.
+var environmentLoaders = []struct{ key, loader string }{
+	{"fabric-loader", LoaderFabric},
+	{"quilt-loader", LoaderQuilt},
+	{"neoforge", LoaderNeoForge},
+	{"forge", LoaderForge},
+}
+
+// EnvironmentFromMetadata reads the environment from server metadata, using
+// the same keys as the modpack exports ("minecraft", "fabric-loader",
+// "quilt-loader", "forge", "neoforge"). Keys are matched case-insensitively.
+func EnvironmentFromMetadata(metadata map[string]string) Environment {
+	get := func(key string) string {
+		for k, v := range metadata {
+			if strings.EqualFold(k, key) {
+				return strings.TrimSpace(v)
+			}
+		}
+		return ""
+	}
+
+	env := Environment{Minecraft: get("minecraft")}
+	for _, l := range environmentLoaders {
+		if v := get(l.key); v != "" {
+			env.Loader, env.LoaderVersion = l.loader, v
+			break
+		}
+	}
+	return env
+}
+
+// loaderModIDs are the mod IDs under which each loader itself can be depended on.
+var loaderModIDs = map[string][]string{
+	LoaderFabric:   {"fabricloader"},
+	LoaderQuilt:    {"quilt_loader"},
+	LoaderForge:    {"forge"},
+	LoaderNeoForge: {"neoforge"},
+}
+
+// platformModIDs are dependencies that are never provided by mod jars.
+var platformModIDs = map[string]bool{
+	"minecraft":    true,
+	"java":         true,
+	"fabricloader": true,
+	"quilt_loader": true,
+	"forge":        true,
+	"neoforge":     true,
+	"javafml":      true,
+}
+
+// loaderCompatible reports whether mods built for modLoader run on
+// serverLoader. The second result marks combinations that only work in some
+// versions and are reported as warnings.
+func loaderCompatible(serverLoader, modLoader string) (ok, partial bool) {
+	switch {
+	case serverLoader == modLoader:
+		return true, false
+	case serverLoader == LoaderQuilt && modLoader == LoaderFabric:
+		return true, false
+	case serverLoader == LoaderForge && modLoader == LoaderLegacyForge:
+		return true, false
+	case serverLoader == LoaderNeoForge && modLoader == LoaderForge:
+		return true, true // NeoForge for 1.20.1 still loads Forge mods
+	}
+	return false, false
+}
+
+// Issue is a single problem found by CheckCompatibility.
+type Issue struct {
+	Kind     string   `json:"kind"`
+	Severity string   `json:"severity"`
+	ModID    string   `json:"modId,omitempty"`
+	ModName  string   `json:"modName,omitempty"`
+	Paths    []string `json:"paths"`            // slash-separated jar paths the issue concerns
+	Target   string   `json:"target,omitempty"` // the other mod or platform involved
+	Versions string   `json:"versions,omitempty"`
+	Found    string   `json:"found,omitempty"` // version of Target that is present
+	Message  string   `json:"message"`
+}
+
+// CompatibilityReport is the result of checking a server's mod set.
+type CompatibilityReport struct {
+	Environment Environment `json:"environment"`
+	Mods        int         `json:"mods"`
+	Errors      int         `json:"errors"`
+	Warnings    int         `json:"warnings"`
+	Issues      []Issue     `json:"issues"`
+}
+
+// IssuesFor returns the issues concerning the jar at path.
+func (r *CompatibilityReport) IssuesFor(path string) []Issue {
+	path = filepath.ToSlash(path)
+	var issues []Issue
+	for _, issue := range r.Issues {
+		for _, p := range issue.Paths {
+			if p == path {
+				issues = append(issues, issue)
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// installedMod is a jar with mod metadata found in the tree.
+type installedMod struct {
+	path string
+	meta *ModMetadata
+}
+
+// provider is a jar (or the platform, with an empty path) providing a mod ID.
+type provider struct {
+	path    string
+	version string
+}
+
+// CheckCompatibility resolves the declared dependencies, incompatibilities
+// and Minecraft/loader version ranges of all jars with mod metadata in the
+// tree against each other and the server environment. Files a side override
+// marks as not needed on the server are still checked, since clients load
+// them together with the rest of the pack.
+func CheckCompatibility(root *ModItem, env Environment) *CompatibilityReport {
+	report := &CompatibilityReport{Environment: env, Issues: []Issue{}}
+
+	var mods []installedMod
+	var collect func(item *ModItem)
+	collect = func(item *ModItem) {
+		if item.Type != TypeDir {
+			if item.Mod != nil && item.Mod.ModID != "" {
+				mods = append(mods, installedMod{path: filepath.ToSlash(item.Path), meta: item.Mod})
+			}
+			return
+		}
+		for i := range item.Children {
+			collect(&item.Children[i])
+		}
+	}
+	collect(root)
+	report.Mods = len(mods)
+
+	add := func(issue Issue) {
+		if issue.Severity == SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Index everything that can satisfy a dependency.
+	providers := make(map[string][]provider)
+	if env.Minecraft != "" {
+		providers["minecraft"] = []provider{{version: env.Minecraft}}
+	}
+	for _, id := range loaderModIDs[env.Loader] {
+		providers[id] = []provider{{version: env.LoaderVersion}}
+	}
+	if env.Loader == LoaderQuilt {
+		// Quilt provides Fabric Loader under its own compatibility version.
+		providers["fabricloader"] = []provider{{}}
+	}
+	byID := make(map[string][]installedMod)
+	for _, m := range mods {
+		byID[m.meta.ModID] = append(byID[m.meta.ModID], m)
+		providers[m.meta.ModID] = append(providers[m.meta.ModID], provider{path: m.path, version: m.meta.Version})
+		for id, version := range m.meta.Provides {
+			providers[id] = append(providers[id], provider{path: m.path, version: version})
+		}
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if dups := byID[id]; len(dups) > 1 {
+			issue := Issue{
+				Kind:     IssueDuplicate,
+				Severity: SeverityError,
+				ModID:    id,
+				ModName:  dups[0].meta.Name,
+				Message:  fmt.Sprintf("%s is installed %d times", dups[0].meta.Name, len(dups)),
+			}
+			for _, d := range dups {
+				issue.Paths = append(issue.Paths, d.path)
+			}
+			add(issue)
+		}
+	}
+
+	for _, m := range mods {
+		meta := m.meta
+		base := Issue{ModID: meta.ModID, ModName: meta.Name, Paths: []string{m.path}}
+
+		if env.Loader != "" {
+			if ok, partial := loaderCompatible(env.Loader, meta.Loader); !ok || partial {
+				issue := base
+				issue.Kind, issue.Target = IssueLoader, meta.Loader
+				if ok {
+					issue.Severity = SeverityWarning
+					issue.Message = fmt.Sprintf("%s is a %s mod and may not load on %s", meta.Name, meta.Loader, env.Loader)
+				} else {
+					issue.Severity = SeverityError
+					issue.Message = fmt.Sprintf("%s is a %s mod, but the server runs %s", meta.Name, meta.Loader, env.Loader)
+				}
+				add(issue)
+			}
+		}
+
+		// Legacy mods declare a single Minecraft version instead of a dependency.
+		if meta.Loader == LoaderLegacyForge && env.Minecraft != "" && meta.MinecraftVersion != "" && meta.MinecraftVersion != env.Minecraft {
+			issue := base
+			issue.Kind, issue.Severity, issue.Target = IssueMinecraft, SeverityError, "minecraft"
+			issue.Versions, issue.Found = meta.MinecraftVersion, env.Minecraft
+			issue.Message = fmt.Sprintf("%s is for Minecraft %s, the server runs %s", meta.Name, meta.MinecraftVersion, env.Minecraft)
+			add(issue)
+		}
+
+		for _, dep := range meta.Dependencies {
+			if dep.ModID == meta.ModID || dep.ModID == "java" {
+				continue
+			}
+			found := providers[dep.ModID]
+
+			switch dep.Kind {
+			case DependencyRequired:
+				if len(found) == 0 {
+					if platformModIDs[dep.ModID] {
+						continue // unknown environment, or the loader check already reports it
+					}
+					issue := base
+					issue.Kind, issue.Severity, issue.Target, issue.Versions = IssueMissing, SeverityError, dep.ModID, dep.Versions
+					issue.Message = fmt.Sprintf("%s requires %s%s, which is not installed", meta.Name, dep.ModID, versionSuffix(dep.Versions))
+					add(issue)
+					continue
+				}
+				if ok, p := anyVersionMatches(meta.Loader, dep.Versions, found); !ok {
+					issue := base
+					issue.Target, issue.Versions, issue.Found = dep.ModID, dep.Versions, p.version
+					issue.Kind, issue.Severity = IssueVersion, SeverityError
+					if dep.ModID == "minecraft" {
+						issue.Kind = IssueMinecraft
+						issue.Message = fmt.Sprintf("%s supports Minecraft %s, the server runs %s", meta.Name, dep.Versions, p.version)
+					} else {
+						issue.Message = fmt.Sprintf("%s requires %s %s, found %s", meta.Name, dep.ModID, dep.Versions, p.version)
+					}
+					if p.path != "" {
+						issue.Paths = append(issue.Paths, p.path)
+					}
+					add(issue)
+				}
+
+			case DependencyIncompatible, DependencyConflict:
+				for _, p := range found {
+					if p.path == m.path {
+						continue
+					}
+					if match, ok := VersionMatches(meta.Loader, dep.Versions, p.version); ok && !match {
+						continue
+					}
+					issue := base
+					issue.Target, issue.Versions, issue.Found = dep.ModID, dep.Versions, p.version
+					if dep.Kind == DependencyIncompatible {
+						issue.Kind, issue.Severity = IssueIncompatible, SeverityError
+						issue.Message = fmt.Sprintf("%s is incompatible with %s%s", meta.Name, dep.ModID, versionSuffix(p.version))
+					} else {
+						issue.Kind, issue.Severity = IssueConflict, SeverityWarning
+						issue.Message = fmt.Sprintf("%s should not be used together with %s%s", meta.Name, dep.ModID, versionSuffix(p.version))
+					}
+					if p.path != "" {
+						issue.Paths = append(issue.Paths, p.path)
+					}
+					add(issue)
+				}
+			}
+		}
+	}
+	return report
+}
+
+// anyVersionMatches reports whether one of the providers satisfies the
+// range. Versions that cannot be interpreted count as satisfied. Otherwise
+// the first provider is returned for the report.
+func anyVersionMatches(loader, versionRange string, found []provider) (bool, provider) {
+	for _, p := range found {
+		if p.version == "" {
+			return true, p
+		}
+		if match, ok := VersionMatches(loader, versionRange, p.version); match || !ok {
+			return true, p
+		}
+	}
+	return false, found[0]
+}
+
+// versionSuffix formats an optional version for messages.
+func versionSuffix(v string) string {
+	if v == "" || v == "*" {
+		return ""
+	}
+	return " " + v
+}
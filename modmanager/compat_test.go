@@ -0,0 +1,251 @@
+package modmanager
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		loader    string
+		rng       string
+		version   string
+		wantMatch bool
+		wantOK    bool
+	}{
+		// Anything
+		{LoaderFabric, "", "1.20.1", true, true},
+		{LoaderFabric, "*", "1.20.1", true, true},
+		{LoaderFabric, "${minecraft_version}", "1.20.1", true, true},
+		{LoaderForge, "${mc_version}", "1.20.1", true, true},
+
+		// Fabric semantic version predicates
+		{LoaderFabric, "1.20.1", "1.20.1", true, true},
+		{LoaderFabric, "=1.20.1", "1.20.2", false, true},
+		{LoaderFabric, ">=1.20", "1.20.1", true, true},
+		{LoaderFabric, ">=1.20 <1.21", "1.21", false, true},
+		{LoaderFabric, ">=1.20 <1.21", "1.20.6", true, true},
+		{LoaderFabric, ">1.20", "1.20", false, true},
+		{LoaderFabric, "<=1.20", "1.20.0", true, true},
+		{LoaderFabric, "~1.20.1", "1.20.4", true, true},
+		{LoaderFabric, "~1.20.1", "1.21", false, true},
+		{LoaderFabric, "~1.20.1", "1.20", false, true},
+		{LoaderFabric, "^1.20", "1.99", true, true},
+		{LoaderFabric, "^1.20", "2.0", false, true},
+		{LoaderFabric, "1.20.x", "1.20.4", true, true},
+		{LoaderFabric, "1.20.x", "1.21", false, true},
+		{LoaderFabric, "1.20.X", "1.20", true, true},
+		{LoaderFabric, "1.19.4 || 1.20.x", "1.20.1", true, true},
+		{LoaderFabric, "1.19.4 || 1.20.x", "1.19.3", false, true},
+		{LoaderQuilt, ">=0.15", "0.15.11+build.1", true, true},
+		{LoaderFabric, ">=1.21", "1.21-pre1", false, true},
+		{LoaderFabric, ">=1.21-pre1", "1.21", true, true},
+		{LoaderFabric, ">=1.21-pre1", "1.21-pre2", true, true},
+		{LoaderFabric, ">=1.21-pre.10", "1.21-pre.9", false, true},
+
+		// Forge Maven ranges
+		{LoaderForge, "[1.20,1.21)", "1.20.1", true, true},
+		{LoaderForge, "[1.20,1.21)", "1.21", false, true},
+		{LoaderForge, "[1.20,1.21]", "1.21", true, true},
+		{LoaderForge, "(1.20,1.21)", "1.20", false, true},
+		{LoaderForge, "[47,)", "47.2.0", true, true},
+		{LoaderForge, "[47,)", "46.0.14", false, true},
+		{LoaderForge, "(,1.20]", "1.19.2", true, true},
+		{LoaderForge, "[1.20.1]", "1.20.1", true, true},
+		{LoaderForge, "[1.20.1]", "1.20.2", false, true},
+		{LoaderNeoForge, "[1.0,2.0),[3.0,)", "3.1", true, true},
+		{LoaderNeoForge, "[1.0,2.0),[3.0,)", "2.5", false, true},
+		{LoaderNeoForge, "[1.20, 1.21)", "1.20.4", true, true},
+		{LoaderLegacyForge, "1.12.2", "1.7.10", true, true}, // recommendation only
+
+		// Unknown versions and ranges are not reported
+		{LoaderFabric, ">=1.20", "23w13a", false, false},
+		{LoaderFabric, "<1.20", "23w13a", false, false},
+		{LoaderForge, "[1.20,)", "24w14a", false, false},
+		{LoaderFabric, ">=1.20", "", false, false},
+		{LoaderFabric, ">=abc", "1.20", false, false},
+		{LoaderForge, "[1.20,1.21", "1.20", false, false},
+		{LoaderForge, "[abc,)", "1.20", false, false},
+	}
+	for _, tt := range tests {
+		match, ok := VersionMatches(tt.loader, tt.rng, tt.version)
+		if match != tt.wantMatch || ok != tt.wantOK {
+			t.Errorf("VersionMatches(%s, %q, %q) = %t, %t, want %t, %t", tt.loader, tt.rng, tt.version, match, ok, tt.wantMatch, tt.wantOK)
+		}
+	}
+}
+
+func TestEnvironmentFromMetadata(t *testing.T) {
+	tests := []struct {
+		metadata map[string]string
+		want     Environment
+	}{
+		{nil, Environment{}},
+		{map[string]string{"minecraft": "1.20.1"}, Environment{Minecraft: "1.20.1"}},
+		{map[string]string{"Minecraft": " 1.20.1 ", "Fabric-Loader": "0.15.11"}, Environment{Minecraft: "1.20.1", Loader: LoaderFabric, LoaderVersion: "0.15.11"}},
+		{map[string]string{"minecraft": "1.20.1", "neoforge": "47.1.0"}, Environment{Minecraft: "1.20.1", Loader: LoaderNeoForge, LoaderVersion: "47.1.0"}},
+	}
+	for _, tt := range tests {
+		if got := EnvironmentFromMetadata(tt.metadata); got != tt.want {
+			t.Errorf("EnvironmentFromMetadata(%v) = %+v, want %+v", tt.metadata, got, tt.want)
+		}
+	}
+}
+
+// modJar returns a file item for a jar with the given metadata.
+func modJar(path string, meta ModMetadata) ModItem {
+	return ModItem{Name: path, Path: path, Type: TypeFile, Mod: &meta}
+}
+
+func fabricMod(id, version string, deps ...Dependency) ModMetadata {
+	return ModMetadata{ModID: id, Name: id, Version: version, Loader: LoaderFabric, Dependencies: deps}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	fabric := Environment{Minecraft: "1.20.1", Loader: LoaderFabric, LoaderVersion: "0.15.11"}
+	requires := func(id, versions string) Dependency {
+		return Dependency{ModID: id, Kind: DependencyRequired, Versions: versions}
+	}
+
+	tests := []struct {
+		name   string
+		env    Environment
+		jars   []ModItem
+		issues []string // kind:modId:target, sorted
+	}{
+		{
+			name: "compatible",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/api.jar", fabricMod("fabric-api", "0.92.0", requires("minecraft", "~1.20.1"), requires("fabricloader", ">=0.14"))),
+				modJar("mods/sodium.jar", fabricMod("sodium", "0.5.8", requires("fabric-api", "*"), requires("minecraft", "1.20.x"))),
+			},
+		},
+		{
+			name:   "missing dependency",
+			env:    fabric,
+			jars:   []ModItem{modJar("mods/sodium.jar", fabricMod("sodium", "0.5.8", requires("fabric-api", "*")))},
+			issues: []string{"missing:sodium:fabric-api"},
+		},
+		{
+			name: "optional dependency",
+			env:  fabric,
+			jars: []ModItem{modJar("mods/a.jar", fabricMod("a", "1", Dependency{ModID: "b", Kind: DependencyOptional}))},
+		},
+		{
+			name: "dependency version",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/api.jar", fabricMod("fabric-api", "0.80.0")),
+				modJar("mods/sodium.jar", fabricMod("sodium", "0.5.8", requires("fabric-api", ">=0.90"))),
+			},
+			issues: []string{"version:sodium:fabric-api"},
+		},
+		{
+			name:   "minecraft version",
+			env:    fabric,
+			jars:   []ModItem{modJar("mods/a.jar", fabricMod("a", "1", requires("minecraft", ">=1.21")))},
+			issues: []string{"minecraft:a:minecraft"},
+		},
+		{
+			name: "unknown environment skips platform checks",
+			env:  Environment{},
+			jars: []ModItem{modJar("mods/a.jar", fabricMod("a", "1", requires("minecraft", ">=1.21"), requires("fabricloader", ">=0.16")))},
+		},
+		{
+			name: "provided by another jar",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/bundle.jar", ModMetadata{ModID: "bundle", Name: "bundle", Version: "1", Loader: LoaderFabric, Provides: map[string]string{"cloth-config": "11.1.0"}}),
+				modJar("mods/a.jar", fabricMod("a", "1", requires("cloth-config", ">=11"))),
+			},
+		},
+		{
+			name: "duplicate",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/a-1.jar", fabricMod("a", "1")),
+				modJar("mods/a-2.jar", fabricMod("a", "2")),
+			},
+			issues: []string{"duplicate:a:"},
+		},
+		{
+			name:   "wrong loader",
+			env:    fabric,
+			jars:   []ModItem{modJar("mods/a.jar", ModMetadata{ModID: "a", Name: "a", Version: "1", Loader: LoaderForge})},
+			issues: []string{"loader:a:forge"},
+		},
+		{
+			name: "fabric mod on quilt",
+			env:  Environment{Minecraft: "1.20.1", Loader: LoaderQuilt, LoaderVersion: "0.25.0"},
+			jars: []ModItem{modJar("mods/a.jar", fabricMod("a", "1", requires("fabricloader", ">=0.14")))},
+		},
+		{
+			name:   "forge mod on neoforge",
+			env:    Environment{Minecraft: "1.20.1", Loader: LoaderNeoForge, LoaderVersion: "47.1.0"},
+			jars:   []ModItem{modJar("mods/a.jar", ModMetadata{ModID: "a", Name: "a", Version: "1", Loader: LoaderForge})},
+			issues: []string{"loader:a:forge"},
+		},
+		{
+			name: "incompatible in range",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/a.jar", fabricMod("a", "1", Dependency{ModID: "b", Kind: DependencyIncompatible, Versions: "<2"})),
+				modJar("mods/b.jar", fabricMod("b", "1.5")),
+			},
+			issues: []string{"incompatible:a:b"},
+		},
+		{
+			name: "incompatible out of range",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/a.jar", fabricMod("a", "1", Dependency{ModID: "b", Kind: DependencyIncompatible, Versions: "<2"})),
+				modJar("mods/b.jar", fabricMod("b", "2.1")),
+			},
+		},
+		{
+			name: "conflict",
+			env:  fabric,
+			jars: []ModItem{
+				modJar("mods/a.jar", fabricMod("a", "1", Dependency{ModID: "b", Kind: DependencyConflict})),
+				modJar("mods/b.jar", fabricMod("b", "1")),
+			},
+			issues: []string{"conflict:a:b"},
+		},
+		{
+			name:   "legacy forge minecraft version",
+			env:    Environment{Minecraft: "1.12.2", Loader: LoaderForge},
+			jars:   []ModItem{modJar("mods/old.jar", ModMetadata{ModID: "old", Name: "old", Loader: LoaderLegacyForge, MinecraftVersion: "1.7.10"})},
+			issues: []string{"minecraft:old:minecraft"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &ModItem{Type: TypeDir, Children: []ModItem{{Name: "mods", Path: "mods", Type: TypeDir, Children: tt.jars}}}
+			report := CheckCompatibility(root, tt.env)
+
+			var issues []string
+			errors, warnings := 0, 0
+			for _, issue := range report.Issues {
+				issues = append(issues, issue.Kind+":"+issue.ModID+":"+issue.Target)
+				if issue.Severity == SeverityError {
+					errors++
+				} else {
+					warnings++
+				}
+				if issue.Message == "" || len(issue.Paths) == 0 {
+					t.Errorf("issue without message or paths: %+v", issue)
+				}
+			}
+			sort.Strings(issues)
+			if !reflect.DeepEqual(issues, tt.issues) {
+				t.Errorf("issues = %q, want %q", issues, tt.issues)
+			}
+			if report.Mods != len(tt.jars) || report.Errors != errors || report.Warnings != warnings {
+				t.Errorf("report counts %d mods, %d errors, %d warnings; want %d, %d, %d",
+					report.Mods, report.Errors, report.Warnings, len(tt.jars), errors, warnings)
+			}
+		})
+	}
+}
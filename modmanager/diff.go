@@ -0,0 +1,121 @@
+package modmanager
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// ModSetEntry is a mod found in a server directory or release.
+type ModSetEntry struct {
+	ModID   string `json:"modId"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path"` // slash-separated jar path
+}
+
+// ModSetFromTree collects the jars with mod metadata in a scanned tree.
+func ModSetFromTree(root *ModItem) []ModSetEntry {
+	var mods []ModSetEntry
+	var walk func(item *ModItem)
+	walk = func(item *ModItem) {
+		if item.Type != TypeDir {
+			if item.Mod != nil && item.Mod.ModID != "" {
+				mods = append(mods, ModSetEntry{ModID: item.Mod.ModID, Name: item.Mod.Name, Version: item.Mod.Version, Path: filepath.ToSlash(item.Path)})
+			}
+			return
+		}
+		for i := range item.Children {
+			walk(&item.Children[i])
+		}
+	}
+	walk(root)
+	return mods
+}
+
+// ModSetFromSnapshot collects the files of a release that carry mod metadata.
+func ModSetFromSnapshot(files []SnapshotFile) []ModSetEntry {
+	var mods []ModSetEntry
+	for _, f := range files {
+		if f.ModID != "" {
+			mods = append(mods, ModSetEntry{ModID: f.ModID, Name: f.ModName, Version: f.ModVersion, Path: f.Path})
+		}
+	}
+	return mods
+}
+
+// ModVersionDiff is a mod present in both sets in different versions.
+type ModVersionDiff struct {
+	ModID string      `json:"modId"`
+	Name  string      `json:"name"`
+	A     ModSetEntry `json:"a"`
+	B     ModSetEntry `json:"b"`
+	// Newer is "a" or "b" for the side with the higher version, or empty if
+	// the versions cannot be compared.
+	Newer string `json:"newer,omitempty"`
+}
+
+// ModDiff is the result of comparing two mod sets by mod ID.
+type ModDiff struct {
+	OnlyA   []ModSetEntry    `json:"onlyA"`
+	OnlyB   []ModSetEntry    `json:"onlyB"`
+	Changed []ModVersionDiff `json:"changed"`
+	Same    []ModSetEntry    `json:"same"`
+}
+
+// DiffModSets compares two mod sets by mod ID rather than file name, so a
+// jar renamed between servers still counts as the same mod. If a set
+// contains a mod ID more than once, the first occurrence is used.
+func DiffModSets(a, b []ModSetEntry) *ModDiff {
+	d := &ModDiff{OnlyA: []ModSetEntry{}, OnlyB: []ModSetEntry{}, Changed: []ModVersionDiff{}, Same: []ModSetEntry{}}
+
+	inB := make(map[string]ModSetEntry, len(b))
+	for _, m := range b {
+		if _, ok := inB[m.ModID]; !ok {
+			inB[m.ModID] = m
+		}
+	}
+	seen := make(map[string]bool, len(a))
+
+	for _, ma := range a {
+		if seen[ma.ModID] {
+			continue
+		}
+		seen[ma.ModID] = true
+
+		mb, ok := inB[ma.ModID]
+		switch {
+		case !ok:
+			d.OnlyA = append(d.OnlyA, ma)
+		case ma.Version == mb.Version:
+			d.Same = append(d.Same, ma)
+		default:
+			change := ModVersionDiff{ModID: ma.ModID, Name: ma.Name, A: ma, B: mb}
+			va, okA := parseVersion(ma.Version)
+			vb, okB := parseVersion(mb.Version)
+			if okA && okB {
+				switch va.compare(vb) {
+				case 1:
+					change.Newer = "a"
+				case -1:
+					change.Newer = "b"
+				}
+			}
+			d.Changed = append(d.Changed, change)
+		}
+	}
+	for _, mb := range b {
+		if !seen[mb.ModID] {
+			seen[mb.ModID] = true
+			d.OnlyB = append(d.OnlyB, mb)
+		}
+	}
+
+	byName := func(entries []ModSetEntry) {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+	byName(d.OnlyA)
+	byName(d.OnlyB)
+	byName(d.Same)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+	return d
+}
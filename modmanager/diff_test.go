@@ -0,0 +1,119 @@
+package modmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffModSets(t *testing.T) {
+	mod := func(id, version, path string) ModSetEntry {
+		return ModSetEntry{ModID: id, Name: id, Version: version, Path: path}
+	}
+
+	tests := []struct {
+		name    string
+		a, b    []ModSetEntry
+		onlyA   []string
+		onlyB   []string
+		same    []string
+		changed []string // modId:newer
+	}{
+		{name: "empty"},
+		{
+			name: "identical",
+			a:    []ModSetEntry{mod("sodium", "0.5.8", "mods/sodium.jar")},
+			b:    []ModSetEntry{mod("sodium", "0.5.8", "mods/sodium.jar")},
+			same: []string{"sodium"},
+		},
+		{
+			name: "renamed jar is the same mod",
+			a:    []ModSetEntry{mod("sodium", "0.5.8", "mods/sodium.jar")},
+			b:    []ModSetEntry{mod("sodium", "0.5.8", "mods/sodium-fabric-0.5.8.jar")},
+			same: []string{"sodium"},
+		},
+		{
+			name:  "only on one side",
+			a:     []ModSetEntry{mod("iris", "1.7", "mods/iris.jar"), mod("sodium", "0.5.8", "mods/sodium.jar")},
+			b:     []ModSetEntry{mod("lithium", "0.11", "mods/lithium.jar"), mod("sodium", "0.5.8", "mods/sodium.jar")},
+			onlyA: []string{"iris"},
+			onlyB: []string{"lithium"},
+			same:  []string{"sodium"},
+		},
+		{
+			name: "versions compared numerically",
+			a: []ModSetEntry{
+				mod("a", "1.10.0", "a.jar"),
+				mod("b", "0.5.8", "b.jar"),
+				mod("c", "1.0-beta", "c.jar"),
+				mod("d", "snapshot", "d.jar"),
+			},
+			b: []ModSetEntry{
+				mod("a", "1.9.2", "a.jar"),
+				mod("b", "0.6.0+mc1.21", "b.jar"),
+				mod("c", "1.0", "c.jar"),
+				mod("d", "1.0", "d.jar"),
+			},
+			changed: []string{"a:a", "b:b", "c:b", "d:"},
+		},
+		{
+			name:  "first occurrence of duplicates counts",
+			a:     []ModSetEntry{mod("a", "1", "a-1.jar"), mod("a", "2", "a-2.jar")},
+			b:     []ModSetEntry{mod("a", "1", "a.jar"), mod("b", "1", "b.jar"), mod("b", "2", "b-2.jar")},
+			onlyB: []string{"b"},
+			same:  []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DiffModSets(tt.a, tt.b)
+			ids := func(entries []ModSetEntry) []string {
+				var out []string
+				for _, e := range entries {
+					out = append(out, e.ModID)
+				}
+				return out
+			}
+			var changed []string
+			for _, c := range d.Changed {
+				changed = append(changed, c.ModID+":"+c.Newer)
+				if c.A.Version == c.B.Version {
+					t.Errorf("%s listed as changed with equal versions", c.ModID)
+				}
+			}
+			if got := ids(d.OnlyA); !reflect.DeepEqual(got, tt.onlyA) {
+				t.Errorf("onlyA = %q, want %q", got, tt.onlyA)
+			}
+			if got := ids(d.OnlyB); !reflect.DeepEqual(got, tt.onlyB) {
+				t.Errorf("onlyB = %q, want %q", got, tt.onlyB)
+			}
+			if got := ids(d.Same); !reflect.DeepEqual(got, tt.same) {
+				t.Errorf("same = %q, want %q", got, tt.same)
+			}
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed = %q, want %q", changed, tt.changed)
+			}
+			if d.OnlyA == nil || d.OnlyB == nil || d.Same == nil || d.Changed == nil {
+				t.Error("empty lists must not be nil, they are encoded as JSON arrays")
+			}
+		})
+	}
+}
+
+func TestModSetFromTree(t *testing.T) {
+	root := &ModItem{Type: TypeDir, Children: []ModItem{
+		{Type: TypeDir, Path: "mods", Children: []ModItem{
+			{Type: TypeFile, Path: "mods/a.jar", Mod: &ModMetadata{ModID: "a", Name: "A", Version: "1"}},
+			{Type: TypeFile, Path: "mods/broken.jar", Mod: &ModMetadata{Name: "no id"}},
+			{Type: TypeFile, Path: "mods/readme.txt"},
+		}},
+	}}
+	want := []ModSetEntry{{ModID: "a", Name: "A", Version: "1", Path: "mods/a.jar"}}
+	if got := ModSetFromTree(root); !reflect.DeepEqual(got, want) {
+		t.Errorf("ModSetFromTree() = %+v, want %+v", got, want)
+	}
+
+	files := []SnapshotFile{{Path: "mods/a.jar", ModID: "a", ModName: "A", ModVersion: "1"}, {Path: "config/a.toml"}}
+	if got := ModSetFromSnapshot(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("ModSetFromSnapshot() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package modmanager
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ZipDownloadPath returns the path downloads of the zip of dir are counted
+// under: the directory path with a trailing slash, "/" for the root.
+func ZipDownloadPath(dir string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(dir)), "/") + "/"
+}
+
+// CountDownloads returns a copy of the tree with the download counts, keyed
+// by slash-separated path as recorded, filled in.
+func CountDownloads(root *ModItem, counts map[string]int) *ModItem {
+	item := *root
+	if item.Type != TypeDir {
+		item.Downloads = counts[filepath.ToSlash(item.Path)]
+		return &item
+	}
+	item.Downloads = counts[ZipDownloadPath(item.Path)]
+	item.Children = make([]ModItem, 0, len(root.Children))
+	for i := range root.Children {
+		item.Children = append(item.Children, *CountDownloads(&root.Children[i], counts))
+	}
+	return &item
+}
@@ -0,0 +1,300 @@
+package modmanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrExtractLimit is returned when an archive exceeds the extraction limits.
+var ErrExtractLimit = errors.New("archive exceeds extraction limits")
+
+// ExtractLimits bounds what a single archive may unpack to, as protection
+// against zip bombs. Zero values disable the respective limit.
+type ExtractLimits struct {
+	MaxFiles     int   // files and directories
+	MaxTotalSize int64 // uncompressed bytes of all files
+	MaxFileSize  int64 // uncompressed bytes of a single file
+	// CheckFile, if set, is asked about every file before it is written,
+	// with its base name and declared size. Refused files are skipped and
+	// do not count against the limits.
+	CheckFile func(name string, size int64) error
+}
+
+// ExtractedFile is a file written by ExtractArchive.
+type ExtractedFile struct {
+	Path    string `json:"path"` // slash-separated, relative to the target directory
+	Size    int64  `json:"size"`
+	Renamed bool   `json:"renamed,omitempty"`
+}
+
+// SkippedEntry is an archive entry that was not extracted.
+type SkippedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ExtractReport lists the outcome of extracting an archive.
+type ExtractReport struct {
+	Extracted []ExtractedFile `json:"extracted"`
+	Skipped   []SkippedEntry  `json:"skipped"`
+	Dirs      int             `json:"dirs"`
+	TotalSize int64           `json:"totalSize"`
+}
+
+// IsExtractable reports whether name has an archive extension ExtractArchive supports.
+func IsExtractable(name string) bool {
+	return archiveFormat(name) != ""
+}
+
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// archiveEntryPath cleans the name of an archive entry. It reports false for
+// names that would escape the target directory (zip-slip), such as absolute
+// paths or ".." components.
+func archiveEntryPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/") // archives created on Windows
+	if strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", true
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if isTempFile(part) {
+			return "", false
+		}
+	}
+	return clean, true
+}
+
+// archiveEntry is a single entry of an archive being extracted.
+type archiveEntry struct {
+	name  string
+	mode  os.FileMode
+	size  int64 // declared uncompressed size
+	open  func() (io.ReadCloser, error)
+	isDir bool
+}
+
+// ExtractArchive unpacks a .zip or .tar.gz archive named name, read from r
+// of the given size, into destDir. Entries escaping destDir, symlinks and
+// other special files are skipped and reported. Existing files are handled
+// according to the conflict policy; with ConflictFail they are skipped.
+//
+// The declared sizes and the number of entries are checked against the
+// limits before anything is written, and the actual uncompressed data is
+// counted while extracting, so archives lying about their sizes are caught
+// as well. Every file is written atomically.
+func ExtractArchive(r io.ReaderAt, size int64, name, destDir, policy string, limits ExtractLimits) (*ExtractReport, error) {
+	var walk func(fn func(archiveEntry) error) error
+	switch archiveFormat(name) {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		walk = func(fn func(archiveEntry) error) error {
+			for _, f := range zr.File {
+				f := f
+				e := archiveEntry{name: f.Name, mode: f.Mode(), size: int64(f.UncompressedSize64), open: f.Open, isDir: f.FileInfo().IsDir()}
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case "tar.gz":
+		walk = func(fn func(archiveEntry) error) error {
+			gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+			if err != nil {
+				return fmt.Errorf("invalid gzip archive: %w", err)
+			}
+			defer gz.Close()
+			tr := tar.NewReader(gz)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("invalid tar archive: %w", err)
+				}
+				e := archiveEntry{name: hdr.Name, mode: hdr.FileInfo().Mode(), size: hdr.Size, isDir: hdr.Typeflag == tar.TypeDir}
+				if hdr.Typeflag == tar.TypeReg {
+					e.open = func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+				}
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", name)
+	}
+
+	// First pass: check the declared sizes against the limits.
+	entries, total := 0, int64(0)
+	err := walk(func(e archiveEntry) error {
+		if !e.isDir && !e.mode.IsRegular() {
+			return nil
+		}
+		if !e.isDir && limits.checkFile(path.Base(e.name), e.size) != nil {
+			return nil
+		}
+		entries++
+		total += e.size
+		if limits.MaxFiles > 0 && entries > limits.MaxFiles {
+			return fmt.Errorf("%w: more than %d files and directories", ErrExtractLimit, limits.MaxFiles)
+		}
+		if limits.MaxTotalSize > 0 && total > limits.MaxTotalSize {
+			return fmt.Errorf("%w: more than %d bytes uncompressed", ErrExtractLimit, limits.MaxTotalSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Second pass: extract, counting the bytes actually produced.
+	report := &ExtractReport{Extracted: []ExtractedFile{}, Skipped: []SkippedEntry{}}
+	budget := limits.MaxTotalSize
+	err = walk(func(e archiveEntry) error {
+		rel, ok := archiveEntryPath(e.name)
+		switch {
+		case !ok:
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: e.name, Reason: "unsafe path"})
+			return nil
+		case rel == "":
+			return nil
+		case e.isDir:
+			// Counted like files, so archives cannot create unlimited directories.
+			if limits.MaxFiles > 0 && len(report.Extracted)+report.Dirs >= limits.MaxFiles {
+				return fmt.Errorf("%w: more than %d files and directories", ErrExtractLimit, limits.MaxFiles)
+			}
+			if err := os.MkdirAll(filepath.Join(destDir, filepath.FromSlash(rel)), 0755); err != nil {
+				return err
+			}
+			report.Dirs++
+			return nil
+		case e.mode&os.ModeSymlink != 0:
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: "symlink"})
+			return nil
+		case !e.mode.IsRegular() || e.open == nil:
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: "not a regular file"})
+			return nil
+		}
+
+		if err := limits.checkFile(path.Base(rel), e.size); err != nil {
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: err.Error()})
+			return nil
+		}
+		if limits.MaxFiles > 0 && len(report.Extracted)+report.Dirs >= limits.MaxFiles {
+			return fmt.Errorf("%w: more than %d files and directories", ErrExtractLimit, limits.MaxFiles)
+		}
+
+		dest := filepath.Join(destDir, filepath.FromSlash(rel))
+		if info, err := os.Lstat(filepath.Dir(dest)); err == nil && !info.IsDir() {
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: "parent is not a directory"})
+			return nil
+		}
+
+		rc, err := e.open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		defer rc.Close()
+		// Sizes are counted as the data is read, the declared ones may lie.
+		var src io.Reader = rc
+		if limits.MaxTotalSize > 0 {
+			src = &limitedReader{r: src, remaining: budget,
+				err: fmt.Errorf("%w: uncompressed data larger than declared", ErrExtractLimit)}
+		}
+		if limits.MaxFileSize > 0 {
+			src = &limitedReader{r: src, remaining: limits.MaxFileSize,
+				err: fmt.Errorf("%w: %s is larger than %s", ErrFileTooLarge, path.Base(rel), FormatBytes(limits.MaxFileSize))}
+		}
+
+		res, err := WriteFileAtomic(dest, src, policy)
+		var conflict *ConflictError
+		switch {
+		case errors.As(err, &conflict):
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: "already exists"})
+			return nil
+		case errors.Is(err, ErrFileTooLarge):
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: err.Error()})
+			return nil
+		case err != nil:
+			return fmt.Errorf("%s: %w", rel, err)
+		case res.Skipped:
+			report.Skipped = append(report.Skipped, SkippedEntry{Path: rel, Reason: "already exists"})
+			return nil
+		}
+
+		budget -= res.Size
+		report.TotalSize += res.Size
+		final, _ := filepath.Rel(destDir, res.Path)
+		report.Extracted = append(report.Extracted, ExtractedFile{Path: filepath.ToSlash(final), Size: res.Size, Renamed: res.Renamed})
+		return nil
+	})
+	return report, err
+}
+
+// checkFile checks a file's declared size against MaxFileSize and asks
+// CheckFile about it.
+func (l ExtractLimits) checkFile(name string, size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return fmt.Errorf("%w: %s is larger than %s", ErrFileTooLarge, name, FormatBytes(l.MaxFileSize))
+	}
+	if l.CheckFile != nil {
+		return l.CheckFile(name, size)
+	}
+	return nil
+}
+
+// limitedReader fails with err once more than remaining bytes have been
+// read, unlike io.LimitReader which silently truncates.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Allow a clean EOF right at the limit.
+		var one [1]byte
+		if n, _ := l.r.Read(one[:]); n == 0 {
+			return 0, io.EOF
+		}
+		return 0, l.err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,366 @@
+package modmanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEntryPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"mods/a.jar", "mods/a.jar", true},
+		{"./mods/a.jar", "mods/a.jar", true},
+		{"mods/./a.jar", "mods/a.jar", true},
+		{"mods/", "mods", true},
+		{`config\a.toml`, "config/a.toml", true},
+		{"mods/..a.jar", "mods/..a.jar", true},
+		{".", "", true},
+		{"./", "", true},
+
+		// Zip-slip
+		{"../evil.txt", "", false},
+		{"mods/../../evil.txt", "", false},
+		{"mods/../a.txt", "", false},
+		{"..", "", false},
+		{`..\evil.txt`, "", false},
+		{`mods\..\..\evil.txt`, "", false},
+		{"/etc/passwd", "", false},
+		{`\evil.txt`, "", false},
+		{"C:/Windows/evil.txt", "", false},
+		{`C:\Windows\evil.txt`, "", false},
+		{"a\x00b.txt", "", false},
+
+		// Names reserved for unfinished writes
+		{".upload-123", "", false},
+		{"mods/.upload-123/a.jar", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := archiveEntryPath(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("archiveEntryPath(%q) = %q, %t, want %q, %t", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// testEntry is an entry of an archive built by a test.
+type testEntry struct {
+	name    string
+	body    string
+	dir     bool
+	symlink bool // body is the link target
+}
+
+func buildZip(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		switch {
+		case e.dir:
+			hdr.SetMode(os.ModeDir | 0755)
+		case e.symlink:
+			hdr.SetMode(os.ModeSymlink | 0777)
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.dir:
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case e.symlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.body, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	refuseExe := func(name string, size int64) error {
+		if strings.HasSuffix(name, ".exe") {
+			return ErrExtensionNotAllowed
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name          string
+		entries       []testEntry
+		existing      map[string]string // files in the target directory before extracting
+		policy        string
+		limits        ExtractLimits
+		wantErr       error
+		wantExtracted []string
+		wantSkipped   map[string]string // path to a substring of the reason
+		wantDirs      int
+	}{
+		{
+			name: "files and directories",
+			entries: []testEntry{
+				{name: "mods/", dir: true},
+				{name: "mods/a.jar", body: "jar"},
+				{name: "config/b.toml", body: "toml"},
+			},
+			wantExtracted: []string{"config/b.toml", "mods/a.jar"},
+			wantSkipped:   map[string]string{},
+			wantDirs:      1,
+		},
+		{
+			name: "zip-slip",
+			entries: []testEntry{
+				{name: "../evil.txt", body: "x"},
+				{name: "mods/../../evil.txt", body: "x"},
+				{name: "/evil.txt", body: "x"},
+				{name: `..\evil.txt`, body: "x"},
+				{name: "../outside/", dir: true},
+				{name: "good.txt", body: "ok"},
+			},
+			wantExtracted: []string{"good.txt"},
+			wantSkipped: map[string]string{
+				"../evil.txt":         "unsafe path",
+				"mods/../../evil.txt": "unsafe path",
+				"/evil.txt":           "unsafe path",
+				`..\evil.txt`:         "unsafe path",
+				"../outside/":         "unsafe path",
+			},
+		},
+		{
+			name: "symlinks",
+			entries: []testEntry{
+				{name: "link", body: "../../etc/passwd", symlink: true},
+				{name: "a.txt", body: "a"},
+			},
+			wantExtracted: []string{"a.txt"},
+			wantSkipped:   map[string]string{"link": "symlink"},
+		},
+		{
+			name: "file under a file",
+			entries: []testEntry{
+				{name: "a.txt", body: "a"},
+				{name: "a.txt/b.txt", body: "b"},
+			},
+			wantExtracted: []string{"a.txt"},
+			wantSkipped:   map[string]string{"a.txt/b.txt": "not a directory"},
+		},
+		{
+			name: "conflicting file",
+			entries: []testEntry{
+				{name: "a.txt", body: "new"},
+				{name: "b.txt", body: "b"},
+			},
+			existing:      map[string]string{"a.txt": "old"},
+			wantExtracted: []string{"b.txt"},
+			wantSkipped:   map[string]string{"a.txt": "already exists"},
+		},
+		{
+			name: "conflicting file renamed",
+			entries: []testEntry{
+				{name: "a.txt", body: "new"},
+			},
+			existing:      map[string]string{"a.txt": "old"},
+			policy:        ConflictRename,
+			wantExtracted: []string{"a-1.txt"},
+			wantSkipped:   map[string]string{},
+		},
+		{
+			name: "too many files",
+			entries: []testEntry{
+				{name: "a.txt", body: "a"},
+				{name: "b.txt", body: "b"},
+				{name: "c.txt", body: "c"},
+			},
+			limits:  ExtractLimits{MaxFiles: 2},
+			wantErr: ErrExtractLimit,
+		},
+		{
+			name: "directories count as entries",
+			entries: []testEntry{
+				{name: "a/", dir: true},
+				{name: "b/", dir: true},
+				{name: "c/", dir: true},
+				{name: "c/d.txt", body: "d"},
+			},
+			limits:  ExtractLimits{MaxFiles: 3},
+			wantErr: ErrExtractLimit,
+		},
+		{
+			name: "too large in total",
+			entries: []testEntry{
+				{name: "a.txt", body: strings.Repeat("a", 600)},
+				{name: "b.txt", body: strings.Repeat("b", 600)},
+			},
+			limits:  ExtractLimits{MaxTotalSize: 1000},
+			wantErr: ErrExtractLimit,
+		},
+		{
+			name: "single file too large",
+			entries: []testEntry{
+				{name: "big.bin", body: strings.Repeat("x", 2000)},
+				{name: "small.txt", body: "s"},
+			},
+			limits:        ExtractLimits{MaxFileSize: 1000},
+			wantExtracted: []string{"small.txt"},
+			wantSkipped:   map[string]string{"big.bin": "file too large"},
+		},
+		{
+			name: "refused files do not count",
+			entries: []testEntry{
+				{name: "a.exe", body: strings.Repeat("x", 2000)},
+				{name: "b.exe", body: "x"},
+				{name: "c.txt", body: "c"},
+			},
+			limits:        ExtractLimits{MaxFiles: 1, MaxTotalSize: 100, CheckFile: refuseExe},
+			wantExtracted: []string{"c.txt"},
+			wantSkipped:   map[string]string{"a.exe": "not allowed", "b.exe": "not allowed"},
+		},
+	}
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				var data []byte
+				if format == "zip" {
+					data = buildZip(t, tt.entries)
+				} else {
+					data = buildTarGz(t, tt.entries)
+				}
+
+				// The archive is extracted into a subdirectory, so escapes
+				// would land next to it.
+				root := t.TempDir()
+				dest := filepath.Join(root, "server")
+				if err := os.MkdirAll(dest, 0755); err != nil {
+					t.Fatal(err)
+				}
+				for name, body := range tt.existing {
+					if err := os.WriteFile(filepath.Join(dest, name), []byte(body), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				report, err := ExtractArchive(bytes.NewReader(data), int64(len(data)), "test."+format, dest, tt.policy, tt.limits)
+				assertNoEscape(t, root)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("ExtractArchive() error = %v, want %v", err, tt.wantErr)
+					}
+					// Limits on entries and declared sizes are checked before
+					// anything is written.
+					if entries, _ := os.ReadDir(dest); len(entries) != len(tt.existing) {
+						t.Errorf("files were written before the limit was detected: %v", entries)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ExtractArchive() error = %v", err)
+				}
+
+				var extracted []string
+				for _, f := range report.Extracted {
+					extracted = append(extracted, f.Path)
+					body, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(f.Path)))
+					if err != nil || int64(len(body)) != f.Size {
+						t.Errorf("extracted file %s: %v, %d bytes, reported %d", f.Path, err, len(body), f.Size)
+					}
+				}
+				sort.Strings(extracted)
+				if strings.Join(extracted, ",") != strings.Join(tt.wantExtracted, ",") {
+					t.Errorf("extracted %v, want %v", extracted, tt.wantExtracted)
+				}
+
+				skipped := make(map[string]string)
+				for _, s := range report.Skipped {
+					skipped[s.Path] = s.Reason
+				}
+				if len(skipped) != len(tt.wantSkipped) {
+					t.Errorf("skipped %v, want %v", skipped, tt.wantSkipped)
+				}
+				for path, reason := range tt.wantSkipped {
+					if !strings.Contains(skipped[path], reason) {
+						t.Errorf("%s skipped with %q, want %q", path, skipped[path], reason)
+					}
+				}
+				if report.Dirs != tt.wantDirs {
+					t.Errorf("created %d directories, want %d", report.Dirs, tt.wantDirs)
+				}
+				for name, body := range tt.existing {
+					if got, _ := os.ReadFile(filepath.Join(dest, name)); string(got) != body {
+						t.Errorf("existing file %s was changed to %q", name, got)
+					}
+				}
+			})
+		}
+	}
+}
+
+// assertNoEscape fails if anything but the server directory was created in root.
+func assertNoEscape(t *testing.T, root string) {
+	t.Helper()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "server" {
+			t.Errorf("archive escaped the target directory: %s", e.Name())
+		}
+	}
+	if _, err := os.Stat("/evil.txt"); err == nil {
+		t.Error("archive wrote /evil.txt")
+	}
+}
+
+func TestExtractArchiveUnsupported(t *testing.T) {
+	if _, err := ExtractArchive(bytes.NewReader(nil), 0, "test.rar", t.TempDir(), ConflictFail, ExtractLimits{}); err == nil {
+		t.Error("rar archive accepted")
+	}
+	if _, err := ExtractArchive(bytes.NewReader([]byte("junk")), 4, "test.zip", t.TempDir(), ConflictFail, ExtractLimits{}); err == nil {
+		t.Error("invalid zip archive accepted")
+	}
+}
@@ -0,0 +1,198 @@
+package modmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors returned by MovePath and CopyPath.
+var (
+	ErrIntoItself       = errors.New("cannot move or copy a directory into itself")
+	ErrSamePath         = errors.New("source and destination are the same")
+	ErrOverwriteDir     = errors.New("directories cannot be overwritten")
+	ErrSourceNotFound   = errors.New("source does not exist")
+	ErrUnsupportedEntry = errors.New("symlinks and special files cannot be moved or copied")
+)
+
+// checkTransfer validates a move or copy from src to dest and resolves the
+// conflict policy. It returns the final destination, or a result with
+// Skipped set.
+func checkTransfer(src, dest, policy string) (os.FileInfo, *WriteResult, error) {
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrSourceNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil, nil, ErrUnsupportedEntry
+	}
+	if filepath.Clean(dest) == filepath.Clean(src) {
+		return nil, nil, ErrSamePath
+	}
+	if isWithin(filepath.Clean(dest), filepath.Clean(src)) {
+		return nil, nil, ErrIntoItself
+	}
+
+	res, err := CheckConflict(dest, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !res.Skipped && !res.Renamed && policy == ConflictOverwrite {
+		if existing, err := os.Lstat(dest); err == nil && (existing.IsDir() || info.IsDir()) {
+			return nil, nil, ErrOverwriteDir
+		}
+	}
+	return info, res, nil
+}
+
+// isWithin reports whether path equals dir or lies below it.
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// MovePath moves or renames the file or directory src to dest, which may be
+// in another server's directory. Existing targets are handled according to
+// the conflict policy; directories are never merged or overwritten.
+func MovePath(src, dest, policy string) (*WriteResult, error) {
+	info, res, err := checkTransfer(src, dest, policy)
+	if err != nil || res.Skipped {
+		return res, err
+	}
+	if err := os.MkdirAll(filepath.Dir(res.Path), 0755); err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		// Renaming a directory over an existing one would fail or replace
+		// an empty directory, so check right before.
+		if _, err := os.Lstat(res.Path); err == nil {
+			return nil, &ConflictError{Path: res.Path, Suggested: freePath(res.Path)}
+		}
+		if err := os.Rename(src, res.Path); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if policy == ConflictOverwrite {
+		if err := os.Rename(src, res.Path); err != nil {
+			return nil, err
+		}
+	} else {
+		// Hard link into place so a file created in the meantime is not replaced.
+		placed, err := placeFile(src, res.Path, policy)
+		if err != nil || placed.Skipped {
+			return placed, err
+		}
+		placed.Renamed = placed.Renamed || res.Renamed
+		res = placed
+		if _, err := os.Lstat(src); err == nil {
+			if err := os.Remove(src); err != nil {
+				return nil, err
+			}
+		}
+	}
+	res.Size = info.Size()
+	return res, nil
+}
+
+// CopyPath copies the file or directory src to dest, which may be in another
+// server's directory. Directories are copied into a temporary directory
+// first and renamed into place, so a failed copy leaves nothing behind.
+// Symlinks and special files inside directories are not copied.
+func CopyPath(src, dest, policy string) (*WriteResult, error) {
+	info, res, err := checkTransfer(src, dest, policy)
+	if err != nil || res.Skipped {
+		return res, err
+	}
+
+	if !info.IsDir() {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		written, err := WriteFileAtomic(res.Path, f, policy)
+		if err == nil && !written.Skipped {
+			written.Renamed = written.Renamed || res.Renamed
+		}
+		return written, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(res.Path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(res.Path), tempFilePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	size, err := copyTree(src, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(res.Path); err == nil {
+		return nil, &ConflictError{Path: res.Path, Suggested: freePath(res.Path)}
+	}
+	if err := os.Rename(tmp, res.Path); err != nil {
+		return nil, err
+	}
+	res.Size = size
+	return res, nil
+}
+
+// copyTree copies the regular files and directories below src into the
+// existing directory dest and returns the number of bytes copied.
+func copyTree(src, dest string) (int64, error) {
+	var total int64
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if isTempFile(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			return os.Mkdir(target, 0755)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, in)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		total += n
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,180 @@
+package modmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files below root, keyed by slash-separated path. A
+// trailing slash creates an empty directory.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the regular files below root with their content, and
+// directories with a trailing slash.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			files[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestMoveAndCopyPath(t *testing.T) {
+	initial := map[string]string{
+		"mods/a.jar":        "a",
+		"mods/b.jar":        "b",
+		"config/a.toml":     "x = 1",
+		"config/sub/b.toml": "y = 2",
+		"old/":              "",
+	}
+	tests := []struct {
+		name     string
+		src      string
+		dest     string
+		policy   string
+		wantErr  error // ErrX, or &ConflictError{}
+		wantPath string
+		skipped  bool
+		// changes to the initial tree after a move; a copy keeps src
+		add    map[string]string
+		remove []string
+	}{
+		{name: "rename file", src: "mods/a.jar", dest: "mods/c.jar", wantPath: "mods/c.jar", add: map[string]string{"mods/c.jar": "a"}, remove: []string{"mods/a.jar"}},
+		{name: "file into new directory", src: "mods/a.jar", dest: "disabled/a.jar", wantPath: "disabled/a.jar", add: map[string]string{"disabled/": "", "disabled/a.jar": "a"}, remove: []string{"mods/a.jar"}},
+		{name: "directory", src: "config", dest: "old/config", wantPath: "old/config",
+			add:    map[string]string{"old/config/": "", "old/config/a.toml": "x = 1", "old/config/sub/": "", "old/config/sub/b.toml": "y = 2"},
+			remove: []string{"config/", "config/a.toml", "config/sub/", "config/sub/b.toml"}},
+		{name: "file conflict", src: "mods/a.jar", dest: "mods/b.jar", wantErr: &ConflictError{}},
+		{name: "file overwrite", src: "mods/a.jar", dest: "mods/b.jar", policy: ConflictOverwrite, wantPath: "mods/b.jar", add: map[string]string{"mods/b.jar": "a"}, remove: []string{"mods/a.jar"}},
+		{name: "file rename", src: "mods/a.jar", dest: "mods/b.jar", policy: ConflictRename, wantPath: "mods/b-1.jar", add: map[string]string{"mods/b-1.jar": "a"}, remove: []string{"mods/a.jar"}},
+		{name: "file skip", src: "mods/a.jar", dest: "mods/b.jar", policy: ConflictSkip, wantPath: "mods/b.jar", skipped: true},
+		{name: "directories are not merged", src: "config", dest: "mods", wantErr: &ConflictError{}},
+		{name: "directories are not overwritten", src: "config", dest: "old", policy: ConflictOverwrite, wantErr: ErrOverwriteDir},
+		{name: "file does not replace a directory", src: "mods/a.jar", dest: "old", policy: ConflictOverwrite, wantErr: ErrOverwriteDir},
+		{name: "directory rename", src: "config", dest: "mods", policy: ConflictRename, wantPath: "mods-1",
+			add:    map[string]string{"mods-1/": "", "mods-1/a.toml": "x = 1", "mods-1/sub/": "", "mods-1/sub/b.toml": "y = 2"},
+			remove: []string{"config/", "config/a.toml", "config/sub/", "config/sub/b.toml"}},
+		{name: "into itself", src: "config", dest: "config/sub/config", wantErr: ErrIntoItself},
+		{name: "same path", src: "mods/a.jar", dest: "mods/a.jar", policy: ConflictOverwrite, wantErr: ErrSamePath},
+		{name: "missing source", src: "mods/z.jar", dest: "mods/y.jar", wantErr: ErrSourceNotFound},
+	}
+	for _, tt := range tests {
+		for _, op := range []string{"move", "copy"} {
+			t.Run(op+" "+tt.name, func(t *testing.T) {
+				root := t.TempDir()
+				writeTree(t, root, initial)
+				before := readTree(t, root)
+				transfer := MovePath
+				if op == "copy" {
+					transfer = CopyPath
+				}
+
+				res, err := transfer(filepath.Join(root, tt.src), filepath.Join(root, tt.dest), tt.policy)
+				var conflict *ConflictError
+				switch {
+				case errors.As(tt.wantErr, &conflict):
+					if !errors.As(err, &conflict) {
+						t.Fatalf("error = %v, want a conflict", err)
+					}
+				case tt.wantErr != nil:
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("error = %v, want %v", err, tt.wantErr)
+					}
+				case err != nil:
+					t.Fatalf("error = %v", err)
+				default:
+					if res.Path != filepath.Join(root, tt.wantPath) || res.Skipped != tt.skipped || res.Renamed != (tt.policy == ConflictRename) {
+						t.Errorf("result = %+v, want %s skipped %t", res, tt.wantPath, tt.skipped)
+					}
+				}
+
+				want := make(map[string]string)
+				for k, v := range before {
+					want[k] = v
+				}
+				for k, v := range tt.add {
+					want[k] = v
+				}
+				if op == "move" {
+					for _, k := range tt.remove {
+						delete(want, k)
+					}
+				}
+				got := readTree(t, root)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("tree after %s:\n got %v\nwant %v", op, sortedKeys(got), sortedKeys(want))
+				}
+			})
+		}
+	}
+}
+
+func TestCopyPathSkipsSpecialFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"src/a.jar": "a", "src/.upload-123": "partial"})
+	if err := os.Symlink("/etc/passwd", filepath.Join(root, "src", "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	res, err := CopyPath(filepath.Join(root, "src"), filepath.Join(root, "dest"), ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Size != 1 {
+		t.Errorf("copied %d bytes, want 1", res.Size)
+	}
+	got := readTree(t, filepath.Join(root, "dest"))
+	if !reflect.DeepEqual(got, map[string]string{"a.jar": "a"}) {
+		t.Errorf("copy contains %v, want only a.jar", sortedKeys(got))
+	}
+	// A symlink itself is refused instead of copying its target.
+	if _, err := MovePath(filepath.Join(root, "src", "link"), filepath.Join(root, "link"), ConflictFail); !errors.Is(err, ErrUnsupportedEntry) {
+		t.Errorf("MovePath(symlink) error = %v, want ErrUnsupportedEntry", err)
+	}
+	assertNoTempFiles(t, root)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,254 @@
+package modmanager
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileHashes holds the content digests of a file, hex encoded.
+type FileHashes struct {
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512"`
+}
+
+// Digest returns the value for an HTTP Digest header (RFC 3230) listing the
+// SHA-256 and SHA-512 digests in base64.
+func (fh FileHashes) Digest() string {
+	return "sha-256=" + hexToBase64(fh.SHA256) + ",sha-512=" + hexToBase64(fh.SHA512)
+}
+
+// hexToBase64 re-encodes a hex digest as standard base64.
+func hexToBase64(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// HashStore persists file hashes between restarts. Entries are only valid for
+// the exact size and modification time they were computed for.
+type HashStore interface {
+	GetFileHashes(path string, size int64, modTime time.Time) (*FileHashes, error)
+	PutFileHashes(path string, size int64, modTime time.Time, hashes FileHashes) error
+	// DeleteFileHashes removes the entries of the given paths.
+	DeleteFileHashes(paths []string) error
+	// FileHashPaths returns the paths of all entries below dir.
+	FileHashPaths(dir string) ([]string, error)
+}
+
+// hashEntry is a cached FileHashes together with the file state it belongs to.
+type hashEntry struct {
+	size    int64
+	modTime time.Time
+	hashes  FileHashes
+}
+
+// Hasher computes file hashes and caches them by path, size and
+// modification time so unchanged files are only read once. If a HashStore
+// is set, hashes also survive restarts.
+type Hasher struct {
+	Store HashStore
+
+	mu      sync.Mutex
+	cache   map[string]hashEntry
+	pending map[string]bool // paths hashed in the background by Lookup
+}
+
+// NewHasher creates a new Hasher with an empty cache. store may be nil.
+func NewHasher(store HashStore) *Hasher {
+	return &Hasher{Store: store, cache: make(map[string]hashEntry), pending: make(map[string]bool)}
+}
+
+// Hash returns the hashes of the file at path.
+func (h *Hasher) Hash(path string) (FileHashes, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileHashes{}, err
+	}
+	return h.hashWithInfo(path, info)
+}
+
+// Lookup returns the hashes of the file at path if they are cached, without
+// reading the file. On a miss the file is hashed in the background, so the
+// hashes are available to later calls, and Lookup reports false.
+func (h *Hasher) Lookup(path string, info os.FileInfo) (FileHashes, bool, error) {
+	path = filepath.Clean(path)
+	hashes, ok, err := h.cached(path, info)
+	if ok || err != nil {
+		return hashes, ok, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.pending[path] {
+		h.pending[path] = true
+		go func() {
+			if _, err := h.hashWithInfo(path, info); err != nil {
+				log.Printf("Error hashing %s: %v", path, err)
+			}
+			h.mu.Lock()
+			delete(h.pending, path)
+			h.mu.Unlock()
+		}()
+	}
+	return FileHashes{}, false, nil
+}
+
+// cached returns the hashes of path from the memory cache or the store.
+func (h *Hasher) cached(path string, info os.FileInfo) (FileHashes, bool, error) {
+	h.mu.Lock()
+	entry, ok := h.cache[path]
+	h.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.hashes, true, nil
+	}
+
+	if h.Store != nil {
+		stored, err := h.Store.GetFileHashes(path, info.Size(), info.ModTime())
+		if err != nil {
+			return FileHashes{}, false, fmt.Errorf("failed to load cached hashes for %s: %w", path, err)
+		}
+		if stored != nil {
+			h.mu.Lock()
+			h.cache[path] = hashEntry{size: info.Size(), modTime: info.ModTime(), hashes: *stored}
+			h.mu.Unlock()
+			return *stored, true, nil
+		}
+	}
+	return FileHashes{}, false, nil
+}
+
+// hashWithInfo is Hash for callers that already have the file's FileInfo.
+func (h *Hasher) hashWithInfo(path string, info os.FileInfo) (FileHashes, error) {
+	path = filepath.Clean(path)
+	hashes, ok, err := h.cached(path, info)
+	if ok || err != nil {
+		return hashes, err
+	}
+
+	hashes, err = HashFile(path)
+	if err != nil {
+		return FileHashes{}, err
+	}
+	if h.Store != nil {
+		if err := h.Store.PutFileHashes(path, info.Size(), info.ModTime(), hashes); err != nil {
+			return FileHashes{}, fmt.Errorf("failed to store hashes for %s: %w", path, err)
+		}
+	}
+
+	h.mu.Lock()
+	h.cache[path] = hashEntry{size: info.Size(), modTime: info.ModTime(), hashes: hashes}
+	h.mu.Unlock()
+	return hashes, nil
+}
+
+// Forget drops the cached hashes of files that no longer exist.
+func (h *Hasher) Forget(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	cleaned := make([]string, len(paths))
+	h.mu.Lock()
+	for i, p := range paths {
+		cleaned[i] = filepath.Clean(p)
+		delete(h.cache, cleaned[i])
+	}
+	h.mu.Unlock()
+	if h.Store == nil {
+		return nil
+	}
+	return h.Store.DeleteFileHashes(cleaned)
+}
+
+// Prune drops the cached hashes of all files below dir for which keep
+// returns false, including entries left in the store by files removed
+// while the program was not running.
+func (h *Hasher) Prune(dir string, keep func(path string) bool) error {
+	dir = filepath.Clean(dir)
+	var stale []string
+	h.mu.Lock()
+	for p := range h.cache {
+		if isWithin(p, dir) && !keep(p) {
+			stale = append(stale, p)
+		}
+	}
+	h.mu.Unlock()
+	if h.Store != nil {
+		stored, err := h.Store.FileHashPaths(dir)
+		if err != nil {
+			return err
+		}
+		for _, p := range stored {
+			if !keep(p) {
+				stale = append(stale, p)
+			}
+		}
+	}
+	return h.Forget(stale)
+}
+
+// WriteSHA256Sums writes a sha256sum compatible listing of the regular files
+// directly inside dir, a directory in the server directory root, sorted by
+// name. Subdirectories, symlinks and hidden files are skipped.
+func (h *Hasher) WriteSHA256Sums(w io.Writer, root, dir string) error {
+	settings, err := settingsAt(root, dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var b strings.Builder
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || isTempFile(entry.Name()) || settings.hidden(entry.Name(), false) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		hashes, err := h.hashWithInfo(filepath.Join(dir, entry.Name()), info)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", hashes.SHA256, entry.Name())
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// HashFile computes SHA-1, SHA-256 and SHA-512 of a file in a single pass.
+func HashFile(path string) (FileHashes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileHashes{}, err
+	}
+	defer f.Close()
+
+	s1, s256, s512 := sha1.New(), sha256.New(), sha512.New()
+	if _, err := io.Copy(io.MultiWriter(s1, s256, s512), f); err != nil {
+		return FileHashes{}, err
+	}
+	return FileHashes{
+		SHA1:   hex.EncodeToString(s1.Sum(nil)),
+		SHA256: hex.EncodeToString(s256.Sum(nil)),
+		SHA512: hex.EncodeToString(s512.Sum(nil)),
+	}, nil
+}
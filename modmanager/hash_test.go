@@ -0,0 +1,133 @@
+package modmanager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryHashStore is a HashStore keeping entries in a map.
+type memoryHashStore struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+func (s *memoryHashStore) GetFileHashes(path string, size int64, modTime time.Time) (*FileHashes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[path]
+	if !ok || e.size != size || !e.modTime.Equal(modTime) {
+		return nil, nil
+	}
+	return &e.hashes, nil
+}
+
+func (s *memoryHashStore) PutFileHashes(path string, size int64, modTime time.Time, hashes FileHashes) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[path] = hashEntry{size: size, modTime: modTime, hashes: hashes}
+	return nil
+}
+
+func (s *memoryHashStore) DeleteFileHashes(paths []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range paths {
+		delete(s.entries, p)
+	}
+	return nil
+}
+
+func (s *memoryHashStore) FileHashPaths(dir string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for p := range s.entries {
+		if isWithin(p, dir) && p != dir {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+func (s *memoryHashStore) paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for p := range s.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestHasherLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jar")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	store := &memoryHashStore{entries: make(map[string]hashEntry)}
+	h := NewHasher(store)
+
+	// A miss returns immediately and hashes in the background.
+	if _, ok, err := h.Lookup(path, info); ok || err != nil {
+		t.Fatalf("first Lookup() = %t, %v, want a miss", ok, err)
+	}
+	var hashes FileHashes
+	for i := 0; i < 100; i++ {
+		var ok bool
+		if hashes, ok, _ = h.Lookup(path, info); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hashes.SHA256 != sha256Hex([]byte("hello")) {
+		t.Fatalf("Lookup() SHA256 = %q after background hashing", hashes.SHA256)
+	}
+
+	// Stored hashes are found by a new Hasher without reading the file.
+	if err := os.Chmod(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := NewHasher(store).Lookup(path, info); !ok || err != nil || got != hashes {
+		t.Errorf("Lookup() from the store = %+v, %t, %v", got, ok, err)
+	}
+}
+
+func TestHasherForgetAndPrune(t *testing.T) {
+	base := t.TempDir()
+	writeTree(t, base, map[string]string{"creative/a.jar": "a", "creative/b.jar": "b", "creative/c.jar": "c", "creative2/a.jar": "a"})
+	store := &memoryHashStore{entries: make(map[string]hashEntry)}
+	h := NewHasher(store)
+	for _, p := range []string{"creative/a.jar", "creative/b.jar", "creative/c.jar", "creative2/a.jar"} {
+		if _, err := h.Hash(filepath.Join(base, p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := h.Forget([]string{filepath.Join(base, "creative", "..", "creative", "a.jar")}); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(base, "creative")
+	keep := filepath.Join(dir, "c.jar")
+	if err := h.Prune(dir, func(p string) bool { return p == keep }); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{keep, filepath.Join(base, "creative2", "a.jar")}
+	sort.Strings(want)
+	if got := store.paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored hashes = %v, want %v", got, want)
+	}
+	h.mu.Lock()
+	cached := len(h.cache)
+	h.mu.Unlock()
+	if cached != 2 {
+		t.Errorf("%d cached hashes, want 2", cached)
+	}
+}
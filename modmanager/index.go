@@ -0,0 +1,461 @@
+package modmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChangeEvent describes a change below a server's mod directory.
+type ChangeEvent struct {
+	Server string `json:"server"`
+	// Path is the slash-separated path relative to the server directory.
+	// It is empty if the change was found by a periodic rescan and the
+	// exact path is unknown.
+	Path string `json:"path"`
+}
+
+// Index keeps the scanned mod tree of every server in memory. Trees are built
+// on first use and rebuilt lazily after filesystem notifications or periodic
+// rescans mark them stale. Unchanged files are not read again on rebuilds,
+// and new files are hashed in the background, so their Hashes may still be
+// nil right after they appear.
+type Index struct {
+	BaseDir string
+	Hasher  *Hasher // optional, fills in ModItem.Hashes in the background
+
+	mu        sync.Mutex
+	servers   map[string]*serverIndex
+	listeners []func(ChangeEvent)
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+}
+
+// serverIndex is the cached state for a single server directory.
+type serverIndex struct {
+	mu          sync.Mutex
+	dirty       atomic.Bool
+	full        *ModItem // including hidden entries
+	root        *ModItem // VisibleTree of full
+	fingerprint string
+	files       map[string]indexedFile // keyed by ModItem.Path
+	hashing     bool                   // hashPending is running, guarded by mu
+}
+
+// indexedFile is a scanned file together with the state it was scanned at.
+type indexedFile struct {
+	size    int64
+	modTime time.Time
+	regular bool
+	failed  bool // hashing failed, not retried until the file changes
+	item    ModItem
+}
+
+// NewIndex creates an index for the server directories below baseDir. If
+// filesystem notifications are unavailable, only the periodic rescan every
+// rescanInterval keeps the index current. A zero interval disables rescans.
+func NewIndex(baseDir string, hasher *Hasher, rescanInterval time.Duration) *Index {
+	ix := &Index{
+		BaseDir: baseDir,
+		Hasher:  hasher,
+		servers: make(map[string]*serverIndex),
+		done:    make(chan struct{}),
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Filesystem notifications unavailable, relying on periodic rescans: %v", err)
+	} else {
+		ix.watcher = watcher
+		go ix.watch()
+	}
+
+	if rescanInterval > 0 {
+		go ix.rescanLoop(rescanInterval)
+	}
+	return ix
+}
+
+// Close stops watching the filesystem.
+func (ix *Index) Close() error {
+	close(ix.done)
+	if ix.watcher != nil {
+		return ix.watcher.Close()
+	}
+	return nil
+}
+
+// Subscribe registers fn to be called for every change below a server
+// directory. fn is called from the index's goroutine and must not block.
+// Listeners may see the same change more than once.
+func (ix *Index) Subscribe(fn func(ChangeEvent)) {
+	ix.mu.Lock()
+	ix.listeners = append(ix.listeners, fn)
+	ix.mu.Unlock()
+}
+
+// Tree returns the mod tree of a server without hidden entries. The returned
+// tree is shared and must not be modified.
+func (ix *Index) Tree(serverName string) (*ModItem, error) {
+	si, err := ix.current(serverName)
+	if err != nil {
+		return nil, err
+	}
+	defer si.mu.Unlock()
+	return si.root, nil
+}
+
+// FullTree is like Tree, but includes hidden entries with ModItem.Hidden set,
+// for managing the files.
+func (ix *Index) FullTree(serverName string) (*ModItem, error) {
+	si, err := ix.current(serverName)
+	if err != nil {
+		return nil, err
+	}
+	defer si.mu.Unlock()
+	return si.full, nil
+}
+
+// current returns the locked, up to date serverIndex of a server.
+func (ix *Index) current(serverName string) (*serverIndex, error) {
+	if !validServerName(serverName) {
+		return nil, fmt.Errorf("invalid server name: %s", serverName)
+	}
+
+	si := ix.server(serverName)
+	si.mu.Lock()
+	if si.root != nil && !si.dirty.Load() {
+		return si, nil
+	}
+	if _, err := ix.rebuild(serverName, si); err != nil {
+		si.mu.Unlock()
+		return nil, err
+	}
+	return si, nil
+}
+
+// Invalidate marks a server's tree as stale, e.g. right after a write so the
+// next read does not depend on notification latency.
+func (ix *Index) Invalidate(serverName string) {
+	ix.mu.Lock()
+	si, ok := ix.servers[serverName]
+	ix.mu.Unlock()
+	if ok {
+		si.dirty.Store(true)
+	}
+}
+
+// server returns the serverIndex for name, creating it if necessary.
+func (ix *Index) server(name string) *serverIndex {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	si, ok := ix.servers[name]
+	if !ok {
+		si = &serverIndex{files: make(map[string]indexedFile)}
+		ix.servers[name] = si
+	}
+	return si
+}
+
+// rebuild scans the server directory again, reusing the items of files whose
+// size and modification time did not change. It reports whether the contents
+// differ from the previous scan. si.mu must be held.
+func (ix *Index) rebuild(serverName string, si *serverIndex) (bool, error) {
+	// Cleared before walking so changes during the walk trigger another rebuild.
+	si.dirty.Store(false)
+
+	basePath := filepath.Join(ix.BaseDir, serverName)
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		si.full, si.root, si.fingerprint, si.files = nil, nil, "", make(map[string]indexedFile)
+		return false, fmt.Errorf("mod directory for server %s not found: %w", serverName, err)
+	}
+
+	root := &ModItem{Name: serverName, Path: "", Type: TypeDir}
+	files := make(map[string]indexedFile, len(si.files))
+	fp := sha256.New()
+	settings := rootSettings(serverName).enter(basePath, "")
+	settings.describeSelf(root)
+	if err := ix.walk(settings, basePath, "", root, si.files, files, fp); err != nil {
+		si.dirty.Store(true)
+		return false, fmt.Errorf("error walking mod directory for server %s: %w", serverName, err)
+	}
+
+	fingerprint := hex.EncodeToString(fp.Sum(nil))
+	changed := si.fingerprint != "" && si.fingerprint != fingerprint
+	if ix.Hasher != nil {
+		ix.forgetRemoved(basePath, si, files)
+	}
+	si.full, si.root, si.fingerprint, si.files = root, VisibleTree(root), fingerprint, files
+	if ix.Hasher != nil && !si.hashing && si.unhashed(nil) {
+		si.hashing = true
+		go ix.hashPending(serverName, si)
+	}
+	return changed, nil
+}
+
+// forgetRemoved evicts the hashes of files that disappeared since the last
+// scan. The first scan of a server prunes everything not found, which
+// covers files removed while the program was not running. si.mu must be held.
+func (ix *Index) forgetRemoved(basePath string, si *serverIndex, files map[string]indexedFile) {
+	var err error
+	if si.fingerprint == "" {
+		err = ix.Hasher.Prune(basePath, func(path string) bool {
+			rel, err := filepath.Rel(basePath, path)
+			_, ok := files[rel]
+			return err == nil && ok
+		})
+	} else {
+		var removed []string
+		for p := range si.files {
+			if _, ok := files[p]; !ok {
+				removed = append(removed, filepath.Join(basePath, p))
+			}
+		}
+		err = ix.Hasher.Forget(removed)
+	}
+	if err != nil {
+		log.Printf("Error evicting file hashes for %s: %v", basePath, err)
+	}
+}
+
+// unhashed reports whether a regular file not in skip still lacks hashes.
+// si.mu must be held.
+func (si *serverIndex) unhashed(skip map[string]bool) bool {
+	for p, f := range si.files {
+		if f.regular && f.item.Hashes == nil && !f.failed && !skip[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// hashPending hashes the files that were scanned without hashes. Files are
+// read without holding si.mu, so readers are not blocked while a large
+// directory is hashed for the first time; the results are stored in the
+// cached items and the tree is marked stale to pick them up on the next read.
+func (ix *Index) hashPending(serverName string, si *serverIndex) {
+	basePath := filepath.Join(ix.BaseDir, serverName)
+	tried := make(map[string]bool)
+	for {
+		si.mu.Lock()
+		if !si.unhashed(tried) {
+			si.hashing = false
+			si.mu.Unlock()
+			return
+		}
+		var pending []string
+		for p, f := range si.files {
+			if f.regular && f.item.Hashes == nil && !f.failed && !tried[p] {
+				pending = append(pending, p)
+			}
+		}
+		si.mu.Unlock()
+
+		hashed := make(map[string]indexedFile, len(pending))
+		for _, p := range pending {
+			tried[p] = true
+			fullPath := filepath.Join(basePath, p)
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				continue // removed, dropped by the next rebuild
+			}
+			hashes, err := ix.Hasher.hashWithInfo(fullPath, info)
+			h := indexedFile{size: info.Size(), modTime: info.ModTime(), failed: err != nil}
+			if err == nil {
+				h.item.Hashes = &hashes
+			}
+			hashed[p] = h
+		}
+
+		si.mu.Lock()
+		updated := false
+		for p, h := range hashed {
+			if f, ok := si.files[p]; ok && f.size == h.size && f.modTime.Equal(h.modTime) {
+				f.item.Hashes, f.failed = h.item.Hashes, h.failed
+				si.files[p] = f
+				updated = updated || h.item.Hashes != nil
+			}
+		}
+		si.mu.Unlock()
+		if updated {
+			si.dirty.Store(true)
+		}
+	}
+}
+
+// walk is the incremental counterpart of walkDir. Directories are added to
+// the watcher as they are visited. Sidecar settings are applied on every
+// walk, so cached items are stored without them.
+func (ix *Index) walk(settings dirSettings, currentPath, relativePath string, parent *ModItem, prev, next map[string]indexedFile, fp io.Writer) error {
+	if ix.watcher != nil {
+		// Failures (e.g. inotify watch limits) are covered by periodic rescans.
+		ix.watcher.Add(currentPath)
+	}
+
+	entries, err := os.ReadDir(currentPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if isTempFile(entry.Name()) {
+			continue
+		}
+		itemPath := filepath.Join(relativePath, entry.Name())
+		fullPath := filepath.Join(currentPath, entry.Name())
+
+		hidden := settings.hidden(entry.Name(), entry.IsDir())
+		if entry.IsDir() {
+			item := ModItem{Name: entry.Name(), Path: itemPath, Type: TypeDir, Hidden: hidden}
+			fmt.Fprintf(fp, "d\x00%s\n", itemPath)
+			sub := settings.enter(fullPath, itemPath)
+			sub.describeSelf(&item)
+			if err := ix.walk(sub, fullPath, itemPath, &item, prev, next, fp); err != nil {
+				return err
+			}
+			settings.describeEntry(&item)
+			parent.Children = append(parent.Children, item)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // removed while scanning
+			}
+			return err
+		}
+		fmt.Fprintf(fp, "f\x00%s\x00%d\x00%d\n", itemPath, info.Size(), info.ModTime().UnixNano())
+
+		if old, ok := prev[itemPath]; ok && old.size == info.Size() && old.modTime.Equal(info.ModTime()) {
+			next[itemPath] = old
+			item := old.item
+			item.Hidden = hidden
+			settings.describeEntry(&item)
+			parent.Children = append(parent.Children, item)
+			continue
+		}
+
+		item, err := fileItem(settings.server, fullPath, itemPath, info)
+		if err != nil {
+			return err
+		}
+		// Hashed later by hashPending, outside the lock.
+		next[itemPath] = indexedFile{size: info.Size(), modTime: info.ModTime(), regular: info.Mode().IsRegular(), item: item}
+		item.Hidden = hidden
+		settings.describeEntry(&item)
+		parent.Children = append(parent.Children, item)
+	}
+	settings.sort(parent.Children)
+	return nil
+}
+
+// watch processes filesystem notifications until the index is closed.
+func (ix *Index) watch() {
+	for {
+		select {
+		case <-ix.done:
+			return
+		case event, ok := <-ix.watcher.Events:
+			if !ok {
+				return
+			}
+			ix.handleEvent(event.Name)
+		case err, ok := <-ix.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, so treat everything as stale.
+			log.Printf("Filesystem watcher error: %v", err)
+			ix.markAllDirty()
+		}
+	}
+}
+
+// handleEvent marks the server containing name as stale and notifies listeners.
+func (ix *Index) handleEvent(name string) {
+	rel, err := filepath.Rel(ix.BaseDir, name)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return
+	}
+	serverName, path, _ := strings.Cut(filepath.ToSlash(rel), "/")
+
+	ix.mu.Lock()
+	si, ok := ix.servers[serverName]
+	listeners := ix.listeners
+	ix.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	si.dirty.Store(true)
+	for _, fn := range listeners {
+		fn(ChangeEvent{Server: serverName, Path: path})
+	}
+}
+
+// markAllDirty marks every known server as stale.
+func (ix *Index) markAllDirty() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, si := range ix.servers {
+		si.dirty.Store(true)
+	}
+}
+
+// rescanLoop periodically rebuilds all known servers to catch changes that
+// were not reported by the watcher.
+func (ix *Index) rescanLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ix.done:
+			return
+		case <-ticker.C:
+			ix.rescan()
+		}
+	}
+}
+
+// rescan rebuilds every known server and notifies listeners about servers
+// whose contents changed without a notification.
+func (ix *Index) rescan() {
+	ix.mu.Lock()
+	names := make([]string, 0, len(ix.servers))
+	for name := range ix.servers {
+		names = append(names, name)
+	}
+	listeners := ix.listeners
+	ix.mu.Unlock()
+
+	for _, name := range names {
+		si := ix.server(name)
+		si.mu.Lock()
+		if si.root == nil {
+			si.mu.Unlock()
+			continue
+		}
+		changed, err := ix.rebuild(name, si)
+		si.mu.Unlock()
+		if err != nil {
+			log.Printf("Error rescanning mod directory for server %s: %v", name, err)
+			continue
+		}
+		if changed {
+			for _, fn := range listeners {
+				fn(ChangeEvent{Server: name})
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package modmanager
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdown renders GitHub flavoured markdown (tables, fenced code, task
+// lists, strikethrough, autolinks). Raw HTML is left out and links with
+// dangerous schemes such as javascript: are dropped, so uploaded files
+// cannot inject scripts.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithASTTransformers(
+		util.Prioritized(linkRewriter{}, 100),
+	)),
+)
+
+// linkBaseKey holds the linkBase of the file being rendered.
+var linkBaseKey = parser.NewContextKey()
+
+// linkBase describes where a markdown file lives, to resolve relative links.
+type linkBase struct {
+	server string
+	dir    string // slash-separated directory of the file, relative to the server directory
+}
+
+// RenderMarkdown converts markdown to sanitized HTML. Relative links are
+// left as they are.
+func RenderMarkdown(src []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(src, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderMarkdownFile converts the markdown file at relPath in a server's mod
+// directory to sanitized HTML. Relative links and images are rewritten to
+// point to the file download URLs below /files/{server}/mods/.
+func RenderMarkdownFile(src []byte, serverName, relPath string) (string, error) {
+	ctx := parser.NewContext()
+	ctx.Set(linkBaseKey, linkBase{server: serverName, dir: path.Dir(strings.ReplaceAll(relPath, `\`, "/"))})
+	var buf bytes.Buffer
+	if err := markdown.Convert(src, &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// linkRewriter resolves relative link and image destinations against the
+// linkBase in the parser context, if there is one. Autolinks with dangerous
+// schemes (<javascript:...>) are turned into plain text, as goldmark only
+// filters the destinations of regular links and images.
+type linkRewriter struct{}
+
+func (linkRewriter) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	base, hasBase := pc.Get(linkBaseKey).(linkBase)
+	var dangerous []*ast.AutoLink
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.AutoLink:
+			if html.IsDangerousURL(n.URL(reader.Source())) {
+				dangerous = append(dangerous, n)
+			}
+		case *ast.Link:
+			if hasBase {
+				n.Destination = base.resolve(n.Destination)
+			}
+		case *ast.Image:
+			if hasBase {
+				n.Destination = base.resolve(n.Destination)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	// Replaced after walking, as replacing nodes would cut the walk short.
+	for _, n := range dangerous {
+		n.Parent().ReplaceChild(n.Parent(), n, ast.NewString(n.Label(reader.Source())))
+	}
+}
+
+// resolve rewrites a relative destination to an absolute download URL.
+// Absolute URLs, root-relative paths and fragments are kept. Relative paths
+// leaving the server directory are dropped.
+func (b linkBase) resolve(dest []byte) []byte {
+	d := string(dest)
+	if d == "" || strings.HasPrefix(d, "#") || strings.HasPrefix(d, "/") {
+		return dest
+	}
+	u, err := url.Parse(d)
+	if err != nil {
+		return nil
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return dest
+	}
+
+	p := path.Join(b.dir, u.Path)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return nil
+	}
+	if p == "." {
+		p = ""
+	}
+	resolved := url.URL{Path: "/files/" + b.server + "/mods/" + p, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	return []byte(resolved.String())
+}
@@ -0,0 +1,89 @@
+package modmanager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		forbidden []string // must not appear in the output, case-insensitive
+	}{
+		{"script tag", "<script>alert(1)</script>", []string{"<script"}},
+		{"inline event handler", `<img src="x" onerror="alert(1)">`, []string{"onerror", "<img"}},
+		{"inline html", `Hello <a href="javascript:alert(1)">there</a>`, []string{"javascript:", "<a "}},
+		{"iframe", `<iframe src="https://evil.example"></iframe>`, []string{"<iframe"}},
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:"}},
+		{"mixed case scheme", "[click](JaVaScRiPt:alert(1))", []string{"javascript:"}},
+		{"vbscript link", "[click](vbscript:msgbox(1))", []string{"vbscript:"}},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)", []string{"data:text/html"}},
+		{"javascript image", "![x](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript autolink", "<javascript:alert(1)>", []string{`href="javascript:`}},
+		{"javascript reference link", "[click][x]\n\n[x]: javascript:alert(1)", []string{"javascript:"}},
+		{"html in code span", "`<script>alert(1)</script>`", []string{"<script"}},
+		{"attribute breakout", `[x](https://example.com/"onmouseover="alert(1))`, []string{`"onmouseover`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, render := range []func() (string, error){
+				func() (string, error) { return RenderMarkdown([]byte(tt.src)) },
+				func() (string, error) { return RenderMarkdownFile([]byte(tt.src), "creative", "docs/README.md") },
+			} {
+				html, err := render()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range tt.forbidden {
+					if strings.Contains(strings.ToLower(html), strings.ToLower(f)) {
+						t.Errorf("output contains %q: %s", f, html)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownKeepsSafeContent(t *testing.T) {
+	html, err := RenderMarkdown([]byte("# Title\n\n[site](https://example.com) <https://example.org>\n\n| a |\n|---|\n| b |\n\n- [x] done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<h1>Title</h1>", `href="https://example.com"`, `href="https://example.org"`, "<table>", `type="checkbox"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("output lacks %q: %s", want, html)
+		}
+	}
+}
+
+func TestLinkBaseResolve(t *testing.T) {
+	base := linkBase{server: "creative", dir: "docs/guides"}
+	tests := []struct {
+		dest string
+		want string
+	}{
+		{"", ""},
+		{"#usage", "#usage"},
+		{"/creative", "/creative"},
+		{"https://example.com/a", "https://example.com/a"},
+		{"//cdn.example.com/a.png", "//cdn.example.com/a.png"},
+		{"setup.md", "/files/creative/mods/docs/guides/setup.md"},
+		{"./img/a.png", "/files/creative/mods/docs/guides/img/a.png"},
+		{"../README.md", "/files/creative/mods/docs/README.md"},
+		{"../../mods/a.jar", "/files/creative/mods/mods/a.jar"},
+		{"setup.md?raw=1#top", "/files/creative/mods/docs/guides/setup.md?raw=1#top"},
+		{"a b.md", "/files/creative/mods/docs/guides/a%20b.md"},
+
+		// Leaving the server directory
+		{"../../..", ""},
+		{"../../../other/mods/a.jar", ""},
+		{"../../../../etc/passwd", ""},
+		{"..%2f..%2f..%2fother", ""},
+	}
+	for _, tt := range tests {
+		if got := string(base.resolve([]byte(tt.dest))); got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.dest, got, tt.want)
+		}
+	}
+}
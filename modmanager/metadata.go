@@ -0,0 +1,739 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Mod loaders recognised by the metadata parser.
+const (
+	LoaderFabric      = "fabric"
+	LoaderQuilt       = "quilt"
+	LoaderForge       = "forge"
+	LoaderNeoForge    = "neoforge"
+	LoaderLegacyForge = "legacy-forge" // mcmod.info, pre-1.13
+)
+
+// maxMetadataSize bounds how much of a metadata file inside a jar is read.
+const maxMetadataSize = 1 << 20
+
+// maxNestedJarSize bounds the size of jars bundled inside a mod that are
+// read to find the mods they provide.
+const maxNestedJarSize = 32 << 20
+
+// Dependency kinds, normalized across loaders.
+const (
+	DependencyRequired     = "required"
+	DependencyOptional     = "optional"
+	DependencyIncompatible = "incompatible" // the mods cannot be loaded together
+	DependencyConflict     = "conflict"     // loading both is discouraged
+)
+
+// ErrNoModMetadata is returned for jars without any known metadata file.
+var ErrNoModMetadata = errors.New("no mod metadata found")
+
+// ModMetadata describes a mod as declared in its jar.
+type ModMetadata struct {
+	ModID            string   `json:"modId"`
+	Name             string   `json:"name"`
+	Version          string   `json:"version,omitempty"`
+	Loader           string   `json:"loader"`
+	Authors          []string `json:"authors,omitempty"`
+	Description      string   `json:"description,omitempty"`
+	MinecraftVersion string   `json:"minecraftVersion,omitempty"` // declared version range, loader syntax
+	Icon             string   `json:"icon,omitempty"`             // path of the icon inside the jar
+	Side             string   `json:"side,omitempty"`             // declared side (client, server, both); empty if unknown
+
+	// Dependencies lists the declared relations to other mods, including
+	// Minecraft and the loader itself.
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// Provides maps additional mod IDs this jar satisfies, e.g. aliases and
+	// bundled jar-in-jar mods, to their versions (empty if unknown).
+	Provides map[string]string `json:"provides,omitempty"`
+
+	nested []string // paths of bundled jars, resolved by ReadJarMetadata
+}
+
+// Dependency is a relation of a mod to another mod.
+type Dependency struct {
+	ModID string `json:"modId"`
+	Kind  string `json:"kind"`
+	// Versions is the accepted version range in the syntax of the declaring
+	// mod's loader; alternatives are separated by " || ". Empty means any.
+	Versions string `json:"versions,omitempty"`
+}
+
+// ReadJarMetadata opens the jar at path and extracts its mod metadata.
+func ReadJarMetadata(path string) (*ModMetadata, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	meta, err := parseJar(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	addNestedMods(&zr.Reader, meta)
+	return meta, nil
+}
+
+// addNestedMods reads the jars bundled inside a mod (jar-in-jar) and records
+// the mods they contain in meta.Provides. Unreadable jars are ignored.
+func addNestedMods(zr *zip.Reader, meta *ModMetadata) {
+	if len(meta.nested) == 0 {
+		return
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range meta.nested {
+		f, ok := files[strings.TrimPrefix(name, "/")]
+		if !ok || f.UncompressedSize64 > maxNestedJarSize {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxNestedJarSize))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		inner, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			continue
+		}
+		nested, err := parseJar(inner)
+		if err != nil || nested.ModID == "" {
+			continue
+		}
+		meta.provide(nested.ModID, nested.Version)
+		for id, version := range nested.Provides {
+			meta.provide(id, version)
+		}
+	}
+}
+
+// provide records that the mod also provides id at version.
+func (m *ModMetadata) provide(id, version string) {
+	if id == "" || id == m.ModID {
+		return
+	}
+	if m.Provides == nil {
+		m.Provides = make(map[string]string)
+	}
+	m.Provides[id] = version
+}
+
+// parseJar tries each supported metadata format in order of specificity.
+func parseJar(zr *zip.Reader) (*ModMetadata, error) {
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	parsers := []struct {
+		name  string
+		parse func(data []byte, files map[string]*zip.File) (*ModMetadata, error)
+	}{
+		{"quilt.mod.json", parseQuilt},
+		{"fabric.mod.json", parseFabric},
+		{"META-INF/neoforge.mods.toml", func(data []byte, files map[string]*zip.File) (*ModMetadata, error) {
+			return parseModsToml(data, files, LoaderNeoForge)
+		}},
+		{"META-INF/mods.toml", func(data []byte, files map[string]*zip.File) (*ModMetadata, error) {
+			return parseModsToml(data, files, LoaderForge)
+		}},
+		{"mcmod.info", parseMcmodInfo},
+	}
+
+	for _, p := range parsers {
+		f, ok := files[p.name]
+		if !ok {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p.name, err)
+		}
+		meta, err := p.parse(data, files)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p.name, err)
+		}
+		return meta, nil
+	}
+	return nil, ErrNoModMetadata
+}
+
+// readZipFile reads a file from a zip archive, bounded by maxMetadataSize.
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxMetadataSize))
+}
+
+// ReadJarIcon returns the icon declared in the jar's metadata.
+func ReadJarIcon(path string) ([]byte, string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer zr.Close()
+
+	meta, err := parseJar(&zr.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	if meta.Icon == "" {
+		return nil, "", ErrNoModMetadata
+	}
+	for _, f := range zr.File {
+		if f.Name == meta.Icon {
+			data, err := readZipFile(f)
+			return data, meta.Icon, err
+		}
+	}
+	return nil, "", fmt.Errorf("icon %s not found in jar", meta.Icon)
+}
+
+// --- Fabric ---
+
+type fabricModJSON struct {
+	ID          string                     `json:"id"`
+	Version     string                     `json:"version"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Authors     []json.RawMessage          `json:"authors"`
+	Icon        json.RawMessage            `json:"icon"`
+	Depends     map[string]json.RawMessage `json:"depends"`
+	Recommends  map[string]json.RawMessage `json:"recommends"`
+	Suggests    map[string]json.RawMessage `json:"suggests"`
+	Breaks      map[string]json.RawMessage `json:"breaks"`
+	Conflicts   map[string]json.RawMessage `json:"conflicts"`
+	Provides    []string                   `json:"provides"`
+	Jars        []struct {
+		File string `json:"file"`
+	} `json:"jars"`
+	Environment string `json:"environment"`
+}
+
+func parseFabric(data []byte, _ map[string]*zip.File) (*ModMetadata, error) {
+	var m fabricModJSON
+	if err := json.Unmarshal(sanitizeJSON(data), &m); err != nil {
+		return nil, err
+	}
+	meta := &ModMetadata{
+		ModID:       m.ID,
+		Name:        m.Name,
+		Version:     m.Version,
+		Loader:      LoaderFabric,
+		Description: m.Description,
+		Icon:        parseFabricIcon(m.Icon),
+		Side:        environmentSide(m.Environment),
+	}
+	for _, a := range m.Authors {
+		if name := personName(a); name != "" {
+			meta.Authors = append(meta.Authors, name)
+		}
+	}
+	if mc, ok := m.Depends["minecraft"]; ok {
+		meta.MinecraftVersion = strings.Join(stringOrList(mc), " || ")
+	}
+	for _, rel := range []struct {
+		deps map[string]json.RawMessage
+		kind string
+	}{
+		{m.Depends, DependencyRequired},
+		{m.Recommends, DependencyOptional},
+		{m.Suggests, DependencyOptional},
+		{m.Breaks, DependencyIncompatible},
+		{m.Conflicts, DependencyConflict},
+	} {
+		ids := make([]string, 0, len(rel.deps))
+		for id := range rel.deps {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			meta.Dependencies = append(meta.Dependencies, Dependency{
+				ModID:    id,
+				Kind:     rel.kind,
+				Versions: strings.Join(stringOrList(rel.deps[id]), " || "),
+			})
+		}
+	}
+	for _, id := range m.Provides {
+		meta.provide(id, m.Version)
+	}
+	for _, jar := range m.Jars {
+		meta.nested = append(meta.nested, jar.File)
+	}
+	return meta.normalize(), nil
+}
+
+// environmentSide maps a fabric/quilt environment ("client", "server",
+// "dedicated_server" or "*") to a side.
+func environmentSide(env string) string {
+	switch env {
+	case "client":
+		return SideClient
+	case "server", "dedicated_server":
+		return SideServer
+	case "*":
+		return SideBoth
+	}
+	return ""
+}
+
+// parseFabricIcon handles both "icon": "path" and "icon": {"16": "path", ...},
+// preferring the largest size.
+func parseFabricIcon(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimPrefix(s, "/")
+	}
+	var sizes map[string]string
+	if json.Unmarshal(raw, &sizes) != nil {
+		return ""
+	}
+	best, bestSize := "", -1
+	for size, p := range sizes {
+		var n int
+		fmt.Sscanf(size, "%d", &n)
+		if n > bestSize {
+			best, bestSize = p, n
+		}
+	}
+	return strings.TrimPrefix(best, "/")
+}
+
+// personName accepts either "Name" or {"name": "Name", ...}.
+func personName(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(raw, &obj) == nil {
+		return obj.Name
+	}
+	return ""
+}
+
+// stringOrList accepts either "x" or ["x", "y"].
+func stringOrList(raw json.RawMessage) []string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []string{s}
+	}
+	var list []string
+	json.Unmarshal(raw, &list)
+	return list
+}
+
+// sanitizeJSON replaces raw control characters, which some mods include in
+// fabric.mod.json strings even though they are invalid JSON.
+func sanitizeJSON(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			b = ' '
+		}
+		out[i] = b
+	}
+	return out
+}
+
+// --- Quilt ---
+
+type quiltModJSON struct {
+	QuiltLoader struct {
+		ID       string `json:"id"`
+		Version  string `json:"version"`
+		Metadata struct {
+			Name         string            `json:"name"`
+			Description  string            `json:"description"`
+			Contributors map[string]string `json:"contributors"`
+			Icon         json.RawMessage   `json:"icon"`
+		} `json:"metadata"`
+		Depends  []json.RawMessage `json:"depends"`
+		Breaks   []json.RawMessage `json:"breaks"`
+		Provides []json.RawMessage `json:"provides"`
+		Jars     []string          `json:"jars"`
+	} `json:"quilt_loader"`
+	Minecraft struct {
+		Environment string `json:"environment"`
+	} `json:"minecraft"`
+}
+
+// quiltDependency is the object form of a quilt dependency entry.
+type quiltDependency struct {
+	ID       string          `json:"id"`
+	Versions json.RawMessage `json:"versions"`
+	Optional bool            `json:"optional"`
+}
+
+func parseQuilt(data []byte, _ map[string]*zip.File) (*ModMetadata, error) {
+	var m quiltModJSON
+	if err := json.Unmarshal(sanitizeJSON(data), &m); err != nil {
+		return nil, err
+	}
+	ql := m.QuiltLoader
+	meta := &ModMetadata{
+		ModID:       ql.ID,
+		Name:        ql.Metadata.Name,
+		Version:     ql.Version,
+		Loader:      LoaderQuilt,
+		Description: ql.Metadata.Description,
+		Icon:        parseFabricIcon(ql.Metadata.Icon),
+		Side:        environmentSide(m.Minecraft.Environment),
+	}
+	for name := range ql.Metadata.Contributors {
+		meta.Authors = append(meta.Authors, name)
+	}
+	sort.Strings(meta.Authors)
+	for _, raw := range ql.Depends {
+		dep := parseQuiltDependency(raw)
+		versions := quiltVersions(dep.Versions)
+		if dep.ID == "minecraft" {
+			meta.MinecraftVersion = versions
+		}
+		kind := DependencyRequired
+		if dep.Optional {
+			kind = DependencyOptional
+		}
+		meta.Dependencies = append(meta.Dependencies, Dependency{ModID: quiltModID(dep.ID), Kind: kind, Versions: versions})
+	}
+	for _, raw := range ql.Breaks {
+		dep := parseQuiltDependency(raw)
+		meta.Dependencies = append(meta.Dependencies, Dependency{ModID: quiltModID(dep.ID), Kind: DependencyIncompatible, Versions: quiltVersions(dep.Versions)})
+	}
+	for _, raw := range ql.Provides {
+		var id string
+		if json.Unmarshal(raw, &id) == nil {
+			meta.provide(id, ql.Version)
+			continue
+		}
+		var p struct {
+			ID      string `json:"id"`
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(raw, &p) == nil {
+			if p.Version == "" {
+				p.Version = ql.Version
+			}
+			meta.provide(quiltModID(p.ID), p.Version)
+		}
+	}
+	meta.nested = append(meta.nested, ql.Jars...)
+	return meta.normalize(), nil
+}
+
+// quiltModID strips the optional maven group from a quilt mod ID ("group:id").
+func quiltModID(id string) string {
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		return id[i+1:]
+	}
+	return id
+}
+
+// quiltVersions flattens a quilt version specifier, which is a string, a list
+// of alternatives or an {"any": [...]} / {"all": [...]} object.
+func quiltVersions(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var obj struct {
+		Any []json.RawMessage `json:"any"`
+		All []json.RawMessage `json:"all"`
+	}
+	if json.Unmarshal(raw, &obj) == nil && (obj.Any != nil || obj.All != nil) {
+		var parts []string
+		for _, r := range obj.Any {
+			parts = append(parts, quiltVersions(r))
+		}
+		if len(obj.All) > 0 {
+			var all []string
+			for _, r := range obj.All {
+				all = append(all, quiltVersions(r))
+			}
+			parts = append(parts, strings.Join(all, " "))
+		}
+		return strings.Join(parts, " || ")
+	}
+	return strings.Join(stringOrList(raw), " || ")
+}
+
+// parseQuiltDependency accepts either "modid" or {"id": "modid", ...}.
+func parseQuiltDependency(raw json.RawMessage) quiltDependency {
+	var dep quiltDependency
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		dep.ID = s
+		return dep
+	}
+	json.Unmarshal(raw, &dep)
+	return dep
+}
+
+// --- Forge / NeoForge ---
+
+type modsToml struct {
+	ModLoader     string `toml:"modLoader"`
+	LoaderVersion string `toml:"loaderVersion"`
+	LogoFile      string `toml:"logoFile"`
+	Authors       string `toml:"authors"`
+	// ClientSideOnly marks client-only mods on Forge 1.20.2+.
+	ClientSideOnly bool `toml:"clientSideOnly"`
+	Mods           []struct {
+		ModID       string `toml:"modId"`
+		Version     string `toml:"version"`
+		DisplayName string `toml:"displayName"`
+		Description string `toml:"description"`
+		Authors     string `toml:"authors"`
+		LogoFile    string `toml:"logoFile"`
+		DisplayTest string `toml:"displayTest"`
+	} `toml:"mods"`
+	Dependencies map[string][]modsTomlDependency `toml:"dependencies"`
+}
+
+type modsTomlDependency struct {
+	ModID        string `toml:"modId"`
+	Mandatory    *bool  `toml:"mandatory"` // Forge
+	Type         string `toml:"type"`      // NeoForge: required, optional, incompatible, discouraged
+	VersionRange string `toml:"versionRange"`
+	Side         string `toml:"side"`
+}
+
+func parseModsToml(data []byte, files map[string]*zip.File, loader string) (*ModMetadata, error) {
+	var m modsToml
+	if _, err := toml.Decode(string(data), &m); err != nil {
+		return nil, err
+	}
+	if len(m.Mods) == 0 {
+		return nil, fmt.Errorf("no [[mods]] entry")
+	}
+	mod := m.Mods[0]
+
+	meta := &ModMetadata{
+		ModID:       mod.ModID,
+		Name:        mod.DisplayName,
+		Version:     mod.Version,
+		Loader:      loader,
+		Description: strings.TrimSpace(mod.Description),
+		Icon:        mod.LogoFile,
+	}
+	if meta.Icon == "" {
+		meta.Icon = m.LogoFile
+	}
+	authors := mod.Authors
+	if authors == "" {
+		authors = m.Authors
+	}
+	meta.Authors = splitAuthors(authors)
+
+	// Versions are often filled in from the manifest at build time.
+	if strings.Contains(meta.Version, "${file.jarVersion}") {
+		meta.Version = manifestVersion(files)
+	}
+
+	for _, dep := range m.Dependencies[mod.ModID] {
+		if dep.ModID == "minecraft" {
+			meta.MinecraftVersion = dep.VersionRange
+		}
+		meta.Dependencies = append(meta.Dependencies, Dependency{
+			ModID:    dep.ModID,
+			Kind:     dep.kind(),
+			Versions: dep.VersionRange,
+		})
+	}
+	// Further [[mods]] entries in the same jar are provided by it.
+	for _, other := range m.Mods[1:] {
+		meta.provide(other.ModID, other.Version)
+	}
+	meta.nested = jarJarPaths(files)
+	meta.Side = modsTomlSide(&m, mod.ModID, mod.DisplayTest)
+	return meta.normalize(), nil
+}
+
+// kind maps Forge's mandatory flag and NeoForge's type to a dependency kind.
+func (d modsTomlDependency) kind() string {
+	switch strings.ToLower(d.Type) {
+	case "required":
+		return DependencyRequired
+	case "optional":
+		return DependencyOptional
+	case "incompatible":
+		return DependencyIncompatible
+	case "discouraged":
+		return DependencyConflict
+	}
+	if d.Mandatory != nil && !*d.Mandatory {
+		return DependencyOptional
+	}
+	return DependencyRequired
+}
+
+// jarJarPaths lists the jars bundled through Forge's jar-in-jar system.
+func jarJarPaths(files map[string]*zip.File) []string {
+	f, ok := files["META-INF/jarjar/metadata.json"]
+	if !ok {
+		return nil
+	}
+	data, err := readZipFile(f)
+	if err != nil {
+		return nil
+	}
+	var meta struct {
+		Jars []struct {
+			Path string `json:"path"`
+		} `json:"jars"`
+	}
+	if json.Unmarshal(data, &meta) != nil {
+		return nil
+	}
+	var paths []string
+	for _, jar := range meta.Jars {
+		paths = append(paths, jar.Path)
+	}
+	return paths
+}
+
+// modsTomlSide derives the side of a Forge/NeoForge mod. There is no
+// dedicated field before clientSideOnly, so the side of the mod's dependency
+// on Minecraft or the loader is used, and a displayTest that ignores the
+// server version marks a server-only mod.
+func modsTomlSide(m *modsToml, modID, displayTest string) string {
+	if m.ClientSideOnly {
+		return SideClient
+	}
+	for _, dep := range m.Dependencies[modID] {
+		switch dep.ModID {
+		case "minecraft", "forge", "neoforge":
+			switch strings.ToUpper(dep.Side) {
+			case "CLIENT":
+				return SideClient
+			case "SERVER":
+				return SideServer
+			}
+		}
+	}
+	if displayTest == "IGNORE_SERVER_VERSION" {
+		return SideServer
+	}
+	return ""
+}
+
+// splitAuthors splits a free-form author string like "A, B and C".
+func splitAuthors(s string) []string {
+	s = strings.ReplaceAll(s, " and ", ",")
+	var authors []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			authors = append(authors, a)
+		}
+	}
+	return authors
+}
+
+// manifestVersion reads Implementation-Version from META-INF/MANIFEST.MF.
+func manifestVersion(files map[string]*zip.File) string {
+	f, ok := files["META-INF/MANIFEST.MF"]
+	if !ok {
+		return ""
+	}
+	data, err := readZipFile(f)
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "Implementation-Version:"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// --- Legacy Forge (mcmod.info) ---
+
+type mcmodInfoEntry struct {
+	ModID       string   `json:"modid"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	MCVersion   string   `json:"mcversion"`
+	Description string   `json:"description"`
+	AuthorList  []string `json:"authorList"`
+	Authors     []string `json:"authors"`
+	LogoFile    string   `json:"logoFile"`
+}
+
+func parseMcmodInfo(data []byte, _ map[string]*zip.File) (*ModMetadata, error) {
+	data = sanitizeJSON(data)
+
+	var entries []mcmodInfoEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var v2 struct {
+			ModList []mcmodInfoEntry `json:"modList"`
+		}
+		if err2 := json.Unmarshal(data, &v2); err2 != nil {
+			return nil, err
+		}
+		entries = v2.ModList
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("empty mod list")
+	}
+	e := entries[0]
+
+	meta := &ModMetadata{
+		ModID:            e.ModID,
+		Name:             e.Name,
+		Version:          e.Version,
+		Loader:           LoaderLegacyForge,
+		Description:      strings.TrimSpace(e.Description),
+		MinecraftVersion: e.MCVersion,
+		Icon:             strings.TrimPrefix(e.LogoFile, "/"),
+		Authors:          e.AuthorList,
+	}
+	if len(meta.Authors) == 0 {
+		meta.Authors = e.Authors
+	}
+	return meta.normalize(), nil
+}
+
+// normalize fills in defaults and drops unresolved build placeholders.
+func (m *ModMetadata) normalize() *ModMetadata {
+	if strings.Contains(m.Version, "${") {
+		m.Version = ""
+	}
+	if strings.Contains(m.MinecraftVersion, "${") {
+		m.MinecraftVersion = ""
+	}
+	if m.Name == "" {
+		m.Name = m.ModID
+	}
+	return m
+}
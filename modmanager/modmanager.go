@@ -19,22 +19,35 @@ const (
 
 // ModItem represents a file or directory in the mod structure.
 type ModItem struct {
-	Name     string      `json:"name"`
-	Path     string      `json:"path"`     // Relative path from the base mod directory
-	Type     ModItemType `json:"type"`
-	Size     int64       `json:"size,omitempty"` // For files
-	URL      string      `json:"url,omitempty"`  // For .url files
-	Markdown string      `json:"markdown,omitempty"` // For .md files content
-	Children []ModItem   `json:"children,omitempty"` // For directories
+	Name     string       `json:"name"`
+	Path     string       `json:"path"` // Relative path from the base mod directory
+	Type     ModItemType  `json:"type"`
+	Size     int64        `json:"size,omitempty"`     // For files
+	URL      string       `json:"url,omitempty"`      // For .url files
+	Markdown string       `json:"markdown,omitempty"` // For .md files content
+	HTML     string       `json:"html,omitempty"`     // For .md files, sanitized rendering of Markdown
+	Mod      *ModMetadata `json:"mod,omitempty"`      // For .jar files with mod metadata
+	Hashes   *FileHashes  `json:"hashes,omitempty"`   // For files, filled in by Index
+	Side     string       `json:"side,omitempty"`     // For files, filled in by ClassifyTree
+	Children []ModItem    `json:"children,omitempty"` // For directories
+
+	// Set from the .mcow.toml sidecar files, see DirConfig.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"` // URL of an image
+	Featured    bool   `json:"featured,omitempty"`
+	Hidden      bool   `json:"hidden,omitempty"` // Only set in Index.FullTree
+
+	// Filled in by CountDownloads, for directories the downloads of their zip.
+	Downloads int `json:"downloads,omitempty"`
 }
 
 // ScanModDirectory scans the mod directory for a given server and returns its hierarchical structure.
+// Entries are described, ordered and hidden according to the sidecar files
+// in each directory.
 func ScanModDirectory(baseDataPath, serverName string) (*ModItem, error) {
-	// Security check: simple allowlist for characters
-	for _, r := range serverName {
-		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_') {
-			return nil, fmt.Errorf("invalid server name: %s", serverName)
-		}
+	if !validServerName(serverName) {
+		return nil, fmt.Errorf("invalid server name: %s", serverName)
 	}
 
 	basePath := filepath.Join(baseDataPath, serverName)
@@ -50,16 +63,30 @@ func ScanModDirectory(baseDataPath, serverName string) (*ModItem, error) {
 		Type: TypeDir,
 	}
 
-	err := walkDir(basePath, "", root)
+	settings := rootSettings(serverName).enter(basePath, "")
+	settings.describeSelf(root)
+	err := walkDir(settings, basePath, "", root)
 	if err != nil {
 		return nil, fmt.Errorf("error walking mod directory for server %s: %w", serverName, err)
 	}
 
-	return root, nil
+	return VisibleTree(root), nil
+}
+
+// validServerName checks the server name against a simple allowlist of
+// characters so it is safe to use as a path component.
+func validServerName(serverName string) bool {
+	for _, r := range serverName {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
 }
 
 // walkDir recursively walks the directory and builds the ModItem tree.
-func walkDir(currentPath string, relativePath string, parent *ModItem) error {
+// Hidden entries are included and marked.
+func walkDir(settings dirSettings, currentPath, relativePath string, parent *ModItem) error {
 	entries, err := os.ReadDir(currentPath)
 	if err != nil {
 		return err
@@ -74,7 +101,9 @@ func walkDir(currentPath string, relativePath string, parent *ModItem) error {
 
 		if entry.IsDir() {
 			item.Type = TypeDir
-			if err := walkDir(filepath.Join(currentPath, entry.Name()), itemPath, &item); err != nil {
+			sub := settings.enter(filepath.Join(currentPath, entry.Name()), itemPath)
+			sub.describeSelf(&item)
+			if err := walkDir(sub, filepath.Join(currentPath, entry.Name()), itemPath, &item); err != nil {
 				return err
 			}
 		} else {
@@ -82,28 +111,54 @@ func walkDir(currentPath string, relativePath string, parent *ModItem) error {
 			if err != nil {
 				return err
 			}
-			item.Size = info.Size()
-
-			switch {
-			case strings.HasSuffix(entry.Name(), ".url"):
-				item.Type = TypeURL
-				content, err := os.ReadFile(filepath.Join(currentPath, entry.Name()))
-				if err != nil {
-					return fmt.Errorf("failed to read .url file %s: %w", itemPath, err)
-				}
-				item.URL = strings.TrimSpace(string(content))
-			case strings.HasSuffix(entry.Name(), ".md"):
-				item.Type = TypeMD
-				content, err := os.ReadFile(filepath.Join(currentPath, entry.Name()))
-				if err != nil {
-					return fmt.Errorf("failed to read .md file %s: %w", itemPath, err)
-				}
-				item.Markdown = string(content)
-			default:
-				item.Type = TypeFile
+			if item, err = fileItem(settings.server, filepath.Join(currentPath, entry.Name()), itemPath, info); err != nil {
+				return err
 			}
 		}
+		item.Hidden = settings.hidden(entry.Name(), entry.IsDir())
+		settings.describeEntry(&item)
 		parent.Children = append(parent.Children, item)
 	}
+	settings.sort(parent.Children)
 	return nil
 }
+
+// fileItem builds the ModItem for a single file of a server, reading the
+// contents of .url and .md files and the metadata of .jar files. Markdown is
+// rendered here, so the HTML is cached with the item by the Index.
+func fileItem(serverName, fullPath, itemPath string, info os.FileInfo) (ModItem, error) {
+	item := ModItem{
+		Name: info.Name(),
+		Path: itemPath,
+		Size: info.Size(),
+	}
+
+	switch {
+	case strings.HasSuffix(item.Name, ".url"):
+		item.Type = TypeURL
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return item, fmt.Errorf("failed to read .url file %s: %w", itemPath, err)
+		}
+		item.URL = strings.TrimSpace(string(content))
+	case strings.HasSuffix(item.Name, ".md"):
+		item.Type = TypeMD
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return item, fmt.Errorf("failed to read .md file %s: %w", itemPath, err)
+		}
+		item.Markdown = string(content)
+		if item.HTML, err = RenderMarkdownFile(content, serverName, filepath.ToSlash(itemPath)); err != nil {
+			return item, fmt.Errorf("failed to render .md file %s: %w", itemPath, err)
+		}
+	case strings.HasSuffix(item.Name, ".jar"):
+		item.Type = TypeFile
+		// Jars without (valid) metadata are still listed as plain files.
+		if meta, err := ReadJarMetadata(fullPath); err == nil {
+			item.Mod = meta
+		}
+	default:
+		item.Type = TypeFile
+	}
+	return item, nil
+}
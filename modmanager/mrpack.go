@@ -0,0 +1,237 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Environment support values used in the Modrinth index.
+const (
+	EnvRequired    = "required"
+	EnvOptional    = "optional"
+	EnvUnsupported = "unsupported"
+)
+
+// MrpackIndex is the modrinth.index.json of a Modrinth modpack.
+type MrpackIndex struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	VersionID     string            `json:"versionId"`
+	Name          string            `json:"name"`
+	Summary       string            `json:"summary,omitempty"`
+	Files         []MrpackFile      `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+// MrpackFile is a downloadable file entry in the Modrinth index.
+type MrpackFile struct {
+	Path      string            `json:"path"`
+	Hashes    map[string]string `json:"hashes"`
+	Env       map[string]string `json:"env,omitempty"`
+	Downloads []string          `json:"downloads"`
+	FileSize  int64             `json:"fileSize"`
+}
+
+// MrpackDependencyKeys are the dependency identifiers allowed in a Modrinth index.
+var MrpackDependencyKeys = []string{"minecraft", "forge", "neoforge", "fabric-loader", "quilt-loader"}
+
+// MrpackOptions describes the pack being exported.
+type MrpackOptions struct {
+	Name         string
+	Summary      string
+	VersionID    string
+	Dependencies map[string]string
+	// DownloadURL returns the absolute download URL for a file, given its
+	// slash-separated path relative to the exported directory.
+	DownloadURL func(rel string) string
+	// SideOf returns the side of a file given its slash-separated path, used
+	// for the env field and client/server overrides. All files are treated
+	// as needed on both sides if nil.
+	SideOf func(rel string) string
+	// Side limits the pack to files needed on that side if set.
+	Side string
+}
+
+// side returns the side of rel according to SideOf.
+func (o MrpackOptions) side(rel string) string {
+	if o.SideOf == nil {
+		return SideBoth
+	}
+	if side := o.SideOf(rel); side != "" {
+		return side
+	}
+	return SideBoth
+}
+
+// mrpackEnv returns the env field of a file needed on side.
+func mrpackEnv(side string) map[string]string {
+	switch side {
+	case SideClient:
+		return map[string]string{"client": EnvRequired, "server": EnvUnsupported}
+	case SideServer:
+		return map[string]string{"client": EnvUnsupported, "server": EnvRequired}
+	}
+	return map[string]string{"client": EnvRequired, "server": EnvRequired}
+}
+
+// mrpackOverrideDirs maps sides to the override folders of the Modrinth format.
+var mrpackOverrideDirs = map[string]string{
+	SideBoth:   "overrides/",
+	SideClient: "client-overrides/",
+	SideServer: "server-overrides/",
+}
+
+// packContentDirs are the top-level directories whose jars and zips are
+// referenced by download URL rather than bundled as overrides.
+var packContentDirs = map[string]bool{
+	"mods":          true,
+	"resourcepacks": true,
+	"shaderpacks":   true,
+}
+
+// isPackDownload reports whether rel should be listed as a download in the index.
+func isPackDownload(rel string) bool {
+	top, _, found := strings.Cut(rel, "/")
+	if !found || !packContentDirs[top] {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(rel))
+	return ext == ".jar" || ext == ".zip"
+}
+
+// isPackExcluded reports whether rel is left out of the pack entirely:
+// browser helper files and pre-built archives in the root directory. Hidden
+// and sidecar files never reach it, walkArchiveFiles skips them.
+func isPackExcluded(rel string) bool {
+	name := path.Base(rel)
+	if isHelperFile(name) {
+		return true
+	}
+	if !strings.Contains(rel, "/") {
+		ext := strings.ToLower(path.Ext(name))
+		return ext == ".zip" || ext == ".mrpack"
+	}
+	return false
+}
+
+// BuildMrpackIndex builds the Modrinth index for dir. Files in mods/,
+// resourcepacks/ and shaderpacks/ are referenced by URL; all other files
+// are returned as overrides to be bundled inside the pack, keyed by their
+// override folder.
+func BuildMrpackIndex(dir string, hasher *Hasher, opts MrpackOptions) (*MrpackIndex, map[string][]string, error) {
+	index := &MrpackIndex{
+		FormatVersion: 1,
+		Game:          "minecraft",
+		VersionID:     opts.VersionID,
+		Name:          opts.Name,
+		Summary:       opts.Summary,
+		Files:         []MrpackFile{},
+		Dependencies:  opts.Dependencies,
+	}
+	overrides := make(map[string][]string)
+
+	err := walkArchiveFiles(dir, ZipOptions{}, func(p, rel string, info fs.FileInfo) error {
+		if isPackExcluded(rel) {
+			return nil
+		}
+		side := opts.side(rel)
+		if !SideIncludes(opts.Side, side) {
+			return nil
+		}
+		if !isPackDownload(rel) {
+			folder := mrpackOverrideDirs[side]
+			if folder == "" {
+				folder = mrpackOverrideDirs[SideBoth]
+			}
+			overrides[folder] = append(overrides[folder], rel)
+			return nil
+		}
+
+		hashes, err := hasher.Hash(p)
+		if err != nil {
+			return err
+		}
+		index.Files = append(index.Files, MrpackFile{
+			Path:      rel,
+			Hashes:    map[string]string{"sha1": hashes.SHA1, "sha512": hashes.SHA512},
+			Env:       mrpackEnv(side),
+			Downloads: []string{opts.DownloadURL(rel)},
+			FileSize:  info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return index, overrides, nil
+}
+
+// WriteMrpack streams a .mrpack archive of dir to w.
+func WriteMrpack(w io.Writer, dir string, hasher *Hasher, opts MrpackOptions) error {
+	index, overrides, err := BuildMrpackIndex(dir, hasher, opts)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "modrinth.index.json",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(index); err != nil {
+		return err
+	}
+
+	for _, folder := range []string{mrpackOverrideDirs[SideBoth], mrpackOverrideDirs[SideClient], mrpackOverrideDirs[SideServer]} {
+		for _, rel := range overrides[folder] {
+			if err := addZipFile(zw, dir, rel, folder+rel); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// addZipFile copies the file rel below dir into the zip under name.
+// Already compressed files such as jars are stored as-is.
+func addZipFile(zw *zip.Writer, dir, rel, name string) error {
+	full := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	if isCompressed(rel) {
+		header.Method = zip.Store
+	}
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(entry, f)
+	return err
+}
@@ -0,0 +1,200 @@
+package modmanager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// packwizFormat is the pack-format written to pack.toml.
+const packwizFormat = "packwiz:1.1.0"
+
+// PackwizOptions describes the pack being generated.
+type PackwizOptions struct {
+	Name    string
+	Author  string
+	Version string
+	// Versions maps packwiz component names (minecraft, fabric, quilt,
+	// forge, neoforge) to their versions.
+	Versions map[string]string
+	// DownloadURL returns the absolute download URL for a file, given its
+	// slash-separated path relative to the pack directory.
+	DownloadURL func(rel string) string
+	// SideOf returns the side of a file given its slash-separated path, used
+	// for the side of metafiles. Metafiles default to "both" if nil.
+	SideOf func(rel string) string
+	// Files are the indexed files by slash-separated path, see FileMap.
+	// Their hashes and mod metadata are used instead of reading the files
+	// again; files missing from it are read.
+	Files map[string]*ModItem
+}
+
+// PackwizPack is a generated packwiz pack. All paths are slash-separated and
+// relative to the location of pack.toml.
+type PackwizPack struct {
+	PackToml  []byte
+	IndexToml []byte
+	// MetaFiles holds the generated .pw.toml files by path.
+	MetaFiles map[string][]byte
+	// Files lists the plain files served as-is from the pack directory.
+	Files map[string]bool
+}
+
+type packwizPackToml struct {
+	Name       string            `toml:"name"`
+	Author     string            `toml:"author,omitempty"`
+	Version    string            `toml:"version,omitempty"`
+	PackFormat string            `toml:"pack-format"`
+	Index      packwizIndexRef   `toml:"index"`
+	Versions   map[string]string `toml:"versions"`
+}
+
+type packwizIndexRef struct {
+	File       string `toml:"file"`
+	HashFormat string `toml:"hash-format"`
+	Hash       string `toml:"hash"`
+}
+
+type packwizIndexToml struct {
+	HashFormat string             `toml:"hash-format"`
+	Files      []packwizIndexFile `toml:"files"`
+}
+
+type packwizIndexFile struct {
+	File     string `toml:"file"`
+	Hash     string `toml:"hash"`
+	Metafile bool   `toml:"metafile,omitempty"`
+}
+
+type packwizMetaToml struct {
+	Name     string          `toml:"name"`
+	Filename string          `toml:"filename"`
+	Side     string          `toml:"side"`
+	Download packwizDownload `toml:"download"`
+}
+
+type packwizDownload struct {
+	URL        string `toml:"url"`
+	HashFormat string `toml:"hash-format"`
+	Hash       string `toml:"hash"`
+}
+
+// packwizMetaPath returns the .pw.toml path describing the file rel.
+func packwizMetaPath(rel string) string {
+	return strings.TrimSuffix(rel, path.Ext(rel)) + ".pw.toml"
+}
+
+// BuildPackwiz generates a packwiz pack for dir. Jars and zips in mods/,
+// resourcepacks/ and shaderpacks/ become .pw.toml metafiles pointing at
+// their download URL; all other files are listed in the index and served
+// directly.
+func BuildPackwiz(dir string, hasher *Hasher, opts PackwizOptions) (*PackwizPack, error) {
+	pack := &PackwizPack{
+		MetaFiles: make(map[string][]byte),
+		Files:     make(map[string]bool),
+	}
+	index := packwizIndexToml{HashFormat: "sha256"}
+
+	err := walkArchiveFiles(dir, ZipOptions{}, func(p, rel string, _ fs.FileInfo) error {
+		if isPackExcluded(rel) {
+			return nil
+		}
+		item := opts.Files[rel]
+		var hashes FileHashes
+		if item != nil && item.Hashes != nil {
+			hashes = *item.Hashes
+		} else {
+			var err error
+			if hashes, err = hasher.Hash(p); err != nil {
+				return err
+			}
+		}
+
+		if !isPackDownload(rel) {
+			pack.Files[rel] = true
+			index.Files = append(index.Files, packwizIndexFile{File: rel, Hash: hashes.SHA256})
+			return nil
+		}
+
+		side := SideBoth
+		if opts.SideOf != nil && opts.SideOf(rel) != "" {
+			side = opts.SideOf(rel)
+		}
+		name := path.Base(rel)
+		var meta *ModMetadata
+		if item != nil {
+			meta = item.Mod
+		} else if m, err := ReadJarMetadata(p); err == nil {
+			meta = m
+		}
+		if meta != nil && meta.Name != "" {
+			name = meta.Name
+		}
+		data, err := encodeToml(packwizMetaToml{
+			Name:     name,
+			Filename: path.Base(rel),
+			Side:     side,
+			Download: packwizDownload{
+				URL:        opts.DownloadURL(rel),
+				HashFormat: "sha512",
+				Hash:       hashes.SHA512,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		metaPath := packwizMetaPath(rel)
+		pack.MetaFiles[metaPath] = data
+		index.Files = append(index.Files, packwizIndexFile{File: metaPath, Hash: sha256Hex(data), Metafile: true})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if pack.IndexToml, err = encodeToml(index); err != nil {
+		return nil, err
+	}
+
+	versions := opts.Versions
+	if versions == nil {
+		versions = map[string]string{}
+	}
+	pack.PackToml, err = encodeToml(packwizPackToml{
+		Name:       opts.Name,
+		Author:     opts.Author,
+		Version:    opts.Version,
+		PackFormat: packwizFormat,
+		Index: packwizIndexRef{
+			File:       "index.toml",
+			HashFormat: "sha256",
+			Hash:       sha256Hex(pack.IndexToml),
+		},
+		Versions: versions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+func encodeToml(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
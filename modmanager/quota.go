@@ -0,0 +1,147 @@
+package modmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors returned when a write would break a server's quota or upload policy.
+var (
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrFileTooLarge        = errors.New("file too large")
+	ErrExtensionNotAllowed = errors.New("file type not allowed")
+)
+
+// Quota limits what may be stored in a server's mod directory. Zero values
+// mean unlimited.
+type Quota struct {
+	MaxBytes    int64    `json:"maxBytes,omitempty"`    // total size of all files
+	MaxFiles    int      `json:"maxFiles,omitempty"`    // number of files
+	MaxFileSize int64    `json:"maxFileSize,omitempty"` // size of a single file
+	Extensions  []string `json:"extensions,omitempty"`  // allowed extensions without dot, e.g. "jar" or "tar.gz"
+}
+
+// Usage is the space used by a server's mod directory.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// ParseExtensions parses a comma or space separated list of extensions,
+// with or without leading dots.
+func ParseExtensions(s string) []string {
+	var exts []string
+	seen := make(map[string]bool)
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+		ext := strings.ToLower(strings.TrimLeft(f, "."))
+		if ext != "" && !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// Limited reports whether the total size or number of files is limited.
+func (q Quota) Limited() bool {
+	return q.MaxBytes > 0 || q.MaxFiles > 0
+}
+
+// AllowsName reports whether a file with this name may be stored. Sidecar
+// files are always allowed.
+func (q Quota) AllowsName(name string) bool {
+	if len(q.Extensions) == 0 || name == DirConfigFile || name == IgnoreFile {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range q.Extensions {
+		if strings.HasSuffix(lower, "."+ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFile checks a single file against the extension and file size policy.
+func (q Quota) CheckFile(name string, size int64) error {
+	if !q.AllowsName(name) {
+		return fmt.Errorf("%w: %s, allowed are .%s", ErrExtensionNotAllowed, name, strings.Join(q.Extensions, ", ."))
+	}
+	if q.MaxFileSize > 0 && size > q.MaxFileSize {
+		return fmt.Errorf("%w: %s is larger than %s", ErrFileTooLarge, name, FormatBytes(q.MaxFileSize))
+	}
+	return nil
+}
+
+// Check reports whether usage may grow by change. Changes that do not
+// increase the usage are always allowed, so a server above its quota can
+// still be cleaned up.
+func (q Quota) Check(usage, change Usage) error {
+	if q.MaxBytes > 0 && change.Bytes > 0 && usage.Bytes+change.Bytes > q.MaxBytes {
+		return fmt.Errorf("%w: adding %s would exceed the limit of %s (%s used)", ErrQuotaExceeded, FormatBytes(change.Bytes), FormatBytes(q.MaxBytes), FormatBytes(usage.Bytes))
+	}
+	if q.MaxFiles > 0 && change.Files > 0 && usage.Files+change.Files > q.MaxFiles {
+		return fmt.Errorf("%w: adding %d file(s) would exceed the limit of %d files (%d used)", ErrQuotaExceeded, change.Files, q.MaxFiles, usage.Files)
+	}
+	return nil
+}
+
+// CheckPath checks every file at path, a file or directory about to be
+// stored under the name name, against the policy and returns their usage.
+func (q Quota) CheckPath(path, name string) (Usage, error) {
+	var usage Usage
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		fileName := info.Name()
+		if p == path {
+			fileName = name
+		}
+		if err := q.CheckFile(fileName, info.Size()); err != nil {
+			return err
+		}
+		usage.Bytes += info.Size()
+		usage.Files++
+		return nil
+	})
+	return usage, err
+}
+
+// TreeUsage returns the total size and number of files in a mod tree.
+func TreeUsage(root *ModItem) Usage {
+	var usage Usage
+	var walk func(item *ModItem)
+	walk = func(item *ModItem) {
+		if item.Type != TypeDir {
+			usage.Bytes += item.Size
+			usage.Files++
+			return
+		}
+		for i := range item.Children {
+			walk(&item.Children[i])
+		}
+	}
+	walk(root)
+	return usage
+}
+
+// FormatBytes formats a size in bytes for messages, e.g. "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
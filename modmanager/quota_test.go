@@ -0,0 +1,157 @@
+package modmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"jar", []string{"jar"}},
+		{".jar, .zip", []string{"jar", "zip"}},
+		{"JAR zip\ntoml\r\n\ttar.gz", []string{"jar", "zip", "toml", "tar.gz"}},
+		{"jar,,jar, .JAR", []string{"jar"}},
+		{" , . ", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseExtensions(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseExtensions(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuotaCheckFile(t *testing.T) {
+	q := Quota{MaxFileSize: 100, Extensions: []string{"jar", "tar.gz"}}
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr error
+	}{
+		{"mod.jar", 100, nil},
+		{"MOD.JAR", 10, nil},
+		{"pack.tar.gz", 10, nil},
+		{"mod.jar", 101, ErrFileTooLarge},
+		{"mod.exe", 10, ErrExtensionNotAllowed},
+		{"jar", 10, ErrExtensionNotAllowed},
+		{"pack.gz", 10, ErrExtensionNotAllowed},
+		{DirConfigFile, 10, nil},
+		{IgnoreFile, 10, nil},
+		{DirConfigFile, 101, ErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		if err := q.CheckFile(tt.name, tt.size); !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("CheckFile(%q, %d) = %v, want %v", tt.name, tt.size, err, tt.wantErr)
+		}
+	}
+	if err := (Quota{}).CheckFile("anything.exe", 1<<40); err != nil {
+		t.Errorf("empty quota refused a file: %v", err)
+	}
+}
+
+func TestQuotaCheck(t *testing.T) {
+	q := Quota{MaxBytes: 1000, MaxFiles: 10}
+	tests := []struct {
+		name   string
+		usage  Usage
+		change Usage
+		ok     bool
+	}{
+		{"fits", Usage{Bytes: 500, Files: 5}, Usage{Bytes: 400, Files: 4}, true},
+		{"exactly full", Usage{Bytes: 500, Files: 5}, Usage{Bytes: 500, Files: 5}, true},
+		{"one byte over", Usage{Bytes: 500, Files: 5}, Usage{Bytes: 501, Files: 1}, false},
+		{"one file over", Usage{Bytes: 0, Files: 10}, Usage{Bytes: 0, Files: 1}, false},
+		{"replacing with a smaller file", Usage{Bytes: 1000, Files: 10}, Usage{Bytes: -100, Files: 0}, true},
+		{"replacing with a larger file", Usage{Bytes: 1000, Files: 10}, Usage{Bytes: 1, Files: 0}, false},
+		{"deleting above the quota", Usage{Bytes: 5000, Files: 50}, Usage{Bytes: -10, Files: -1}, true},
+		{"no change above the quota", Usage{Bytes: 5000, Files: 50}, Usage{}, true},
+		{"adding above the quota", Usage{Bytes: 5000, Files: 50}, Usage{Bytes: 1}, false},
+		{"more files while freeing space", Usage{Bytes: 500, Files: 10}, Usage{Bytes: -100, Files: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.Check(tt.usage, tt.change)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Check(%+v, %+v) = %v, want ok %t", tt.usage, tt.change, err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("Check() error = %v, want ErrQuotaExceeded", err)
+			}
+		})
+	}
+	if err := (Quota{}).Check(Usage{Bytes: 1 << 50, Files: 1 << 30}, Usage{Bytes: 1 << 40, Files: 1}); err != nil {
+		t.Errorf("unlimited quota refused a change: %v", err)
+	}
+}
+
+func TestQuotaCheckPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{"a.jar": 10, "sub/b.jar": 20, "sub/deeper/c.jar": 30} {
+		p := filepath.Join(dir, "pack", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := filepath.Join(dir, "upload.tmp")
+	if err := os.WriteFile(single, make([]byte, 5), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	q := Quota{MaxFileSize: 25, Extensions: []string{"jar"}}
+	if _, err := q.CheckPath(filepath.Join(dir, "pack"), "pack"); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("CheckPath with a too large file = %v, want ErrFileTooLarge", err)
+	}
+	q.MaxFileSize = 0
+	usage, err := q.CheckPath(filepath.Join(dir, "pack"), "pack")
+	if err != nil || usage != (Usage{Bytes: 60, Files: 3}) {
+		t.Errorf("CheckPath(dir) = %+v, %v, want 60 bytes in 3 files", usage, err)
+	}
+	// A single file is checked under the name it is stored as.
+	if usage, err := q.CheckPath(single, "mod.jar"); err != nil || usage != (Usage{Bytes: 5, Files: 1}) {
+		t.Errorf("CheckPath(file as mod.jar) = %+v, %v", usage, err)
+	}
+	if _, err := q.CheckPath(single, "upload.tmp"); !errors.Is(err, ErrExtensionNotAllowed) {
+		t.Errorf("CheckPath(file as upload.tmp) = %v, want ErrExtensionNotAllowed", err)
+	}
+}
+
+func TestTreeUsage(t *testing.T) {
+	root := &ModItem{Type: TypeDir, Children: []ModItem{
+		{Type: TypeFile, Size: 10},
+		{Type: TypeDir, Children: []ModItem{
+			{Type: TypeFile, Size: 20},
+			{Type: TypeDir},
+		}},
+	}}
+	if got := TreeUsage(root); got != (Usage{Bytes: 30, Files: 2}) {
+		t.Errorf("TreeUsage() = %+v, want 30 bytes in 2 files", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1 << 20, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
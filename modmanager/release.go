@@ -0,0 +1,252 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// BlobStore keeps file contents addressed by their SHA-256, so identical
+// files shared by many releases are stored only once.
+type BlobStore struct {
+	Dir string
+}
+
+// NewBlobStore creates a blob store rooted at dir.
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{Dir: dir}
+}
+
+// Path returns the location of the blob with the given SHA-256.
+func (s *BlobStore) Path(sha string) string {
+	if len(sha) < 3 {
+		return filepath.Join(s.Dir, "objects", sha)
+	}
+	return filepath.Join(s.Dir, "objects", sha[:2], sha[2:])
+}
+
+// Has reports whether the blob exists with the expected size.
+func (s *BlobStore) Has(sha string, size int64) bool {
+	info, err := os.Stat(s.Path(sha))
+	return err == nil && info.Size() == size
+}
+
+// Open opens a blob for reading.
+func (s *BlobStore) Open(sha string) (*os.File, error) {
+	return os.Open(s.Path(sha))
+}
+
+// Put copies the file at path into the store and returns its SHA-256 and
+// size as actually stored. The hash is always computed from the copied
+// data, never taken from the index, which may lag behind changes to the
+// file.
+func (s *BlobStore) Put(path string) (string, int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	tmpDir := filepath.Join(s.Dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "blob-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	sha := hex.EncodeToString(h.Sum(nil))
+	if s.Has(sha, size) {
+		return sha, size, nil
+	}
+	dest := s.Path(sha)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", 0, err
+	}
+	return sha, size, nil
+}
+
+// SnapshotFile is a file captured in a release.
+type SnapshotFile struct {
+	Path       string `json:"path"` // slash-separated, relative to the server directory
+	SHA256     string `json:"sha256"`
+	Size       int64  `json:"size"`
+	ModID      string `json:"modId,omitempty"`
+	ModName    string `json:"modName,omitempty"`
+	ModVersion string `json:"modVersion,omitempty"`
+}
+
+// Snapshot stores every file of the scanned tree in the blob store and
+// returns the captured files sorted by path. basePath is the directory the
+// tree was scanned from. Hidden entries are skipped, so Index.FullTree can
+// be passed as well as Index.Tree.
+func Snapshot(basePath string, root *ModItem, store *BlobStore) ([]SnapshotFile, error) {
+	var files []SnapshotFile
+	var walk func(item *ModItem) error
+	walk = func(item *ModItem) error {
+		if item.Hidden {
+			return nil
+		}
+		if item.Type == TypeDir {
+			for i := range item.Children {
+				if err := walk(&item.Children[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		sha, size, err := store.Put(filepath.Join(basePath, item.Path))
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", item.Path, err)
+		}
+		f := SnapshotFile{Path: filepath.ToSlash(item.Path), SHA256: sha, Size: size}
+		if item.Mod != nil {
+			f.ModID, f.ModName, f.ModVersion = item.Mod.ModID, item.Mod.Name, item.Mod.Version
+		}
+		files = append(files, f)
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// ChangelogEntry describes a mod or file that changed between releases.
+type ChangelogEntry struct {
+	Name       string `json:"name"`
+	ModID      string `json:"modId,omitempty"`
+	Path       string `json:"path"`
+	OldVersion string `json:"oldVersion,omitempty"`
+	NewVersion string `json:"newVersion,omitempty"`
+}
+
+// Changelog lists what changed between two releases.
+type Changelog struct {
+	Added   []ChangelogEntry `json:"added"`
+	Removed []ChangelogEntry `json:"removed"`
+	Updated []ChangelogEntry `json:"updated"`
+}
+
+// Empty reports whether nothing changed.
+func (c *Changelog) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Updated) == 0
+}
+
+// changelogKey identifies a file across releases: mods by their ID, so a
+// renamed jar for a new version counts as an update, other files by path.
+func changelogKey(f SnapshotFile) string {
+	if f.ModID != "" {
+		return "mod:" + f.ModID
+	}
+	return "file:" + f.Path
+}
+
+// changelogEntry describes f for the changelog.
+func changelogEntry(f SnapshotFile) ChangelogEntry {
+	name := f.ModName
+	if name == "" {
+		name = f.Path
+	}
+	return ChangelogEntry{Name: name, ModID: f.ModID, Path: f.Path}
+}
+
+// BuildChangelog compares the files of two releases. prev is nil for the
+// first release, in which case everything counts as added.
+func BuildChangelog(prev, cur []SnapshotFile) *Changelog {
+	c := &Changelog{Added: []ChangelogEntry{}, Removed: []ChangelogEntry{}, Updated: []ChangelogEntry{}}
+
+	old := make(map[string]SnapshotFile, len(prev))
+	for _, f := range prev {
+		old[changelogKey(f)] = f
+	}
+	seen := make(map[string]bool, len(cur))
+
+	for _, f := range cur {
+		key := changelogKey(f)
+		if seen[key] {
+			continue // duplicate mod IDs are reported by the compatibility check
+		}
+		seen[key] = true
+
+		o, ok := old[key]
+		switch {
+		case !ok:
+			e := changelogEntry(f)
+			e.NewVersion = f.ModVersion
+			c.Added = append(c.Added, e)
+		case o.SHA256 != f.SHA256:
+			e := changelogEntry(f)
+			e.OldVersion, e.NewVersion = o.ModVersion, f.ModVersion
+			c.Updated = append(c.Updated, e)
+		}
+	}
+	for _, f := range prev {
+		if key := changelogKey(f); !seen[key] {
+			seen[key] = true
+			e := changelogEntry(f)
+			e.OldVersion = f.ModVersion
+			c.Removed = append(c.Removed, e)
+		}
+	}
+	return c
+}
+
+// WriteReleaseZip streams a zip of the release files from the blob store.
+func WriteReleaseZip(w io.Writer, store *BlobStore, files []SnapshotFile, opts ZipOptions) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if opts.SkipHelpers && isHelperFile(filepath.Base(f.Path)) {
+			continue
+		}
+		if err := addBlobToZip(zw, store, f); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addBlobToZip copies a release file into the zip.
+func addBlobToZip(zw *zip.Writer, store *BlobStore, f SnapshotFile) error {
+	blob, err := store.Open(f.SHA256)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	info, err := blob.Stat()
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: f.Path, Method: zip.Deflate, Modified: info.ModTime()}
+	if isCompressed(f.Path) {
+		header.Method = zip.Store
+	}
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, blob)
+	return err
+}
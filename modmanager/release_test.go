@@ -0,0 +1,156 @@
+package modmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildChangelog(t *testing.T) {
+	sodium5 := SnapshotFile{Path: "mods/sodium-0.5.jar", SHA256: "s5", ModID: "sodium", ModName: "Sodium", ModVersion: "0.5.8"}
+	sodium6 := SnapshotFile{Path: "mods/sodium-0.6.jar", SHA256: "s6", ModID: "sodium", ModName: "Sodium", ModVersion: "0.6.0"}
+	iris := SnapshotFile{Path: "mods/iris.jar", SHA256: "i1", ModID: "iris", ModName: "Iris", ModVersion: "1.7.0"}
+	config1 := SnapshotFile{Path: "config/sodium.json", SHA256: "c1"}
+	config2 := SnapshotFile{Path: "config/sodium.json", SHA256: "c2"}
+	readme := SnapshotFile{Path: "README.md", SHA256: "r1"}
+
+	tests := []struct {
+		name    string
+		prev    []SnapshotFile
+		cur     []SnapshotFile
+		added   []string
+		removed []string
+		updated []string // name old->new
+	}{
+		{
+			name:  "first release",
+			prev:  nil,
+			cur:   []SnapshotFile{sodium5, config1},
+			added: []string{"Sodium", "config/sodium.json"},
+		},
+		{
+			name: "unchanged",
+			prev: []SnapshotFile{sodium5, config1},
+			cur:  []SnapshotFile{sodium5, config1},
+		},
+		{
+			name:    "renamed jar of a new version is an update",
+			prev:    []SnapshotFile{sodium5},
+			cur:     []SnapshotFile{sodium6},
+			updated: []string{"Sodium 0.5.8->0.6.0"},
+		},
+		{
+			name:    "changed config",
+			prev:    []SnapshotFile{config1},
+			cur:     []SnapshotFile{config2},
+			updated: []string{"config/sodium.json ->"},
+		},
+		{
+			name:    "added and removed",
+			prev:    []SnapshotFile{sodium5, readme},
+			cur:     []SnapshotFile{sodium5, iris},
+			added:   []string{"Iris"},
+			removed: []string{"README.md"},
+		},
+		{
+			name:  "duplicate mod IDs are listed once",
+			prev:  nil,
+			cur:   []SnapshotFile{sodium5, sodium6},
+			added: []string{"Sodium"},
+		},
+		{
+			name:    "everything removed",
+			prev:    []SnapshotFile{sodium5, config1},
+			cur:     nil,
+			removed: []string{"Sodium", "config/sodium.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := BuildChangelog(tt.prev, tt.cur)
+			names := func(entries []ChangelogEntry) []string {
+				var out []string
+				for _, e := range entries {
+					out = append(out, e.Name)
+				}
+				return out
+			}
+			var updated []string
+			for _, e := range c.Updated {
+				updated = append(updated, e.Name+" "+e.OldVersion+"->"+e.NewVersion)
+			}
+			if got := names(c.Added); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("added = %q, want %q", got, tt.added)
+			}
+			if got := names(c.Removed); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("removed = %q, want %q", got, tt.removed)
+			}
+			if !reflect.DeepEqual(updated, tt.updated) {
+				t.Errorf("updated = %q, want %q", updated, tt.updated)
+			}
+			if c.Empty() != (len(tt.added)+len(tt.removed)+len(tt.updated) == 0) {
+				t.Errorf("Empty() = %t", c.Empty())
+			}
+		})
+	}
+}
+
+func TestBuildChangelogVersions(t *testing.T) {
+	prev := []SnapshotFile{{Path: "mods/a.jar", SHA256: "1", ModID: "a", ModName: "A", ModVersion: "1.0"}}
+	cur := []SnapshotFile{{Path: "mods/b.jar", SHA256: "2", ModID: "b", ModName: "B", ModVersion: "2.0"}}
+	c := BuildChangelog(prev, cur)
+	if len(c.Added) != 1 || c.Added[0].NewVersion != "2.0" || c.Added[0].OldVersion != "" || c.Added[0].ModID != "b" {
+		t.Errorf("added = %+v", c.Added)
+	}
+	if len(c.Removed) != 1 || c.Removed[0].OldVersion != "1.0" || c.Removed[0].NewVersion != "" || c.Removed[0].Path != "mods/a.jar" {
+		t.Errorf("removed = %+v", c.Removed)
+	}
+}
+
+func TestSnapshotHashesCopiedContent(t *testing.T) {
+	dir := t.TempDir()
+	store := NewBlobStore(t.TempDir())
+	jar := filepath.Join(dir, "mods", "a.jar")
+	if err := os.MkdirAll(filepath.Dir(jar), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) string {
+		if err := os.WriteFile(jar, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	oldSum := write("old content")
+	root := &ModItem{Type: TypeDir, Children: []ModItem{
+		{Type: TypeDir, Path: "mods", Children: []ModItem{
+			{Type: TypeFile, Path: "mods/a.jar", Size: 11, Hashes: &FileHashes{SHA256: oldSum}},
+			{Type: TypeFile, Path: "mods/hidden.jar", Hidden: true},
+		}},
+	}}
+	if _, err := Snapshot(dir, root, store); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file changes in place with the same size before the index notices;
+	// the release must contain the new content, not the indexed hash.
+	newSum := write("new content")
+	files, err := Snapshot(dir, root, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SnapshotFile{{Path: "mods/a.jar", SHA256: newSum, Size: 11}}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Snapshot() = %+v, want %+v", files, want)
+	}
+	for sum, content := range map[string]string{oldSum: "old content", newSum: "new content"} {
+		got, err := os.ReadFile(store.Path(sum))
+		if err != nil || string(got) != content {
+			t.Errorf("blob %s = %q, %v, want %q", sum, got, err, content)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package modmanager
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Sides a file can be needed on.
+const (
+	SideBoth   = "both"
+	SideClient = "client"
+	SideServer = "server"
+)
+
+// clientOnlyDirs are top-level directories whose contents are only used by
+// the game client.
+var clientOnlyDirs = map[string]bool{
+	"resourcepacks": true,
+	"shaderpacks":   true,
+}
+
+// ValidSide reports whether side is one of the known sides.
+func ValidSide(side string) bool {
+	return side == SideBoth || side == SideClient || side == SideServer
+}
+
+// SideIncludes reports whether a file with the given side is needed on
+// target. An empty target includes everything.
+func SideIncludes(target, side string) bool {
+	return target == "" || side == "" || side == SideBoth || side == target
+}
+
+// fileSide determines the side of the file at rel (slash-separated, relative
+// to the server directory). Admin overrides take precedence over the side
+// declared in the mod metadata; everything else is needed on both sides.
+func fileSide(rel string, mod *ModMetadata, overrides map[string]string) string {
+	if side, ok := overrides[rel]; ok && ValidSide(side) {
+		return side
+	}
+	if top, _, found := strings.Cut(rel, "/"); found && clientOnlyDirs[top] {
+		return SideClient
+	}
+	if mod != nil && mod.Side != "" {
+		return mod.Side
+	}
+	return SideBoth
+}
+
+// ClassifyTree returns a copy of the tree with Side set on every file, using
+// overrides keyed by slash-separated path. The input tree is not modified.
+func ClassifyTree(root *ModItem, overrides map[string]string) *ModItem {
+	item := *root
+	if item.Type != TypeDir {
+		item.Side = fileSide(filepath.ToSlash(item.Path), item.Mod, overrides)
+		return &item
+	}
+	item.Children = make([]ModItem, 0, len(root.Children))
+	for i := range root.Children {
+		item.Children = append(item.Children, *ClassifyTree(&root.Children[i], overrides))
+	}
+	return &item
+}
+
+// FilterTree returns a copy of a classified tree with only the files needed
+// on side. Directories left empty by the filter are dropped.
+func FilterTree(root *ModItem, side string) *ModItem {
+	item := *root
+	item.Children = nil
+	for i := range root.Children {
+		child := &root.Children[i]
+		if child.Type != TypeDir {
+			if SideIncludes(side, child.Side) {
+				item.Children = append(item.Children, *child)
+			}
+			continue
+		}
+		if filtered := FilterTree(child, side); len(filtered.Children) > 0 || len(child.Children) == 0 {
+			item.Children = append(item.Children, *filtered)
+		}
+	}
+	return &item
+}
+
+// SideMap returns the side of every file in a classified tree, keyed by
+// slash-separated path.
+func SideMap(root *ModItem) map[string]string {
+	sides := make(map[string]string)
+	var walk func(item *ModItem)
+	walk = func(item *ModItem) {
+		if item.Type != TypeDir {
+			sides[filepath.ToSlash(item.Path)] = item.Side
+			return
+		}
+		for i := range item.Children {
+			walk(&item.Children[i])
+		}
+	}
+	walk(root)
+	return sides
+}
+
+// FileMap returns every file of a tree, keyed by slash-separated path.
+func FileMap(root *ModItem) map[string]*ModItem {
+	files := make(map[string]*ModItem)
+	var walk func(item *ModItem)
+	walk = func(item *ModItem) {
+		if item.Type != TypeDir {
+			files[filepath.ToSlash(item.Path)] = item
+			return
+		}
+		for i := range item.Children {
+			walk(&item.Children[i])
+		}
+	}
+	walk(root)
+	return files
+}
@@ -0,0 +1,339 @@
+package modmanager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Sidecar files configure how the entries of the directory they are in are
+// listed. They are never listed themselves.
+const (
+	DirConfigFile = ".mcow.toml"
+	IgnoreFile    = ".mcowignore"
+)
+
+// IsInternalFile reports whether name is a sidecar file or an unfinished
+// upload. Such files are never listed or served.
+func IsInternalFile(name string) bool {
+	return name == DirConfigFile || name == IgnoreFile || isTempFile(name)
+}
+
+// defaultHidden are junk files created by operating systems, hidden in every
+// directory.
+var defaultHidden = []string{".DS_Store", "._*", "Thumbs.db", "desktop.ini"}
+
+// DirConfig is the content of a .mcow.toml file.
+//
+//	title = "Client mods"          # shown instead of the directory name
+//	description = "Install these"
+//	icon = "icon.png"              # image path relative to the directory, or an http(s) URL
+//	order = ["README.md", "mods"]  # listed first, in this order
+//	hidden = ["*.bak", "old/"]     # like lines of .mcowignore
+//
+//	[entries."sodium.jar"]
+//	title = "Sodium"
+//	description = "Rendering optimisations"
+//	featured = true
+type DirConfig struct {
+	Title       string                 `toml:"title"`
+	Description string                 `toml:"description"`
+	Icon        string                 `toml:"icon"`
+	Order       []string               `toml:"order"`
+	Hidden      []string               `toml:"hidden"`
+	Entries     map[string]EntryConfig `toml:"entries"`
+}
+
+// EntryConfig describes a single file or subdirectory in a DirConfig.
+type EntryConfig struct {
+	Title       string `toml:"title"`
+	Description string `toml:"description"`
+	Icon        string `toml:"icon"`
+	Featured    bool   `toml:"featured"`
+}
+
+// ParseDirConfig parses a .mcow.toml file. Unknown keys and invalid hidden
+// patterns are reported as errors, so typos do not go unnoticed.
+func ParseDirConfig(data []byte) (*DirConfig, error) {
+	var c DirConfig
+	md, err := toml.Decode(string(data), &c)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %s", undecoded[0])
+	}
+	for _, p := range c.Hidden {
+		if _, err := parseHideRule("", p); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateIcon(c.Icon); err != nil {
+		return nil, err
+	}
+	for name, e := range c.Entries {
+		if err := validateIcon(e.Icon); err != nil {
+			return nil, fmt.Errorf("entry %s: %w", name, err)
+		}
+	}
+	return &c, nil
+}
+
+// validateIcon accepts http(s) URLs and paths relative to the directory.
+// Icons end up in the src attribute of public pages, other schemes and
+// root-relative paths are refused.
+func validateIcon(icon string) error {
+	if icon == "" {
+		return nil
+	}
+	u, err := url.Parse(icon)
+	if err != nil {
+		return fmt.Errorf("invalid icon %q: %v", icon, err)
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid icon %q: URL without host", icon)
+		}
+	case u.Scheme != "" || u.Host != "" || strings.HasPrefix(icon, "/") || strings.HasPrefix(icon, "\\"):
+		return fmt.Errorf("invalid icon %q: must be a relative path or an http(s) URL", icon)
+	case u.Path == "":
+		return fmt.Errorf("invalid icon %q: empty path", icon)
+	}
+	return nil
+}
+
+// ParseIgnoreFile parses a .mcowignore file: one pattern per line, blank
+// lines and lines starting with # are skipped.
+func ParseIgnoreFile(data []byte) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := parseHideRule("", line); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// hideRule is a hidden pattern from a sidecar file. Like in .gitignore,
+// patterns without a slash match names in the directory and all of its
+// subdirectories, patterns with a slash match paths relative to the
+// directory, and a trailing slash only matches directories.
+type hideRule struct {
+	dir      string // slash-separated directory of the sidecar file, relative to the server directory
+	pattern  string
+	anchored bool
+	dirOnly  bool
+}
+
+func parseHideRule(dir, pattern string) (hideRule, error) {
+	r := hideRule{dir: dir}
+	r.dirOnly = strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	r.anchored = strings.Contains(pattern, "/")
+	r.pattern = strings.TrimPrefix(pattern, "/")
+	if r.pattern == "" {
+		return r, fmt.Errorf("empty hidden pattern")
+	}
+	if _, err := path.Match(r.pattern, ""); err != nil {
+		return r, fmt.Errorf("invalid hidden pattern %q: %w", pattern, err)
+	}
+	return r, nil
+}
+
+// matches reports whether the entry at rel (slash-separated, relative to the
+// server directory) is hidden by the rule.
+func (r hideRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	sub := rel
+	if r.dir != "" {
+		if !strings.HasPrefix(rel, r.dir+"/") {
+			return false
+		}
+		sub = rel[len(r.dir)+1:]
+	}
+	ok, _ := path.Match(r.pattern, sub)
+	return ok
+}
+
+// dirSettings is the sidecar configuration in effect while listing one
+// directory: its own .mcow.toml and the hidden patterns of it and its
+// parents.
+type dirSettings struct {
+	server string
+	dir    string // slash-separated, relative to the server directory
+	config DirConfig
+	rules  []hideRule
+}
+
+// rootSettings returns the settings above a server's directory.
+func rootSettings(serverName string) dirSettings {
+	s := dirSettings{server: serverName}
+	for _, p := range defaultHidden {
+		r, _ := parseHideRule("", p)
+		s.rules = append(s.rules, r)
+	}
+	return s
+}
+
+// enter loads the sidecar files of the directory fullPath, at relPath below
+// the server directory. Broken sidecar files are logged and ignored, so a
+// typo does not take down the whole listing.
+func (s dirSettings) enter(fullPath, relPath string) dirSettings {
+	child := dirSettings{server: s.server, dir: filepath.ToSlash(relPath), rules: s.rules}
+
+	if data, err := os.ReadFile(filepath.Join(fullPath, DirConfigFile)); err == nil {
+		if c, err := ParseDirConfig(data); err != nil {
+			log.Printf("Ignoring %s in %s/%s: %v", DirConfigFile, s.server, child.dir, err)
+		} else {
+			child.config = *c
+		}
+	}
+	patterns := child.config.Hidden
+	if data, err := os.ReadFile(filepath.Join(fullPath, IgnoreFile)); err == nil {
+		if ignored, err := ParseIgnoreFile(data); err != nil {
+			log.Printf("Ignoring %s in %s/%s: %v", IgnoreFile, s.server, child.dir, err)
+		} else {
+			patterns = append(patterns, ignored...)
+		}
+	}
+	if len(patterns) > 0 {
+		// Copy, the parent's rules are shared with its other subdirectories.
+		child.rules = append([]hideRule(nil), s.rules...)
+		for _, p := range patterns {
+			if r, err := parseHideRule(child.dir, p); err == nil {
+				child.rules = append(child.rules, r)
+			}
+		}
+	}
+	return child
+}
+
+// settingsAt returns the settings in effect inside dir, which is root, a
+// server directory, or a directory below it. The sidecar files of root and
+// of every directory in between are applied.
+func settingsAt(root, dir string) (dirSettings, error) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return dirSettings{}, err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return dirSettings{}, fmt.Errorf("%s is not inside %s", dir, root)
+	}
+	s := rootSettings(filepath.Base(root)).enter(root, "")
+	if rel == "." {
+		return s, nil
+	}
+	current, relPath := root, ""
+	for _, name := range strings.Split(rel, "/") {
+		current, relPath = filepath.Join(current, name), path.Join(relPath, name)
+		s = s.enter(current, relPath)
+	}
+	return s, nil
+}
+
+// hidden reports whether an entry of the directory is left out of listings
+// and of everything exported from the directory: zips, checksums, modpacks
+// and releases.
+func (s dirSettings) hidden(name string, isDir bool) bool {
+	if name == DirConfigFile || name == IgnoreFile {
+		return true
+	}
+	rel := path.Join(s.dir, name)
+	for _, r := range s.rules {
+		if r.matches(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeSelf applies the directory's own title, description and icon to
+// its item.
+func (s dirSettings) describeSelf(item *ModItem) {
+	s.describe(item, EntryConfig{Title: s.config.Title, Description: s.config.Description, Icon: s.config.Icon})
+}
+
+// describeEntry applies the [entries] section for an entry of the directory.
+func (s dirSettings) describeEntry(item *ModItem) {
+	if entry, ok := s.config.Entries[item.Name]; ok {
+		s.describe(item, entry)
+	}
+}
+
+func (s dirSettings) describe(item *ModItem, entry EntryConfig) {
+	if entry.Title != "" {
+		item.Title = entry.Title
+	}
+	if entry.Description != "" {
+		item.Description = entry.Description
+	}
+	if entry.Icon != "" {
+		// Icons are resolved like images in markdown files of the directory.
+		item.Icon = string(linkBase{server: s.server, dir: s.dir}.resolve([]byte(entry.Icon)))
+	}
+	if entry.Featured {
+		item.Featured = true
+	}
+}
+
+// sort orders the entries of the directory: those named in "order" first,
+// in that order, then the rest by name.
+func (s dirSettings) sort(children []ModItem) {
+	if len(s.config.Order) == 0 {
+		return
+	}
+	rank := make(map[string]int, len(s.config.Order))
+	for i, name := range s.config.Order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		ri, iok := rank[children[i].Name]
+		rj, jok := rank[children[j].Name]
+		switch {
+		case iok && jok:
+			return ri < rj
+		default:
+			return iok && !jok
+		}
+	})
+}
+
+// VisibleTree returns a copy of the tree without hidden entries.
+func VisibleTree(item *ModItem) *ModItem {
+	visible := *item
+	if item.Type != TypeDir {
+		return &visible
+	}
+	visible.Children = make([]ModItem, 0, len(item.Children))
+	for i := range item.Children {
+		if !item.Children[i].Hidden {
+			visible.Children = append(visible.Children, *VisibleTree(&item.Children[i]))
+		}
+	}
+	return &visible
+}
@@ -0,0 +1,36 @@
+package modmanager
+
+import "testing"
+
+func TestParseDirConfigIcon(t *testing.T) {
+	tests := []struct {
+		icon string
+		ok   bool
+	}{
+		{"", true},
+		{"icon.png", true},
+		{"img/icon.png", true},
+		{"../shared/icon.png", true},
+		{"https://cdn.example.com/icon.png", true},
+		{"http://example.com/icon.png?size=32", true},
+		{"javascript:alert(1)", false},
+		{"data:image/svg+xml,<svg/>", false},
+		{"/files/other/mods/icon.png", false},
+		{"//evil.example/icon.png", false},
+		{`\\evil.example\icon.png`, false},
+		{"https:///icon.png", false},
+		{"?x", false},
+		{`x" onerror="alert(1)`, true}, // a relative path, escaped by the page
+	}
+	for _, tt := range tests {
+		for _, doc := range []string{
+			"icon = '" + tt.icon + "'",
+			"[entries.\"a.jar\"]\nicon = '" + tt.icon + "'",
+		} {
+			_, err := ParseDirConfig([]byte(doc))
+			if (err == nil) != tt.ok {
+				t.Errorf("ParseDirConfig(%q) error = %v, want ok %t", doc, err, tt.ok)
+			}
+		}
+	}
+}
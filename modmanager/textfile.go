@@ -0,0 +1,186 @@
+package modmanager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MaxTextFileSize is the largest file that can be edited in the browser.
+const MaxTextFileSize = 1 << 20
+
+// editableExtensions are the text formats that can be edited in the browser.
+var editableExtensions = map[string]bool{
+	".md":         true,
+	".url":        true,
+	".txt":        true,
+	".toml":       true,
+	".json":       true,
+	".json5":      true,
+	".properties": true,
+	".cfg":        true,
+	".yml":        true,
+	".yaml":       true,
+	IgnoreFile:    true, // has no other extension
+}
+
+// Errors returned when reading or writing text files.
+var (
+	ErrNotEditable    = errors.New("file type cannot be edited")
+	ErrTextTooLarge   = fmt.Errorf("file is larger than %d KiB", MaxTextFileSize>>10)
+	ErrInvalidContent = errors.New("invalid file content")
+)
+
+// IsEditable reports whether a file with this name can be edited as text.
+func IsEditable(name string) bool {
+	return editableExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// TextFile is the content of an editable file. Version identifies the
+// content and must be passed back when saving, so concurrent edits are
+// detected instead of silently overwritten.
+type TextFile struct {
+	Content string    `json:"content"`
+	Version string    `json:"version"` // hex SHA-256 of the content, empty for a new file
+	ModTime time.Time `json:"modTime,omitempty"`
+	Size    int64     `json:"size"`
+}
+
+// EditConflictError is returned by WriteTextFile if the file was changed
+// since it was read.
+type EditConflictError struct {
+	Current *TextFile // nil if the file was deleted
+}
+
+func (e *EditConflictError) Error() string {
+	if e.Current == nil {
+		return "the file was deleted in the meantime"
+	}
+	return "the file was changed in the meantime"
+}
+
+// textVersion returns the version of content used for conflict detection.
+func textVersion(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadTextFile reads an editable file.
+func ReadTextFile(path string) (*TextFile, error) {
+	if !IsEditable(path) {
+		return nil, ErrNotEditable
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, ErrNotEditable
+	}
+	if info.Size() > MaxTextFileSize {
+		return nil, ErrTextTooLarge
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(content) {
+		return nil, fmt.Errorf("%w: not UTF-8 text", ErrNotEditable)
+	}
+	return &TextFile{Content: string(content), Version: textVersion(content), ModTime: info.ModTime(), Size: info.Size()}, nil
+}
+
+// ValidateText checks content that is about to be saved as name. JSON and
+// TOML files must parse, so a typo cannot break a server's configuration.
+// Sidecar files must also be valid for the file browser.
+func ValidateText(name string, content []byte) error {
+	if len(content) > MaxTextFileSize {
+		return ErrTextTooLarge
+	}
+	if !utf8.Valid(content) {
+		return fmt.Errorf("%w: not UTF-8 text", ErrInvalidContent)
+	}
+	switch filepath.Base(name) {
+	case DirConfigFile:
+		if _, err := ParseDirConfig(content); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+		return nil
+	case IgnoreFile:
+		if _, err := ParseIgnoreFile(content); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+		return nil
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		if len(bytes.TrimSpace(content)) > 0 {
+			var v interface{}
+			if err := json.Unmarshal(content, &v); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+			}
+		}
+	case ".toml":
+		var v map[string]interface{}
+		if err := toml.Unmarshal(content, &v); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+	}
+	return nil
+}
+
+// textWriteMu serialises the check and replacement in WriteTextFile.
+var textWriteMu sync.Mutex
+
+// WriteTextFile atomically replaces the editable file at path with content
+// if its current version is version. An empty version creates a new file
+// and fails if one exists. On a mismatch an *EditConflictError with the
+// current content is returned.
+func WriteTextFile(path string, content []byte, version string) (*TextFile, error) {
+	if !IsEditable(path) {
+		return nil, ErrNotEditable
+	}
+	if err := ValidateText(path, content); err != nil {
+		return nil, err
+	}
+
+	textWriteMu.Lock()
+	defer textWriteMu.Unlock()
+
+	current, err := ReadTextFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if version != "" {
+			return nil, &EditConflictError{}
+		}
+	case err != nil:
+		return nil, err
+	case current.Version != version:
+		return nil, &EditConflictError{Current: current}
+	}
+
+	policy := ConflictOverwrite
+	if version == "" {
+		policy = ConflictFail
+	}
+	if _, err := WriteFileAtomic(path, bytes.NewReader(content), policy); err != nil {
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			current, _ := ReadTextFile(path)
+			return nil, &EditConflictError{Current: current}
+		}
+		return nil, err
+	}
+	return ReadTextFile(path)
+}
@@ -0,0 +1,147 @@
+package modmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextFile(t *testing.T) {
+	const original = "a = 1\n"
+	tests := []struct {
+		name     string
+		file     string
+		existing *string // nil if the file does not exist
+		version  string  // "current" is replaced with the version of existing
+		content  string
+		// wantConflict is "changed" or "deleted" for an *EditConflictError
+		// with or without the current content.
+		wantConflict string
+		wantErr      error
+	}{
+		{name: "create", file: "new.toml", content: "b = 2\n"},
+		{name: "update", file: "a.toml", existing: ptr(original), version: "current", content: "a = 2\n"},
+		{name: "unchanged content", file: "a.toml", existing: ptr(original), version: "current", content: original},
+		{name: "stale version", file: "a.toml", existing: ptr(original), version: textVersion([]byte("a = 0\n")), content: "a = 2\n", wantConflict: "changed"},
+		{name: "created in the meantime", file: "a.toml", existing: ptr(original), version: "", content: "a = 2\n", wantConflict: "changed"},
+		{name: "deleted in the meantime", file: "a.toml", version: textVersion([]byte(original)), content: "a = 2\n", wantConflict: "deleted"},
+		{name: "invalid toml", file: "a.toml", existing: ptr(original), version: "current", content: "a = = 2", wantErr: ErrInvalidContent},
+		{name: "invalid json", file: "a.json", existing: ptr("{}"), version: "current", content: "{", wantErr: ErrInvalidContent},
+		{name: "empty json", file: "a.json", existing: ptr("{}"), version: "current", content: "  \n"},
+		{name: "invalid sidecar", file: DirConfigFile, content: "sort = \"sideways\"\n", wantErr: ErrInvalidContent},
+		{name: "not utf-8", file: "a.txt", content: "\xff\xfe", wantErr: ErrInvalidContent},
+		{name: "too large", file: "a.txt", content: strings.Repeat("x", MaxTextFileSize+1), wantErr: ErrTextTooLarge},
+		{name: "binary file type", file: "a.jar", content: "x", wantErr: ErrNotEditable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if tt.existing != nil {
+				if err := os.WriteFile(path, []byte(*tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			version := tt.version
+			if version == "current" {
+				version = textVersion([]byte(*tt.existing))
+			}
+
+			saved, err := WriteTextFile(path, []byte(tt.content), version)
+
+			var conflict *EditConflictError
+			switch {
+			case tt.wantConflict != "":
+				if !errors.As(err, &conflict) {
+					t.Fatalf("WriteTextFile() error = %v, want an edit conflict", err)
+				}
+				if (conflict.Current == nil) != (tt.wantConflict == "deleted") {
+					t.Errorf("conflict current = %+v, want %s", conflict.Current, tt.wantConflict)
+				}
+				if conflict.Current != nil && conflict.Current.Content != *tt.existing {
+					t.Errorf("conflict current content = %q, want %q", conflict.Current.Content, *tt.existing)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("WriteTextFile() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("WriteTextFile() error = %v", err)
+			default:
+				if saved.Content != tt.content || saved.Version != textVersion([]byte(tt.content)) {
+					t.Errorf("saved = %q version %s", saved.Content, saved.Version)
+				}
+			}
+
+			// A refused write leaves the file as it was.
+			got, readErr := os.ReadFile(path)
+			switch {
+			case err == nil:
+				if string(got) != tt.content {
+					t.Errorf("file content = %q, want %q", got, tt.content)
+				}
+			case tt.existing == nil:
+				if !os.IsNotExist(readErr) {
+					t.Errorf("refused write created the file")
+				}
+			case string(got) != *tt.existing:
+				t.Errorf("refused write changed the file to %q", got)
+			}
+		})
+	}
+}
+
+func TestWriteTextFileSequence(t *testing.T) {
+	// Two editors open the same file; the second save must not overwrite the first.
+	path := filepath.Join(t.TempDir(), "server.properties")
+	first, err := WriteTextFile(path, []byte("motd=a\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteTextFile(path, []byte("motd=b\n"), first.Version); err != nil {
+		t.Fatalf("first editor: %v", err)
+	}
+	var conflict *EditConflictError
+	if _, err := WriteTextFile(path, []byte("motd=c\n"), first.Version); !errors.As(err, &conflict) {
+		t.Fatalf("second editor: error = %v, want an edit conflict", err)
+	}
+	if conflict.Current == nil || conflict.Current.Content != "motd=b\n" {
+		t.Errorf("conflict reports %+v, want the first editor's content", conflict.Current)
+	}
+}
+
+func TestReadTextFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	f, err := ReadTextFile(write("a.md", "# Hi"))
+	if err != nil || f.Content != "# Hi" || f.Size != 4 || f.Version != textVersion([]byte("# Hi")) {
+		t.Errorf("ReadTextFile(a.md) = %+v, %v", f, err)
+	}
+	if _, err := ReadTextFile(write("a.jar", "x")); !errors.Is(err, ErrNotEditable) {
+		t.Errorf("ReadTextFile(a.jar) error = %v, want ErrNotEditable", err)
+	}
+	if _, err := ReadTextFile(write("b.txt", "\xff")); !errors.Is(err, ErrNotEditable) {
+		t.Errorf("ReadTextFile(binary .txt) error = %v, want ErrNotEditable", err)
+	}
+	if _, err := ReadTextFile(write("big.txt", strings.Repeat("x", MaxTextFileSize+1))); !errors.Is(err, ErrTextTooLarge) {
+		t.Errorf("ReadTextFile(big.txt) error = %v, want ErrTextTooLarge", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTextFile(filepath.Join(dir, "dir.txt")); !errors.Is(err, ErrNotEditable) {
+		t.Errorf("ReadTextFile(directory) error = %v, want ErrNotEditable", err)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,251 @@
+package modmanager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrTrashItemNotFound is returned for unknown trash item IDs.
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+// TrashItem is a deleted file or directory kept in the trash.
+type TrashItem struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Path      string    `json:"path"` // original path, relative to the server directory
+	IsDir     bool      `json:"isDir"`
+	Size      int64     `json:"size"`  // total size of all files
+	Files     int       `json:"files"` // number of files, 1 for a single file
+	DeletedBy string    `json:"deletedBy,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// Name returns the base name of the deleted item.
+func (i TrashItem) Name() string {
+	return filepath.Base(filepath.FromSlash(i.Path))
+}
+
+// Trash keeps deleted files per server until they are restored or purged.
+// Each item is stored as {server}/{id}/{name} with its description in
+// {server}/{id}.json.
+type Trash struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewTrash creates a trash rooted at dir.
+func NewTrash(dir string) *Trash {
+	return &Trash{Dir: dir}
+}
+
+func (t *Trash) serverDir(server string) string    { return filepath.Join(t.Dir, server) }
+func (t *Trash) infoPath(server, id string) string { return filepath.Join(t.Dir, server, id+".json") }
+func (t *Trash) itemDir(server, id string) string  { return filepath.Join(t.Dir, server, id) }
+
+// ItemPath returns where the deleted file or directory of an item is kept.
+func (t *Trash) ItemPath(item *TrashItem) string {
+	return filepath.Join(t.itemDir(item.Server, item.ID), item.Name())
+}
+
+// Put moves the item at rel below serverDir into the trash of server.
+func (t *Trash) Put(server, serverDir, rel, user string) (*TrashItem, error) {
+	src := filepath.Join(serverDir, filepath.FromSlash(rel))
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil, ErrSourceNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	item := &TrashItem{
+		ID:        hex.EncodeToString(id),
+		Server:    server,
+		Path:      filepath.ToSlash(filepath.Clean(rel)),
+		IsDir:     info.IsDir(),
+		DeletedBy: user,
+		DeletedAt: time.Now(),
+	}
+	item.Size, item.Files = treeSize(src)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.itemDir(server, item.ID), 0755); err != nil {
+		return nil, err
+	}
+	// Write the description first, so an item is never in the trash
+	// without knowing where it came from.
+	if err := writeJSONFile(t.infoPath(server, item.ID), item); err != nil {
+		os.RemoveAll(t.itemDir(server, item.ID))
+		return nil, err
+	}
+	if err := moveAcrossDevices(src, filepath.Join(t.itemDir(server, item.ID), info.Name())); err != nil {
+		os.Remove(t.infoPath(server, item.ID))
+		os.RemoveAll(t.itemDir(server, item.ID))
+		return nil, err
+	}
+	return item, nil
+}
+
+// Get returns a single trash item.
+func (t *Trash) Get(server, id string) (*TrashItem, error) {
+	if !validUploadID(id) { // same format as upload IDs
+		return nil, ErrTrashItemNotFound
+	}
+	data, err := os.ReadFile(t.infoPath(server, id))
+	if os.IsNotExist(err) {
+		return nil, ErrTrashItemNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// List returns the trash items of server, most recently deleted first.
+func (t *Trash) List(server string) ([]TrashItem, error) {
+	matches, err := filepath.Glob(filepath.Join(t.serverDir(server), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	items := []TrashItem{}
+	for _, m := range matches {
+		item, err := t.Get(server, strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// Restore moves a trash item back to its original path below serverDir.
+// Existing files are handled according to the conflict policy.
+func (t *Trash) Restore(server, id, serverDir, policy string) (*TrashItem, *WriteResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item, err := t.Get(server, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	src := t.ItemPath(item)
+	dest := filepath.Join(serverDir, filepath.FromSlash(item.Path))
+	res, err := MovePath(src, dest, policy)
+	if errors.Is(err, syscall.EXDEV) {
+		// The trash is on another filesystem.
+		if res, err = CopyPath(src, dest, policy); err == nil && !res.Skipped {
+			os.RemoveAll(src)
+		}
+	}
+	if err != nil || res.Skipped {
+		return item, res, err
+	}
+	return item, res, t.remove(server, id)
+}
+
+// Purge permanently deletes a trash item.
+func (t *Trash) Purge(server, id string) (*TrashItem, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item, err := t.Get(server, id)
+	if err != nil {
+		return nil, err
+	}
+	return item, t.remove(server, id)
+}
+
+// PurgeExpired permanently deletes all items of all servers that were
+// deleted more than maxAge ago, and returns them.
+func (t *Trash) PurgeExpired(maxAge time.Duration) ([]TrashItem, error) {
+	servers, err := os.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var purged []TrashItem
+	for _, s := range servers {
+		if !s.IsDir() {
+			continue
+		}
+		items, err := t.List(s.Name())
+		if err != nil {
+			return purged, err
+		}
+		for _, item := range items {
+			if time.Since(item.DeletedAt) <= maxAge {
+				continue
+			}
+			if _, err := t.Purge(item.Server, item.ID); err != nil && !errors.Is(err, ErrTrashItemNotFound) {
+				return purged, err
+			}
+			purged = append(purged, item)
+		}
+	}
+	return purged, nil
+}
+
+func (t *Trash) remove(server, id string) error {
+	if err := os.RemoveAll(t.itemDir(server, id)); err != nil {
+		return err
+	}
+	return os.Remove(t.infoPath(server, id))
+}
+
+// moveAcrossDevices renames src to dest, copying and removing src if they
+// are on different filesystems.
+func moveAcrossDevices(src, dest string) error {
+	err := os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if _, err := CopyPath(src, dest, ConflictFail); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// treeSize returns the total size and number of regular files at path.
+func treeSize(path string) (int64, int) {
+	var size int64
+	var files int
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+// writeJSONFile atomically replaces path with the JSON encoding of v.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
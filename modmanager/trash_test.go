@@ -0,0 +1,186 @@
+package modmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrashPut(t *testing.T) {
+	trash := NewTrash(t.TempDir())
+	serverDir := t.TempDir()
+	writeTree(t, serverDir, map[string]string{"mods/a.jar": "aaa", "config/a.toml": "x", "config/sub/b.toml": "yy"})
+
+	file, err := trash.Put("creative", serverDir, "mods/a.jar", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Path != "mods/a.jar" || file.IsDir || file.Size != 3 || file.Files != 1 || file.DeletedBy != "alice" {
+		t.Errorf("Put(file) = %+v", file)
+	}
+	if data, _ := os.ReadFile(trash.ItemPath(file)); string(data) != "aaa" {
+		t.Errorf("trashed file = %q", data)
+	}
+
+	dir, err := trash.Put("creative", serverDir, "config/", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.Path != "config" || !dir.IsDir || dir.Size != 3 || dir.Files != 2 {
+		t.Errorf("Put(dir) = %+v", dir)
+	}
+	if got := readTree(t, serverDir); !reflect.DeepEqual(got, map[string]string{"mods/": ""}) {
+		t.Errorf("server directory after Put = %v", sortedKeys(got))
+	}
+
+	if _, err := trash.Put("creative", serverDir, "mods/a.jar", "alice"); !errors.Is(err, ErrSourceNotFound) {
+		t.Errorf("Put(missing) error = %v, want ErrSourceNotFound", err)
+	}
+
+	items, err := trash.List("creative")
+	if err != nil || len(items) != 2 || items[0].ID != dir.ID || items[1].ID != file.ID {
+		t.Errorf("List() = %+v, %v, want the directory before the file", items, err)
+	}
+	if items, err := trash.List("survival"); err != nil || len(items) != 0 {
+		t.Errorf("List(other server) = %+v, %v, want none", items, err)
+	}
+	if _, err := trash.Get("survival", file.ID); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("Get(other server) error = %v, want ErrTrashItemNotFound", err)
+	}
+	if _, err := trash.Get("creative", "../creative"); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("Get(invalid id) error = %v, want ErrTrashItemNotFound", err)
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // content of mods/a.jar at restore time, if any
+		policy   string
+
+		wantErr     bool // a *ConflictError
+		wantPath    string
+		wantContent string
+		wantKept    bool // the item stays in the trash
+	}{
+		{name: "free path", policy: ConflictFail, wantPath: "mods/a.jar", wantContent: "old"},
+		{name: "conflict", existing: "new", policy: ConflictFail, wantErr: true, wantKept: true},
+		{name: "overwrite", existing: "new", policy: ConflictOverwrite, wantPath: "mods/a.jar", wantContent: "old"},
+		{name: "rename", existing: "new", policy: ConflictRename, wantPath: "mods/a-1.jar", wantContent: "old"},
+		{name: "skip", existing: "new", policy: ConflictSkip, wantPath: "mods/a.jar", wantContent: "new", wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trash := NewTrash(t.TempDir())
+			serverDir := t.TempDir()
+			writeTree(t, serverDir, map[string]string{"mods/a.jar": "old"})
+			item, err := trash.Put("creative", serverDir, "mods/a.jar", "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.existing != "" {
+				writeTree(t, serverDir, map[string]string{"mods/a.jar": tt.existing})
+			}
+
+			_, res, err := trash.Restore("creative", item.ID, serverDir, tt.policy)
+			var conflict *ConflictError
+			if tt.wantErr {
+				if !errors.As(err, &conflict) {
+					t.Fatalf("Restore() error = %v, want a conflict", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			} else {
+				if res.Path != filepath.Join(serverDir, filepath.FromSlash(tt.wantPath)) {
+					t.Errorf("Restore() path = %s, want %s", res.Path, tt.wantPath)
+				}
+				if data, _ := os.ReadFile(res.Path); string(data) != tt.wantContent {
+					t.Errorf("%s = %q, want %q", tt.wantPath, data, tt.wantContent)
+				}
+			}
+
+			_, err = trash.Get("creative", item.ID)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("item kept in the trash = %t, want %t", kept, tt.wantKept)
+			}
+			if _, err := os.Stat(trash.ItemPath(item)); (err == nil) != tt.wantKept {
+				t.Errorf("trashed file exists = %t, want %t", err == nil, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestTrashRestoreDirectory(t *testing.T) {
+	trash := NewTrash(t.TempDir())
+	serverDir := t.TempDir()
+	tree := map[string]string{"config/a.toml": "x", "config/sub/b.toml": "y"}
+	writeTree(t, serverDir, tree)
+	item, err := trash.Put("creative", serverDir, "config", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The parent directory is recreated if it was removed in the meantime.
+	if err := os.RemoveAll(serverDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := trash.Restore("creative", item.ID, serverDir, ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"config/": "", "config/a.toml": "x", "config/sub/": "", "config/sub/b.toml": "y"}
+	if got := readTree(t, serverDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored tree = %v, want %v", sortedKeys(got), sortedKeys(want))
+	}
+	if _, _, err := trash.Restore("creative", item.ID, serverDir, ConflictFail); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("second Restore() error = %v, want ErrTrashItemNotFound", err)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	trash := NewTrash(t.TempDir())
+	serverDir := t.TempDir()
+	writeTree(t, serverDir, map[string]string{"a.jar": "a", "b.jar": "b", "c.jar": "c"})
+	put := func(server, name string, age time.Duration) *TrashItem {
+		item, err := trash.Put(server, serverDir, name, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.DeletedAt = item.DeletedAt.Add(-age)
+		if err := writeJSONFile(trash.infoPath(server, item.ID), item); err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+	purged := put("creative", "a.jar", 0)
+	expired := put("creative", "b.jar", 48*time.Hour)
+	recent := put("survival", "c.jar", time.Hour)
+
+	if _, err := trash.Purge("creative", purged.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trash.Purge("creative", purged.ID); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Errorf("second Purge() error = %v, want ErrTrashItemNotFound", err)
+	}
+
+	items, err := trash.PurgeExpired(24 * time.Hour)
+	if err != nil || len(items) != 1 || items[0].ID != expired.ID {
+		t.Fatalf("PurgeExpired() = %+v, %v, want only %s", items, err, expired.Path)
+	}
+	for _, item := range []*TrashItem{purged, expired} {
+		if _, err := os.Stat(filepath.Dir(trash.ItemPath(item))); !os.IsNotExist(err) {
+			t.Errorf("%s still in the trash: %v", item.Path, err)
+		}
+	}
+	if left, _ := trash.List("survival"); len(left) != 1 || left[0].ID != recent.ID {
+		t.Errorf("List(survival) = %+v, want the recent item", left)
+	}
+	if left, _ := trash.List("creative"); len(left) != 0 {
+		t.Errorf("List(creative) = %+v, want none", left)
+	}
+
+	if items, err := NewTrash(filepath.Join(t.TempDir(), "missing")).PurgeExpired(0); err != nil || items != nil {
+		t.Errorf("PurgeExpired() without a trash directory = %v, %v", items, err)
+	}
+}
@@ -0,0 +1,406 @@
+package modmanager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by UploadStore.
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadOffset     = errors.New("chunk offset does not match the uploaded size")
+	ErrUploadChecksum   = errors.New("checksum mismatch")
+	ErrUploadTooLarge   = errors.New("chunk exceeds the declared upload size")
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+)
+
+// Upload is a resumable upload staged in an UploadStore. The received data
+// is appended to a part file; Offset is the number of bytes received so far.
+type Upload struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Dir       string    `json:"dir"` // target directory relative to the server directory
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`   // expected hash of the whole file, optional
+	Conflict  string    `json:"conflict,omitempty"` // conflict policy applied on completion
+	Extract   bool      `json:"extract,omitempty"`  // the archive is to be extracted on completion
+	Offset    int64     `json:"offset"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// UploadStore stages resumable uploads on disk. Each upload consists of
+// {id}.json with its description and {id}.part with the data received so
+// far, so interrupted uploads survive restarts.
+type UploadStore struct {
+	Dir string
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the lock of a single upload, kept in UploadStore.locks only
+// while it is held or waited for.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewUploadStore creates an upload store rooted at dir.
+func NewUploadStore(dir string) *UploadStore {
+	return &UploadStore{Dir: dir, locks: make(map[string]*uploadLock)}
+}
+
+func (s *UploadStore) infoPath(id string) string { return filepath.Join(s.Dir, id+".json") }
+func (s *UploadStore) partPath(id string) string { return filepath.Join(s.Dir, id+".part") }
+
+// lock serialises operations on a single upload. The lock is forgotten
+// when the last caller releases it, so finished uploads leave nothing behind.
+func (s *UploadStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// validUploadID reports whether id looks like an ID generated by Create, so
+// it can safely be used in file names.
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Create starts a new upload, or returns the pending upload of the same
+// user for the same target and size so the client can resume it.
+func (s *UploadStore) Create(u Upload) (*Upload, error) {
+	if u.Size < 0 || u.Filename == "" {
+		return nil, fmt.Errorf("invalid upload size or file name")
+	}
+	u.SHA256 = strings.ToLower(u.SHA256)
+
+	pending, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		if p.Server == u.Server && p.Dir == u.Dir && p.Filename == u.Filename && p.Size == u.Size && p.SHA256 == u.SHA256 && p.CreatedBy == u.CreatedBy {
+			if p.Conflict == u.Conflict && p.Extract == u.Extract {
+				return &p, nil
+			}
+			unlock := s.lock(p.ID)
+			defer unlock()
+			current, err := s.Get(p.ID)
+			if err != nil {
+				return nil, err
+			}
+			current.Conflict, current.Extract = u.Conflict, u.Extract
+			return current, s.writeInfo(current)
+		}
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	u.ID = hex.EncodeToString(id)
+	u.Offset = 0
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+
+	part, err := os.Create(s.partPath(u.ID))
+	if err != nil {
+		return nil, err
+	}
+	part.Close()
+	if err := s.writeInfo(&u); err != nil {
+		os.Remove(s.partPath(u.ID))
+		return nil, err
+	}
+	return &u, nil
+}
+
+// writeInfo atomically replaces the description of an upload.
+func (s *UploadStore) writeInfo(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(u.ID))
+}
+
+// Get returns an upload with its current offset.
+func (s *UploadStore) Get(id string) (*Upload, error) {
+	if !validUploadID(id) {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(s.partPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.Offset = info.Size()
+	return &u, nil
+}
+
+// List returns all pending uploads.
+func (s *UploadStore) List() ([]Upload, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var uploads []Upload
+	for _, m := range matches {
+		u, err := s.Get(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			continue
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, nil
+}
+
+// WriteChunk appends the data read from r to the upload. offset must equal
+// the number of bytes already received, which makes retrying a chunk after
+// a lost response safe. If checksum is not empty, it is the hex SHA-256 of
+// the chunk; on mismatch the chunk is discarded. It returns the new offset.
+func (s *UploadStore) WriteChunk(id string, offset int64, r io.Reader, checksum string) (int64, error) {
+	if !validUploadID(id) {
+		return 0, ErrUploadNotFound
+	}
+	defer s.lock(id)()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != u.Offset {
+		return u.Offset, ErrUploadOffset
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return u.Offset, err
+	}
+	defer part.Close()
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		return u.Offset, err
+	}
+
+	// Read at most one byte more than allowed to detect oversized chunks.
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(part, h), io.LimitReader(r, u.Size-offset+1))
+	switch {
+	case err != nil:
+	case offset+n > u.Size:
+		err = ErrUploadTooLarge
+	case checksum != "" && !strings.EqualFold(checksum, hex.EncodeToString(h.Sum(nil))):
+		err = ErrUploadChecksum
+	}
+	if err != nil {
+		// Drop the partial chunk so the client can retry from the same offset.
+		part.Truncate(offset)
+		return offset, err
+	}
+
+	u.Offset = offset + n
+	u.UpdatedAt = time.Now()
+	if err := s.writeInfo(u); err != nil {
+		return u.Offset, err
+	}
+	return u.Offset, nil
+}
+
+// Complete verifies a fully received upload and moves it to dest. What
+// happens if dest exists is decided by policy, or by the policy given on
+// creation if policy is empty. The file appears at dest atomically. On a
+// conflict the upload is kept, so it can be completed with another policy.
+func (s *UploadStore) Complete(id, dest, policy string) (*Upload, *WriteResult, error) {
+	if !validUploadID(id) {
+		return nil, nil, ErrUploadNotFound
+	}
+	defer s.lock(id)()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy == "" {
+		policy = u.Conflict
+	}
+	if err := s.verify(u); err != nil {
+		return u, nil, err
+	}
+
+	if res, err := CheckConflict(dest, policy); err != nil {
+		return u, nil, err
+	} else if res.Skipped {
+		s.remove(id)
+		return u, res, nil
+	}
+
+	tmp, err := stageNextTo(s.partPath(id), filepath.Dir(dest))
+	if err != nil {
+		return u, nil, err
+	}
+	defer os.Remove(tmp)
+	res, err := placeFile(tmp, dest, policy)
+	if err != nil || res.Skipped {
+		// Keep the data for another attempt unless it was skipped.
+		if err != nil && os.Rename(tmp, s.partPath(id)) == nil {
+			return u, nil, err
+		}
+		s.remove(id)
+		return u, res, err
+	}
+	res.Size = u.Size
+	os.Remove(s.infoPath(id))
+	return u, res, nil
+}
+
+// verify checks that an upload is complete and matches the expected hash.
+// A corrupt upload is discarded.
+func (s *UploadStore) verify(u *Upload) error {
+	if u.Offset != u.Size {
+		return ErrUploadIncomplete
+	}
+	if u.SHA256 != "" {
+		sum, err := fileSHA256(s.partPath(u.ID))
+		if err != nil {
+			return err
+		}
+		if sum != u.SHA256 {
+			s.remove(u.ID)
+			return fmt.Errorf("%w: expected %s, got %s", ErrUploadChecksum, u.SHA256, sum)
+		}
+	}
+	return nil
+}
+
+// Extract verifies a fully received archive upload and unpacks it into
+// destDir with ExtractArchive. The upload is discarded afterwards, also if
+// the archive turns out to be invalid.
+func (s *UploadStore) Extract(id, destDir, policy string, limits ExtractLimits) (*Upload, *ExtractReport, error) {
+	if !validUploadID(id) {
+		return nil, nil, ErrUploadNotFound
+	}
+	defer s.lock(id)()
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy == "" {
+		policy = u.Conflict
+	}
+	if err := s.verify(u); err != nil {
+		return u, nil, err
+	}
+	defer s.remove(id)
+
+	f, err := os.Open(s.partPath(id))
+	if err != nil {
+		return u, nil, err
+	}
+	defer f.Close()
+	report, err := ExtractArchive(f, u.Size, u.Filename, destDir, policy, limits)
+	return u, report, err
+}
+
+// Abort discards an upload.
+func (s *UploadStore) Abort(id string) error {
+	if !validUploadID(id) {
+		return ErrUploadNotFound
+	}
+	defer s.lock(id)()
+	if _, err := os.Stat(s.infoPath(id)); os.IsNotExist(err) {
+		return ErrUploadNotFound
+	}
+	return s.remove(id)
+}
+
+func (s *UploadStore) remove(id string) error {
+	err := os.Remove(s.partPath(id))
+	if err2 := os.Remove(s.infoPath(id)); err == nil || os.IsNotExist(err) {
+		err = err2
+	}
+	return err
+}
+
+// Cleanup removes uploads that have not received data for longer than maxAge.
+func (s *UploadStore) Cleanup(maxAge time.Duration) error {
+	uploads, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, u := range uploads {
+		if time.Since(u.UpdatedAt) > maxAge {
+			unlock := s.lock(u.ID)
+			s.remove(u.ID)
+			unlock()
+		}
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
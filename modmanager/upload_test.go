@@ -0,0 +1,285 @@
+package modmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUpload creates an upload of content for a.jar.
+func newTestUpload(t *testing.T, s *UploadStore, content, checksum string) *Upload {
+	t.Helper()
+	u, err := s.Create(Upload{Server: "creative", Dir: "mods", Filename: "a.jar", Size: int64(len(content)), SHA256: checksum, CreatedBy: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestUploadCreateResumes(t *testing.T) {
+	s := NewUploadStore(t.TempDir())
+	first := newTestUpload(t, s, "hello", "")
+	if _, err := s.WriteChunk(first.ID, 0, strings.NewReader("he"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same file from the same user continues where it stopped.
+	again := newTestUpload(t, s, "hello", "")
+	if again.ID != first.ID || again.Offset != 2 {
+		t.Errorf("Create() = %s at %d, want %s at 2", again.ID, again.Offset, first.ID)
+	}
+
+	// A different conflict policy or extract flag is stored on the pending upload.
+	changed, err := s.Create(Upload{Server: "creative", Dir: "mods", Filename: "a.jar", Size: 5, CreatedBy: "alice", Conflict: ConflictRename})
+	if err != nil || changed.ID != first.ID || changed.Conflict != ConflictRename || changed.Offset != 2 {
+		t.Fatalf("Create() with another policy = %+v, %v", changed, err)
+	}
+	if got, _ := s.Get(first.ID); got.Conflict != ConflictRename {
+		t.Errorf("stored conflict policy = %q, want rename", got.Conflict)
+	}
+
+	// Other users, sizes and targets get their own upload.
+	for _, u := range []Upload{
+		{Server: "creative", Dir: "mods", Filename: "a.jar", Size: 5, CreatedBy: "bob"},
+		{Server: "creative", Dir: "mods", Filename: "a.jar", Size: 6, CreatedBy: "alice"},
+		{Server: "survival", Dir: "mods", Filename: "a.jar", Size: 5, CreatedBy: "alice"},
+	} {
+		other, err := s.Create(u)
+		if err != nil || other.ID == first.ID || other.Offset != 0 {
+			t.Errorf("Create(%+v) = %+v, %v, want a new upload", u, other, err)
+		}
+	}
+}
+
+func TestUploadWriteChunk(t *testing.T) {
+	const content = "0123456789"
+	tests := []struct {
+		name       string
+		offset     int64
+		chunk      string
+		checksum   string
+		wantErr    error
+		wantOffset int64
+	}{
+		{name: "next chunk", offset: 4, chunk: "456", wantOffset: 7},
+		{name: "with checksum", offset: 4, chunk: "456", checksum: sha256Hex([]byte("456")), wantOffset: 7},
+		{name: "checksum in upper case", offset: 4, chunk: "456", checksum: strings.ToUpper(sha256Hex([]byte("456"))), wantOffset: 7},
+		{name: "last chunk", offset: 4, chunk: "456789", wantOffset: 10},
+		{name: "empty chunk", offset: 4, chunk: "", wantOffset: 4},
+		{name: "wrong checksum", offset: 4, chunk: "456", checksum: sha256Hex([]byte("xyz")), wantErr: ErrUploadChecksum, wantOffset: 4},
+		{name: "beyond the declared size", offset: 4, chunk: "4567890", wantErr: ErrUploadTooLarge, wantOffset: 4},
+		{name: "repeated chunk", offset: 0, chunk: "0123", wantErr: ErrUploadOffset, wantOffset: 4},
+		{name: "gap", offset: 6, chunk: "67", wantErr: ErrUploadOffset, wantOffset: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUploadStore(t.TempDir())
+			u := newTestUpload(t, s, content, "")
+			if _, err := s.WriteChunk(u.ID, 0, strings.NewReader("0123"), ""); err != nil {
+				t.Fatal(err)
+			}
+
+			offset, err := s.WriteChunk(u.ID, tt.offset, strings.NewReader(tt.chunk), tt.checksum)
+			if !errors.Is(err, tt.wantErr) || offset != tt.wantOffset {
+				t.Fatalf("WriteChunk() = %d, %v, want %d, %v", offset, err, tt.wantOffset, tt.wantErr)
+			}
+			// A refused chunk leaves nothing behind, so it can be retried.
+			data, err := os.ReadFile(s.partPath(u.ID))
+			if err != nil || string(data) != content[:tt.wantOffset] {
+				t.Errorf("part file = %q, %v, want %q", data, err, content[:tt.wantOffset])
+			}
+			if got, _ := s.Get(u.ID); got.Offset != tt.wantOffset {
+				t.Errorf("Get().Offset = %d, want %d", got.Offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestUploadComplete(t *testing.T) {
+	const content = "new jar"
+	tests := []struct {
+		name     string
+		existing bool
+		created  string // policy given on creation
+		policy   string // policy given on completion
+		checksum string
+		partial  bool
+
+		wantErr     error
+		wantPath    string // relative to the target directory
+		wantSkipped bool
+		wantRenamed bool
+		wantKept    bool // the upload can be completed again
+	}{
+		{name: "new file", wantPath: "a.jar"},
+		{name: "verified hash", checksum: sha256Hex([]byte(content)), wantPath: "a.jar"},
+		{name: "overwrite", existing: true, policy: ConflictOverwrite, wantPath: "a.jar"},
+		{name: "rename", existing: true, policy: ConflictRename, wantPath: "a-1.jar", wantRenamed: true},
+		{name: "skip", existing: true, policy: ConflictSkip, wantPath: "a.jar", wantSkipped: true},
+		{name: "policy from creation", existing: true, created: ConflictRename, wantPath: "a-1.jar", wantRenamed: true},
+		{name: "policy on completion wins", existing: true, created: ConflictSkip, policy: ConflictOverwrite, wantPath: "a.jar"},
+		{name: "conflict keeps the upload", existing: true, wantErr: &ConflictError{}, wantKept: true},
+		{name: "incomplete", partial: true, wantErr: ErrUploadIncomplete, wantKept: true},
+		{name: "hash mismatch discards the upload", checksum: sha256Hex([]byte("other")), wantErr: ErrUploadChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUploadStore(t.TempDir())
+			destDir := t.TempDir()
+			dest := filepath.Join(destDir, "a.jar")
+			if tt.existing {
+				if err := os.WriteFile(dest, []byte("old jar"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			u, err := s.Create(Upload{Server: "creative", Filename: "a.jar", Size: int64(len(content)), SHA256: tt.checksum, Conflict: tt.created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk := content
+			if tt.partial {
+				chunk = content[:3]
+			}
+			if _, err := s.WriteChunk(u.ID, 0, strings.NewReader(chunk), ""); err != nil {
+				t.Fatal(err)
+			}
+
+			_, res, err := s.Complete(u.ID, dest, tt.policy)
+			var conflict *ConflictError
+			switch {
+			case tt.wantErr == nil:
+				if err != nil {
+					t.Fatalf("Complete() error = %v", err)
+				}
+			case errors.As(tt.wantErr, &conflict):
+				if !errors.As(err, &conflict) || conflict.Suggested != filepath.Join(destDir, "a-1.jar") {
+					t.Fatalf("Complete() error = %v, want a conflict suggesting a-1.jar", err)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("Complete() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil {
+				if res.Path != filepath.Join(destDir, tt.wantPath) || res.Skipped != tt.wantSkipped || res.Renamed != tt.wantRenamed {
+					t.Errorf("Complete() = %+v, want %s skipped %t renamed %t", res, tt.wantPath, tt.wantSkipped, tt.wantRenamed)
+				}
+				want := content
+				if tt.wantSkipped {
+					want = "old jar"
+				}
+				if data, _ := os.ReadFile(res.Path); string(data) != want {
+					t.Errorf("%s = %q, want %q", tt.wantPath, data, want)
+				}
+			}
+			if tt.existing && tt.wantPath != "a.jar" {
+				if data, _ := os.ReadFile(dest); string(data) != "old jar" {
+					t.Errorf("existing file changed to %q", data)
+				}
+			}
+
+			_, getErr := s.Get(u.ID)
+			if kept := getErr == nil; kept != tt.wantKept {
+				t.Errorf("upload kept = %t, want %t", kept, tt.wantKept)
+			}
+			assertNoTempFiles(t, destDir)
+		})
+	}
+}
+
+func TestUploadCompleteAfterConflict(t *testing.T) {
+	s := NewUploadStore(t.TempDir())
+	dest := filepath.Join(t.TempDir(), "a.jar")
+	if err := os.WriteFile(dest, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUpload(t, s, "new", "")
+	if _, err := s.WriteChunk(u.ID, 0, strings.NewReader("new"), ""); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *ConflictError
+	if _, _, err := s.Complete(u.ID, dest, ""); !errors.As(err, &conflict) {
+		t.Fatalf("Complete() error = %v, want a conflict", err)
+	}
+	// The data is still there after the conflict.
+	if _, _, err := s.Complete(u.ID, dest, ConflictOverwrite); err != nil {
+		t.Fatalf("Complete() with overwrite: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "new" {
+		t.Errorf("a.jar = %q, want the uploaded data", data)
+	}
+}
+
+func TestUploadAbortAndCleanup(t *testing.T) {
+	s := NewUploadStore(t.TempDir())
+	aborted := newTestUpload(t, s, "a", "")
+	if err := s.Abort(aborted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Abort(aborted.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("second Abort() error = %v, want ErrUploadNotFound", err)
+	}
+	for _, id := range []string{"", "../../etc/passwd", strings.Repeat("z", 32)} {
+		if _, err := s.Get(id); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrUploadNotFound", id, err)
+		}
+	}
+
+	stale := newTestUpload(t, s, "stale", "")
+	fresh, err := s.Create(Upload{Server: "creative", Filename: "b.jar", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := s.Get(stale.ID)
+	info.UpdatedAt = time.Now().Add(-3 * time.Hour)
+	if err := s.writeInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cleanup(2 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(stale.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("stale upload not removed: %v", err)
+	}
+	if _, err := s.Get(fresh.ID); err != nil {
+		t.Errorf("fresh upload removed: %v", err)
+	}
+	if err := s.Abort(fresh.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removed uploads do not keep their locks.
+	if len(s.locks) != 0 {
+		t.Errorf("%d locks left after all uploads were removed", len(s.locks))
+	}
+}
+
+func TestUploadConcurrentChunks(t *testing.T) {
+	// Clients retrying a chunk may send it twice at the same time; exactly
+	// one copy is accepted.
+	s := NewUploadStore(t.TempDir())
+	u := newTestUpload(t, s, "abcd", "")
+	results := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := s.WriteChunk(u.ID, 0, strings.NewReader("ab"), "")
+			results <- err
+		}()
+	}
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		if err := <-results; err == nil {
+			accepted++
+		} else if !errors.Is(err, ErrUploadOffset) {
+			t.Errorf("WriteChunk() error = %v", err)
+		}
+	}
+	if got, _ := s.Get(u.ID); accepted != 1 || got.Offset != 2 {
+		t.Errorf("%d chunks accepted, offset %d; want 1 and 2", accepted, got.Offset)
+	}
+	if len(s.locks) != 0 {
+		t.Errorf("%d locks left after all writes finished", len(s.locks))
+	}
+}
@@ -0,0 +1,268 @@
+package modmanager
+
+import (
+	"strconv"
+	"strings"
+)
+
+// version is a leniently parsed version number such as "1.20.1",
+// "0.15.11+build.1" or "1.21-pre1". Build metadata after "+" is ignored.
+type version struct {
+	release []string
+	pre     string
+}
+
+// parseVersion splits v into release components and a pre-release suffix.
+// It reports false for versions that do not start with a number, such as
+// Minecraft snapshots ("23w13a") or unresolved placeholders.
+func parseVersion(v string) (version, bool) {
+	v = strings.TrimSpace(v)
+	v, _, _ = strings.Cut(v, "+")
+	if v == "" || v[0] < '0' || v[0] > '9' {
+		return version{}, false
+	}
+	release, pre, _ := strings.Cut(v, "-")
+	// Snapshots start with a digit too, but "23w13a" compared as a number
+	// would be 23 and satisfy ">=1.20" without belonging to any release.
+	parts := strings.Split(release, ".")
+	if _, err := strconv.Atoi(parts[0]); err != nil {
+		return version{}, false
+	}
+	return version{release: parts, pre: pre}, true
+}
+
+// compareParts compares two dot-separated components, numerically if both
+// are numbers.
+func compareParts(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1 // numbers sort before words, as in semver
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare returns -1, 0 or 1. Missing release components count as 0 and a
+// pre-release sorts before the corresponding release.
+func (v version) compare(o version) int {
+	for i := 0; i < len(v.release) || i < len(o.release); i++ {
+		a, b := "0", "0"
+		if i < len(v.release) {
+			a = v.release[i]
+		}
+		if i < len(o.release) {
+			b = o.release[i]
+		}
+		if c := compareParts(a, b); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	ap, bp := strings.Split(v.pre, "."), strings.Split(o.pre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if c := compareParts(ap[i], bp[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(ap), len(bp))
+}
+
+// VersionMatches reports whether version satisfies the range declared by a
+// mod for the given loader: semantic version predicates for Fabric and Quilt
+// (">=1.20 <1.21", "~1.20.1", "1.20.x", alternatives separated by " || ")
+// and Maven version ranges for Forge and NeoForge ("[1.20,1.21)").
+//
+// The second result is false if either the version or the range could not
+// be interpreted; callers should then not report a mismatch.
+func VersionMatches(loader, versionRange, ver string) (bool, bool) {
+	versionRange = strings.TrimSpace(versionRange)
+	if versionRange == "" || versionRange == "*" || strings.Contains(versionRange, "${") {
+		return true, true
+	}
+	v, ok := parseVersion(ver)
+	if !ok {
+		return false, false
+	}
+
+	switch loader {
+	case LoaderForge, LoaderNeoForge, LoaderLegacyForge:
+		return mavenRangeMatches(versionRange, v)
+	}
+	for _, alt := range strings.Split(versionRange, "||") {
+		match, ok := semverPredicatesMatch(alt, v)
+		if !ok {
+			return false, false
+		}
+		if match {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// semverPredicatesMatch checks a space-separated list of predicates, all of
+// which must match.
+func semverPredicatesMatch(predicates string, v version) (bool, bool) {
+	for _, p := range strings.Fields(predicates) {
+		match, ok := semverPredicateMatches(p, v)
+		if !ok || !match {
+			return match, ok
+		}
+	}
+	return true, true
+}
+
+// semverPredicateMatches checks a single Fabric-style version predicate.
+func semverPredicateMatches(p string, v version) (bool, bool) {
+	if p == "*" {
+		return true, true
+	}
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(p, candidate) {
+			op, p = candidate, strings.TrimSpace(p[len(candidate):])
+			break
+		}
+	}
+
+	// Wildcards such as "1.20.x" match the given prefix.
+	if i := strings.IndexAny(p, "xX*"); i > 0 && (op == "" || op == "=") {
+		prefix, ok := parseVersion(strings.TrimSuffix(p[:i], "."))
+		if !ok {
+			return false, false
+		}
+		for j, part := range prefix.release {
+			got := "0"
+			if j < len(v.release) {
+				got = v.release[j]
+			}
+			if compareParts(part, got) != 0 {
+				return false, true
+			}
+		}
+		return true, true
+	}
+
+	want, ok := parseVersion(p)
+	if !ok {
+		return false, false
+	}
+	c := v.compare(want)
+	switch op {
+	case "", "=":
+		return c == 0, true
+	case ">=":
+		return c >= 0, true
+	case "<=":
+		return c <= 0, true
+	case ">":
+		return c > 0, true
+	case "<":
+		return c < 0, true
+	case "~", "^":
+		if c < 0 {
+			return false, true
+		}
+		// ~ keeps major and minor, ^ keeps the major version.
+		keep := 2
+		if op == "^" {
+			keep = 1
+		}
+		for j := 0; j < keep && j < len(want.release); j++ {
+			got := "0"
+			if j < len(v.release) {
+				got = v.release[j]
+			}
+			if compareParts(want.release[j], got) != 0 {
+				return false, true
+			}
+		}
+		return true, true
+	}
+	return false, false
+}
+
+// mavenRangeMatches checks a Maven version range such as "[1.20,1.21)",
+// "[47,)", "[1.20.1]" or a union "[1.0,2.0),[3.0,)". A bare version is only
+// a recommendation in Maven and matches everything.
+func mavenRangeMatches(spec string, v version) (bool, bool) {
+	spec = strings.ReplaceAll(spec, " ", "")
+	if spec[0] != '[' && spec[0] != '(' {
+		return true, true
+	}
+
+	for spec != "" {
+		end := strings.IndexAny(spec, "])")
+		if end < 0 || (spec[0] != '[' && spec[0] != '(') {
+			return false, false
+		}
+		restriction := spec[:end+1]
+		spec = strings.TrimPrefix(spec[end+1:], ",")
+
+		match, ok := mavenRestrictionMatches(restriction, v)
+		if !ok {
+			return false, false
+		}
+		if match {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// mavenRestrictionMatches checks a single bracketed Maven restriction.
+func mavenRestrictionMatches(r string, v version) (bool, bool) {
+	lowerInclusive := r[0] == '['
+	upperInclusive := r[len(r)-1] == ']'
+	inner := r[1 : len(r)-1]
+
+	lower, upper, isRange := strings.Cut(inner, ",")
+	if !isRange {
+		want, ok := parseVersion(inner)
+		return ok && v.compare(want) == 0, ok
+	}
+	if lower != "" {
+		want, ok := parseVersion(lower)
+		if !ok {
+			return false, false
+		}
+		c := v.compare(want)
+		if c < 0 || (c == 0 && !lowerInclusive) {
+			return false, true
+		}
+	}
+	if upper != "" {
+		want, ok := parseVersion(upper)
+		if !ok {
+			return false, false
+		}
+		c := v.compare(want)
+		if c > 0 || (c == 0 && !upperInclusive) {
+			return false, true
+		}
+	}
+	return true, true
+}
@@ -0,0 +1,230 @@
+package modmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict policies decide what happens when a file is written to a path
+// that already exists.
+const (
+	ConflictFail      = ""          // refuse with a *ConflictError
+	ConflictOverwrite = "overwrite" // replace the existing file
+	ConflictRename    = "rename"    // keep both, using a free name such as "mod-1.jar"
+	ConflictSkip      = "skip"      // keep the existing file and discard the new one
+)
+
+// ValidConflictPolicy reports whether p is a known conflict policy.
+func ValidConflictPolicy(p string) bool {
+	switch p {
+	case ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip:
+		return true
+	}
+	return false
+}
+
+// ConflictError is returned when the target of a write exists and the
+// policy is ConflictFail.
+type ConflictError struct {
+	Path      string // the existing file
+	Suggested string // a free name that ConflictRename would use
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s already exists", filepath.Base(e.Path))
+}
+
+// WriteResult describes where a file was written.
+type WriteResult struct {
+	Path    string // final location, differs from the requested one after a rename
+	Size    int64
+	Skipped bool // the target existed and ConflictSkip kept it
+	Renamed bool
+}
+
+// tempFilePrefix marks files being written by WriteFileAtomic and uploads
+// being moved into place.
+const tempFilePrefix = ".upload-"
+
+// isTempFile reports whether name is an unfinished write that must not be
+// listed or served.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempFilePrefix)
+}
+
+// maxRenameAttempts bounds the search for a free name.
+const maxRenameAttempts = 1000
+
+// renamedPath returns the n-th alternative name for path: "mod.jar" becomes
+// "mod-1.jar", "world.tar.gz" becomes "world-1.tar.gz".
+func renamedPath(path string, n int) string {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.ToLower(name), ".tar.gz") {
+		ext = name[len(name)-len(".tar.gz"):]
+	}
+	base := strings.TrimSuffix(name, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, n, ext))
+}
+
+// freePath returns the first alternative name for path that does not exist.
+func freePath(path string) string {
+	for n := 1; n < maxRenameAttempts; n++ {
+		candidate := renamedPath(path, n)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// CheckConflict reports what writing to dest with the given policy would do
+// right now, so callers can refuse early before receiving any data. The
+// decision is made again when the file is actually placed.
+func CheckConflict(dest, policy string) (*WriteResult, error) {
+	if _, err := os.Lstat(dest); os.IsNotExist(err) {
+		return &WriteResult{Path: dest}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	switch policy {
+	case ConflictOverwrite:
+		return &WriteResult{Path: dest}, nil
+	case ConflictSkip:
+		return &WriteResult{Path: dest, Skipped: true}, nil
+	case ConflictRename:
+		return &WriteResult{Path: freePath(dest), Renamed: true}, nil
+	}
+	return nil, &ConflictError{Path: dest, Suggested: freePath(dest)}
+}
+
+// WriteFileAtomic writes the data read from r to dest. The data goes to a
+// temporary file in the same directory first, which is synced and renamed
+// into place, so readers never see a partially written file and a failed
+// write leaves any existing file untouched.
+func WriteFileAtomic(dest string, r io.Reader, policy string) (*WriteResult, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), tempFilePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := placeFile(tmp.Name(), dest, policy)
+	if res != nil && !res.Skipped {
+		res.Size = size
+	}
+	return res, err
+}
+
+// placeFile moves the temporary file tmp, which must be in the same
+// directory as dest, to dest according to the conflict policy. Except for
+// ConflictOverwrite the file is hard linked into place, which fails instead
+// of replacing a file created concurrently. tmp is left for the caller to
+// remove.
+func placeFile(tmp, dest, policy string) (*WriteResult, error) {
+	if policy == ConflictOverwrite {
+		if err := os.Rename(tmp, dest); err != nil {
+			return nil, err
+		}
+		return &WriteResult{Path: dest}, nil
+	}
+
+	target := dest
+	for n := 1; n <= maxRenameAttempts; n++ {
+		err := linkNoReplace(tmp, target)
+		if err == nil {
+			return &WriteResult{Path: target, Renamed: target != dest}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		switch policy {
+		case ConflictSkip:
+			return &WriteResult{Path: dest, Skipped: true}, nil
+		case ConflictRename:
+			target = renamedPath(dest, n)
+		default:
+			return nil, &ConflictError{Path: dest, Suggested: freePath(dest)}
+		}
+	}
+	return nil, fmt.Errorf("no free name for %s", filepath.Base(dest))
+}
+
+// linkNoReplace makes src available as dest unless dest exists. Where hard
+// links are not supported it falls back to a check followed by a rename.
+func linkNoReplace(src, dest string) error {
+	err := os.Link(src, dest)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if _, statErr := os.Lstat(dest); statErr == nil {
+		return os.ErrExist
+	}
+	return os.Rename(src, dest)
+}
+
+// stageNextTo moves or copies src to a temporary file in dir, so it can be
+// placed atomically with placeFile.
+func stageNextTo(src, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	if err := os.Rename(src, tmp.Name()); err == nil {
+		return tmp.Name(), nil
+	}
+
+	// Different filesystems: copy instead.
+	in, err := os.Open(src)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(tmp.Name(), os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Chmod(0644)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	os.Remove(src)
+	return tmp.Name(), nil
+}
@@ -0,0 +1,200 @@
+package modmanager
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenamedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		n    int
+		want string
+	}{
+		{"mods/sodium.jar", 1, "mods/sodium-1.jar"},
+		{"mods/sodium.jar", 12, "mods/sodium-12.jar"},
+		{"world.tar.gz", 1, "world-1.tar.gz"},
+		{"world.TAR.GZ", 2, "world-2.TAR.GZ"},
+		{"README", 1, "README-1"},
+		{".mcowignore", 1, "-1.mcowignore"},
+	}
+	for _, tt := range tests {
+		if got := renamedPath(filepath.FromSlash(tt.path), tt.n); got != filepath.FromSlash(tt.want) {
+			t.Errorf("renamedPath(%q, %d) = %q, want %q", tt.path, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestValidConflictPolicy(t *testing.T) {
+	for _, p := range []string{ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip} {
+		if !ValidConflictPolicy(p) {
+			t.Errorf("ValidConflictPolicy(%q) = false", p)
+		}
+	}
+	for _, p := range []string{"fail", "Overwrite", "merge"} {
+		if ValidConflictPolicy(p) {
+			t.Errorf("ValidConflictPolicy(%q) = true", p)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		subdir   string   // created by the write
+		existing []string // files in the directory before the write
+		policy   string
+
+		wantErr     bool // a *ConflictError
+		wantPath    string
+		wantSkipped bool
+		wantRenamed bool
+		wantSize    int64
+	}{
+		{name: "new file", policy: ConflictFail, wantPath: "a.jar", wantSize: 3},
+		{name: "new file in a new directory", subdir: "mods/new", policy: ConflictFail, wantPath: "a.jar", wantSize: 3},
+		{name: "conflict", existing: []string{"a.jar"}, policy: ConflictFail, wantErr: true},
+		{name: "overwrite", existing: []string{"a.jar"}, policy: ConflictOverwrite, wantPath: "a.jar", wantSize: 3},
+		{name: "skip", existing: []string{"a.jar"}, policy: ConflictSkip, wantPath: "a.jar", wantSkipped: true},
+		{name: "rename", existing: []string{"a.jar"}, policy: ConflictRename, wantPath: "a-1.jar", wantRenamed: true, wantSize: 3},
+		{name: "rename past taken names", existing: []string{"a.jar", "a-1.jar", "a-2.jar"}, policy: ConflictRename, wantPath: "a-3.jar", wantRenamed: true, wantSize: 3},
+		{name: "skip without conflict", policy: ConflictSkip, wantPath: "a.jar", wantSize: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), filepath.FromSlash(tt.subdir))
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			res, err := WriteFileAtomic(filepath.Join(dir, "a.jar"), strings.NewReader("new"), tt.policy)
+			var conflict *ConflictError
+			if tt.wantErr {
+				if !errors.As(err, &conflict) || conflict.Path != filepath.Join(dir, "a.jar") || conflict.Suggested != filepath.Join(dir, "a-1.jar") {
+					t.Fatalf("WriteFileAtomic() error = %v, want a conflict suggesting a-1.jar", err)
+				}
+			} else if err != nil {
+				t.Fatalf("WriteFileAtomic() error = %v", err)
+			} else {
+				want := WriteResult{Path: filepath.Join(dir, tt.wantPath), Size: tt.wantSize, Skipped: tt.wantSkipped, Renamed: tt.wantRenamed}
+				if *res != want {
+					t.Errorf("WriteFileAtomic() = %+v, want %+v", *res, want)
+				}
+				wantContent := "new"
+				if tt.wantSkipped {
+					wantContent = "old"
+				}
+				if data, _ := os.ReadFile(res.Path); string(data) != wantContent {
+					t.Errorf("%s = %q, want %q", tt.wantPath, data, wantContent)
+				}
+				if info, err := os.Stat(res.Path); err != nil || info.Mode().Perm() != 0644 {
+					t.Errorf("%s mode = %v, %v, want 0644", tt.wantPath, info.Mode(), err)
+				}
+			}
+			// Existing files are only replaced by overwrite.
+			for _, name := range tt.existing {
+				if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != "old" && !(name == "a.jar" && tt.policy == ConflictOverwrite) {
+					t.Errorf("%s changed to %q", name, data)
+				}
+			}
+			assertNoTempFiles(t, dir)
+		})
+	}
+}
+
+func TestWriteFileAtomicFailedWrite(t *testing.T) {
+	// A reader failing midway leaves the existing file untouched.
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "a.jar")
+	if err := os.WriteFile(dest, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := io.MultiReader(strings.NewReader("partial"), errReader{})
+	if _, err := WriteFileAtomic(dest, broken, ConflictOverwrite); err == nil {
+		t.Fatal("WriteFileAtomic() succeeded with a failing reader")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("a.jar = %q after a failed write", data)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestCheckConflict(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.jar")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	free := filepath.Join(dir, "b.jar")
+
+	tests := []struct {
+		dest, policy string
+		want         *WriteResult
+	}{
+		{free, ConflictFail, &WriteResult{Path: free}},
+		{free, ConflictSkip, &WriteResult{Path: free}},
+		{existing, ConflictOverwrite, &WriteResult{Path: existing}},
+		{existing, ConflictSkip, &WriteResult{Path: existing, Skipped: true}},
+		{existing, ConflictRename, &WriteResult{Path: filepath.Join(dir, "a-1.jar"), Renamed: true}},
+		{existing, ConflictFail, nil},
+	}
+	for _, tt := range tests {
+		got, err := CheckConflict(tt.dest, tt.policy)
+		if tt.want == nil {
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				t.Errorf("CheckConflict(%s, %q) error = %v, want a conflict", filepath.Base(tt.dest), tt.policy, err)
+			}
+			continue
+		}
+		if err != nil || *got != *tt.want {
+			t.Errorf("CheckConflict(%s, %q) = %+v, %v, want %+v", filepath.Base(tt.dest), tt.policy, got, err, tt.want)
+		}
+	}
+	// Checking never writes anything.
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("CheckConflict created files: %v", entries)
+	}
+}
+
+func TestStageNextTo(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "upload.part")
+	if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "mods")
+	tmp, err := stageNextTo(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(tmp) != dir || !isTempFile(filepath.Base(tmp)) {
+		t.Errorf("stageNextTo() = %s, want a temporary file in %s", tmp, dir)
+	}
+	if data, _ := os.ReadFile(tmp); string(data) != "data" {
+		t.Errorf("staged file = %q", data)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists after staging: %v", err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// assertNoTempFiles fails if unfinished writes are left in dir.
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if isTempFile(e.Name()) {
+			t.Errorf("temporary file %s left in %s", e.Name(), dir)
+		}
+	}
+}
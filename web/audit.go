@@ -0,0 +1,155 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/tionis/mcow/auth"
+	"github.com/tionis/mcow/database"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// auditPageLimit caps the number of entries shown on the audit log page.
+const auditPageLimit = 500
+
+// audit records an administrative action performed by the current user.
+// before and after are stored as JSON snapshots; nil values are omitted.
+func (h *WebHandler) audit(r *http.Request, action, target string, before, after interface{}) {
+	entry := &database.AuditEntry{
+		User:   h.Auth.GetUserEmail(r),
+		Action: action,
+		Target: target,
+		Before: auditJSON(before),
+		After:  auditJSON(after),
+		IP:     auth.ClientIP(r),
+	}
+	if err := h.Store.InsertAuditEntry(entry); err != nil {
+		log.Printf("Error writing audit entry %s %s: %v", action, target, err)
+	}
+}
+
+// RecordAuthEvent stores login and logout events reported by the authenticator.
+func (h *WebHandler) RecordAuthEvent(r *http.Request, user, action, detail string) {
+	entry := &database.AuditEntry{
+		User:   user,
+		Action: action,
+		Target: detail,
+		IP:     auth.ClientIP(r),
+	}
+	if err := h.Store.InsertAuditEntry(entry); err != nil {
+		log.Printf("Error writing audit entry %s for %s: %v", action, user, err)
+	}
+}
+
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// parseAuditFilter reads the audit log filter from query parameters.
+// Dates are given as YYYY-MM-DD; "to" is inclusive.
+func parseAuditFilter(r *http.Request) database.AuditFilter {
+	q := r.URL.Query()
+	f := database.AuditFilter{
+		User:   q.Get("user"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+	if t, err := time.ParseInLocation("2006-01-02", q.Get("from"), time.Local); err == nil {
+		f.Since = t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", q.Get("to"), time.Local); err == nil {
+		f.Until = t.AddDate(0, 0, 1)
+	}
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit > 0 {
+		f.Limit = limit
+	}
+	return f
+}
+
+// AuditLog renders the filterable audit log page.
+func (h *WebHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	filter := parseAuditFilter(r)
+	if filter.Limit == 0 || filter.Limit > auditPageLimit {
+		filter.Limit = auditPageLimit
+	}
+
+	entries, err := h.Store.ListAuditEntries(filter)
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+	actions, err := h.Store.ListAuditActions()
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Authenticated bool
+		UserEmail     string
+		Entries       []database.AuditEntry
+		Actions       []string
+		Query         map[string]string
+		RawQuery      string
+		Limit         int
+	}{
+		Authenticated: true,
+		UserEmail:     h.Auth.GetUserEmail(r),
+		Entries:       entries,
+		Actions:       actions,
+		Query: map[string]string{
+			"user":   r.URL.Query().Get("user"),
+			"action": r.URL.Query().Get("action"),
+			"target": r.URL.Query().Get("target"),
+			"from":   r.URL.Query().Get("from"),
+			"to":     r.URL.Query().Get("to"),
+		},
+		RawQuery: r.URL.RawQuery,
+		Limit:    filter.Limit,
+	}
+
+	funcMap := template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Local().Format("2006-01-02 15:04:05")
+		},
+	}
+
+	tmpl, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "templates/base.html", "templates/audit.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AuditExport returns the audit entries matching the filter as a JSON download.
+func (h *WebHandler) AuditExport(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.Store.ListAuditEntries(parseAuditFilter(r))
+	if err != nil {
+		log.Printf("Error exporting audit log: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+
+	filename := "mcow-audit-" + time.Now().Format("2006-01-02") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		log.Printf("Error encoding audit log to JSON: %v", err)
+	}
+}
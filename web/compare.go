@@ -0,0 +1,56 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// Compare renders the comparison view for the mod sets of two servers or
+// releases. The diff itself is loaded from /api/mods/diff.
+func (h *WebHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	servers, err := h.Store.ListServers()
+	if err != nil {
+		http.Error(w, "Failed to load servers", http.StatusInternalServerError)
+		return
+	}
+
+	isAuthenticated := h.Auth != nil && h.Auth.IsAuthenticated(r)
+
+	// Offer every visible server and its releases ("server@version").
+	var refs []string
+	for _, s := range servers {
+		if s.State == "offline" && !isAuthenticated {
+			continue
+		}
+		refs = append(refs, s.Name)
+		releases, err := h.Store.ListReleases(s.ID)
+		if err != nil {
+			http.Error(w, "Failed to load releases", http.StatusInternalServerError)
+			return
+		}
+		for _, rel := range releases {
+			refs = append(refs, s.Name+"@"+rel.Version)
+		}
+	}
+
+	data := struct {
+		Refs          []string
+		A, B          string
+		Authenticated bool
+	}{
+		Refs:          refs,
+		A:             r.URL.Query().Get("a"),
+		B:             r.URL.Query().Get("b"),
+		Authenticated: isAuthenticated,
+	}
+
+	tmpl, err := template.New("base.html").ParseFS(templateFS, "templates/base.html", "templates/compare.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"errors"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// textFileResponse is an editable file sent to the editor.
+type textFileResponse struct {
+	Path string `json:"path"`
+	*modmanager.TextFile
+}
+
+// editConflictResponse is returned when a file was changed by someone else
+// since it was opened in the editor.
+type editConflictResponse struct {
+	Error   string            `json:"error"`
+	Code    string            `json:"code"`
+	Current *textFileResponse `json:"current,omitempty"` // nil if the file was deleted
+}
+
+// textFilePath validates the serverName and path form values of an editor
+// request and returns the relative and absolute path.
+func (h *WebHandler) textFilePath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	serverName := r.FormValue("serverName")
+	relPath := strings.Trim(filepath.ToSlash(filepath.Clean("/"+r.FormValue("path"))), "/")
+	if serverName == "" || relPath == "" || !isValidPath(serverName, relPath) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid path"})
+		return "", "", false
+	}
+	if !modmanager.IsEditable(relPath) {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": modmanager.ErrNotEditable.Error()})
+		return "", "", false
+	}
+	return relPath, filepath.Join(h.Config.ModDataPath, serverName, filepath.FromSlash(relPath)), true
+}
+
+// writeTextFileError maps errors of reading or writing a text file to responses.
+func writeTextFileError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+	case errors.Is(err, modmanager.ErrTextTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	case errors.Is(err, modmanager.ErrNotEditable):
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+	case errors.Is(err, modmanager.ErrInvalidContent):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("Error editing file: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+}
+
+// HandleTextFileGet returns the content and version of an editable file.
+func (h *WebHandler) HandleTextFileGet(w http.ResponseWriter, r *http.Request) {
+	relPath, fullPath, ok := h.textFilePath(w, r)
+	if !ok {
+		return
+	}
+	file, err := modmanager.ReadTextFile(fullPath)
+	if err != nil {
+		writeTextFileError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, textFileResponse{Path: relPath, TextFile: file})
+}
+
+// HandleTextFileSave saves an editable file. "version" must be the version
+// the editor loaded, or empty to create a new file. If the file changed in
+// the meantime, 409 is returned with its current content.
+func (h *WebHandler) HandleTextFileSave(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*modmanager.MaxTextFileSize)
+	relPath, fullPath, ok := h.textFilePath(w, r)
+	if !ok {
+		return
+	}
+	serverName := r.FormValue("serverName")
+	version := r.FormValue("version")
+
+	// Browsers send line breaks in form fields as CRLF; keep the line
+	// endings the file had.
+	content := strings.ReplaceAll(r.FormValue("content"), "\r\n", "\n")
+	var before interface{}
+	if old, err := modmanager.ReadTextFile(fullPath); err == nil {
+		before = map[string]interface{}{"version": old.Version, "size": old.Size}
+		if strings.Contains(old.Content, "\r\n") {
+			content = strings.ReplaceAll(content, "\n", "\r\n")
+		}
+	}
+
+	policy := modmanager.ConflictOverwrite
+	if version == "" {
+		policy = modmanager.ConflictFail
+	}
+	if err := h.checkFileWrite(serverName, fullPath, policy, int64(len(content))); err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	file, err := modmanager.WriteTextFile(fullPath, []byte(content), version)
+	var conflict *modmanager.EditConflictError
+	if errors.As(err, &conflict) {
+		resp := editConflictResponse{Error: conflict.Error(), Code: "conflict"}
+		if conflict.Current != nil {
+			resp.Current = &textFileResponse{Path: relPath, TextFile: conflict.Current}
+		}
+		writeJSON(w, http.StatusConflict, resp)
+		return
+	}
+	if err != nil {
+		writeTextFileError(w, err)
+		return
+	}
+
+	h.Index.Invalidate(serverName)
+	action := "file.edit"
+	if version == "" {
+		action = "file.create"
+	}
+	h.audit(r, action, filepath.Join(serverName, relPath), before, map[string]interface{}{"version": file.Version, "size": file.Size})
+	writeJSON(w, http.StatusOK, textFileResponse{Path: relPath, TextFile: file})
+}
+
+// HandleMarkdownPreview renders markdown for the editor's live preview.
+// Given the serverName and path of the file, relative links are resolved
+// like for the saved file.
+func (h *WebHandler) HandleMarkdownPreview(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*modmanager.MaxTextFileSize)
+	content := []byte(r.FormValue("content"))
+	serverName, relPath := r.FormValue("serverName"), r.FormValue("path")
+	var html string
+	var err error
+	if serverName != "" && isValidPath(serverName, relPath) {
+		html, err = modmanager.RenderMarkdownFile(content, serverName, relPath)
+	} else {
+		html, err = modmanager.RenderMarkdown(content)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"html": html})
+}
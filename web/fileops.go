@@ -0,0 +1,239 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tionis/mcow/auth"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// transferResult is the outcome of moving or copying a single item.
+type transferResult struct {
+	Path      string `json:"path"`                // source, relative to the source server directory
+	Dest      string `json:"dest,omitempty"`      // final destination, relative to the target server directory
+	Skipped   bool   `json:"skipped,omitempty"`   // the target existed and was kept
+	Renamed   bool   `json:"renamed,omitempty"`   // the item was given a free name
+	Error     string `json:"error,omitempty"`     // why the item was not transferred
+	Conflict  bool   `json:"conflict,omitempty"`  // Error is caused by an existing target
+	Suggested string `json:"suggested,omitempty"` // name the "rename" policy would use
+}
+
+// transferResponse lists the results of a (bulk) move or copy.
+type transferResponse struct {
+	Server       string           `json:"server"`
+	TargetServer string           `json:"targetServer"`
+	TargetDir    string           `json:"targetDir"`
+	Results      []transferResult `json:"results"`
+}
+
+// HandleFileMove moves or renames files and directories.
+func (h *WebHandler) HandleFileMove(w http.ResponseWriter, r *http.Request) {
+	h.handleTransfer(w, r, "file.move", modmanager.MovePath)
+}
+
+// HandleFileCopy copies files and directories, also into another server's
+// directory.
+func (h *WebHandler) HandleFileCopy(w http.ResponseWriter, r *http.Request) {
+	h.handleTransfer(w, r, "file.copy", modmanager.CopyPath)
+}
+
+// handleTransfer moves or copies every "path" of serverName into the
+// directory "targetDir" of "targetServer" (default: the same server). With a
+// single path, "name" renames the item. Items are processed independently,
+// so one failure does not stop a bulk operation.
+func (h *WebHandler) handleTransfer(w http.ResponseWriter, r *http.Request, action string, transfer func(src, dest, policy string) (*modmanager.WriteResult, error)) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	serverName := r.FormValue("serverName")
+	targetServer := r.FormValue("targetServer")
+	if targetServer == "" {
+		targetServer = serverName
+	}
+	targetDir := strings.Trim(filepath.ToSlash(r.FormValue("targetDir")), "/")
+	name := r.FormValue("name")
+	paths := r.Form["path"]
+
+	if serverName == "" || !isValidPath(serverName, "") || !isValidPath(targetServer, targetDir) {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if len(paths) == 0 {
+		http.Error(w, "No files selected", http.StatusBadRequest)
+		return
+	}
+	if name != "" && (len(paths) > 1 || !isValidFilename(name)) {
+		http.Error(w, "Invalid name", http.StatusBadRequest)
+		return
+	}
+	policy, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	source, err := h.Store.GetServerByName(serverName)
+	if err != nil || source == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	target := source
+	if targetServer != serverName {
+		target, err = h.Store.GetServerByName(targetServer)
+		if err != nil || target == nil {
+			http.Error(w, "Target server not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	targetBase := filepath.Join(h.Config.ModDataPath, targetServer, filepath.FromSlash(targetDir))
+	if info, err := os.Stat(targetBase); err == nil && !info.IsDir() {
+		http.Error(w, "Target is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	// Moves within a server only need to respect the upload policy, copies
+	// and moves to another server also count against its quota.
+	counts := action == "file.copy" || targetServer != serverName
+	quota, err := h.newQuotaTracker(targetServer)
+	if err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	resp := transferResponse{Server: serverName, TargetServer: targetServer, TargetDir: targetDir, Results: []transferResult{}}
+	failed, conflicts, changed := 0, 0, false
+	for _, p := range paths {
+		rel := strings.Trim(filepath.ToSlash(filepath.Clean(p)), "/")
+		result := transferResult{Path: rel}
+		if !isValidPath(serverName, rel) || rel == "" || rel == "." {
+			result.Error = "invalid path"
+			failed++
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		itemName := name
+		if itemName == "" {
+			itemName = filepath.Base(filepath.FromSlash(rel))
+		}
+		src := filepath.Join(h.Config.ModDataPath, serverName, filepath.FromSlash(rel))
+		dest := filepath.Join(targetBase, itemName)
+
+		change, err := quota.checkPath(src, dest, policy, counts)
+		var res *modmanager.WriteResult
+		if err == nil {
+			res, err = transfer(src, dest, policy)
+		}
+		var conflict *modmanager.ConflictError
+		switch {
+		case quotaStatus(err) != 0:
+			result.Error = err.Error()
+		case os.IsNotExist(err):
+			result.Error = modmanager.ErrSourceNotFound.Error()
+		case errors.As(err, &conflict):
+			result.Error = conflict.Error()
+			result.Conflict = true
+			result.Suggested = h.serverRelPath(targetServer, conflict.Suggested)
+			conflicts++
+		case err != nil:
+			result.Error = transferErrorMessage(err)
+			if result.Error == "" {
+				log.Printf("Error in %s of %s/%s: %v", action, serverName, rel, err)
+				result.Error = "internal error"
+			}
+		case res.Skipped:
+			result.Skipped = true
+			result.Dest = h.serverRelPath(targetServer, res.Path)
+		default:
+			result.Dest = h.serverRelPath(targetServer, res.Path)
+			result.Renamed = res.Renamed
+			changed = true
+			quota.add(change)
+			if err := h.transferSideOverrides(source, rel, target, result.Dest, action == "file.move"); err != nil {
+				log.Printf("Error updating side overrides after %s of %s/%s: %v", action, serverName, rel, err)
+			}
+			h.audit(r, action, filepath.Join(serverName, rel), nil, map[string]interface{}{"to": targetServer + "/" + result.Dest, "size": res.Size})
+		}
+		if result.Error != "" {
+			failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if changed {
+		h.Index.Invalidate(serverName)
+		if targetServer != serverName {
+			h.Index.Invalidate(targetServer)
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case failed > 0 && conflicts == failed:
+		status = http.StatusConflict
+	case failed > 0:
+		status = http.StatusUnprocessableEntity
+	}
+	if auth.WantsJSON(r) {
+		writeJSON(w, status, resp)
+		return
+	}
+	if failed > 0 {
+		var b strings.Builder
+		for _, res := range resp.Results {
+			if res.Error != "" {
+				fmt.Fprintf(&b, "%s: %s\n", res.Path, res.Error)
+			}
+		}
+		http.Error(w, b.String(), status)
+		return
+	}
+	http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
+}
+
+// transferErrorMessage returns a message for errors caused by the request,
+// or "" for unexpected errors.
+func transferErrorMessage(err error) string {
+	for _, known := range []error{modmanager.ErrIntoItself, modmanager.ErrSamePath, modmanager.ErrOverwriteDir, modmanager.ErrSourceNotFound, modmanager.ErrUnsupportedEntry} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	return ""
+}
+
+// transferSideOverrides carries the side overrides of a moved or copied
+// item, and of everything below it for directories, over to its new path.
+func (h *WebHandler) transferSideOverrides(source *database.Server, from string, target *database.Server, to string, move bool) error {
+	overrides, err := h.Store.GetSideOverrides(source.ID)
+	if err != nil {
+		return err
+	}
+	for path, side := range overrides {
+		var newPath string
+		switch {
+		case path == from:
+			newPath = to
+		case strings.HasPrefix(path, from+"/"):
+			newPath = to + strings.TrimPrefix(path, from)
+		default:
+			continue
+		}
+		if err := h.Store.SetSideOverride(target.ID, newPath, side); err != nil {
+			return err
+		}
+		if move && (target.ID != source.ID || newPath != path) {
+			if err := h.Store.SetSideOverride(source.ID, path, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
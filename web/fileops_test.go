@@ -0,0 +1,115 @@
+package web
+
+import (
+	"github.com/tionis/mcow/database"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTransferSideOverrides(t *testing.T) {
+	overrides := map[string]string{
+		"mods/a.jar":           "client",
+		"mods/extra/b.jar":     "server",
+		"mods/extra/sub/c.jar": "both",
+		"mods/extra-d.jar":     "client", // shares the prefix but not the directory
+	}
+	tests := []struct {
+		name       string
+		from, to   string
+		otherDest  bool // the target is another server
+		move       bool
+		wantSource map[string]string
+		wantTarget map[string]string // only checked for another server
+	}{
+		{
+			name: "copy file", from: "mods/a.jar", to: "disabled/a.jar",
+			wantSource: merge(overrides, map[string]string{"disabled/a.jar": "client"}),
+		},
+		{
+			name: "move file", from: "mods/a.jar", to: "disabled/a.jar", move: true,
+			wantSource: merge(overrides, map[string]string{"mods/a.jar": "", "disabled/a.jar": "client"}),
+		},
+		{
+			name: "move directory", from: "mods/extra", to: "mods/more", move: true,
+			wantSource: merge(overrides, map[string]string{
+				"mods/extra/b.jar": "", "mods/extra/sub/c.jar": "",
+				"mods/more/b.jar": "server", "mods/more/sub/c.jar": "both",
+			}),
+		},
+		{
+			name: "unrelated path", from: "config", to: "old/config", move: true,
+			wantSource: overrides,
+		},
+		{
+			name: "copy to another server", from: "mods/extra", to: "mods/extra", otherDest: true,
+			wantSource: overrides,
+			wantTarget: map[string]string{"mods/extra/b.jar": "server", "mods/extra/sub/c.jar": "both"},
+		},
+		{
+			name: "move to another server", from: "mods/a.jar", to: "mods/a.jar", otherDest: true, move: true,
+			wantSource: merge(overrides, map[string]string{"mods/a.jar": ""}),
+			wantTarget: map[string]string{"mods/a.jar": "client"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := database.NewStore(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.DB.Close()
+			h := &WebHandler{Store: store}
+			source, target := createTestServer(t, store, "creative"), createTestServer(t, store, "survival")
+			for path, side := range overrides {
+				if err := store.SetSideOverride(source.ID, path, side); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tt.otherDest {
+				target = source
+			}
+
+			if err := h.transferSideOverrides(source, tt.from, target, tt.to, tt.move); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.GetSideOverrides(source.ID); !reflect.DeepEqual(got, tt.wantSource) {
+				t.Errorf("source overrides = %v, want %v", got, tt.wantSource)
+			}
+			if tt.otherDest {
+				if got, _ := store.GetSideOverrides(target.ID); !reflect.DeepEqual(got, tt.wantTarget) {
+					t.Errorf("target overrides = %v, want %v", got, tt.wantTarget)
+				}
+			}
+		})
+	}
+}
+
+func createTestServer(t *testing.T, store *database.Store, name string) *database.Server {
+	t.Helper()
+	if err := store.CreateServer(&database.Server{Name: name, State: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := store.GetServerByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// merge returns a copy of base with changes applied; an empty value removes
+// the key.
+func merge(base, changes map[string]string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range changes {
+		if v == "" {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
@@ -3,9 +3,10 @@ package web
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
+	"log"
 	"github.com/tionis/mcow/auth"
 	"github.com/tionis/mcow/config"
 	"github.com/tionis/mcow/database"
@@ -27,15 +28,25 @@ type WebHandler struct {
 	Store  *database.Store
 	Config *config.Config
 	Auth   *auth.Authenticator
+	Index  *modmanager.Index
+
+	// Releases stores the files of release snapshots.
+	Releases *modmanager.BlobStore
+	// Uploads stages resumable uploads until they are complete.
+	Uploads *modmanager.UploadStore
+	// Trash keeps deleted files for restoring; nil if deletes are immediate.
+	Trash *modmanager.Trash
 }
 
 // NewWebHandler creates a new WebHandler.
 func NewWebHandler(store *database.Store, cfg *config.Config, auth *auth.Authenticator) *WebHandler {
-	return &WebHandler{Store: store, Config: cfg, Auth: auth}
+	h := &WebHandler{Store: store, Config: cfg, Auth: auth, Uploads: modmanager.NewUploadStore(cfg.UploadStagingPath)}
+	if cfg.TrashPath != "" {
+		h.Trash = modmanager.NewTrash(cfg.TrashPath)
+	}
+	return h
 }
 
-// ... (Home, ServerDetail, Admin handlers remain unchanged) ...
-
 // FileManager renders the file manager for a specific server.
 func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -47,7 +58,7 @@ func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	modTree, err := modmanager.ScanModDirectory(h.Config.ModDataPath, serverName)
+	modTree, err := h.Index.FullTree(serverName)
 	// If dir not found, maybe just empty tree or create it?
 	// Create if not exists to allow uploading
 	if err != nil && strings.Contains(err.Error(), "not found") {
@@ -58,16 +69,55 @@ func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	overrides, err := h.Store.GetSideOverrides(server.ID)
+	if err != nil {
+		http.Error(w, "Error loading side overrides: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	modTree = modmanager.ClassifyTree(modTree, overrides)
+	counts, err := h.Store.GetDownloadCounts(server.ID, "")
+	if err != nil {
+		http.Error(w, "Error loading download counts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	modTree = modmanager.CountDownloads(modTree, counts)
+	report := modmanager.CheckCompatibility(modTree, modmanager.EnvironmentFromMetadata(server.Metadata))
+
+	quota, err := h.Store.GetQuota(server.ID)
+	if err != nil {
+		http.Error(w, "Error loading quota: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Other servers are targets for copying and moving files.
+	servers, err := h.Store.ListServers()
+	if err != nil {
+		http.Error(w, "Error loading servers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		Server        *database.Server
 		Authenticated bool
 		UserEmail     string
 		Files         *modmanager.ModItem
+		Overrides     map[string]string
+		Report        *modmanager.CompatibilityReport
+		Servers       []database.Server
+		TrashEnabled  bool
+		Quota         modmanager.Quota
+		Usage         modmanager.Usage
 	}{
 		Server:        server,
 		Authenticated: true,
 		UserEmail:     h.Auth.GetUserEmail(r),
 		Files:         modTree,
+		Overrides:     overrides,
+		Report:        report,
+		Servers:       servers,
+		TrashEnabled:  h.Trash != nil,
+		Quota:         quota,
+		Usage:         modmanager.TreeUsage(modTree),
 	}
 
 	funcMap := template.FuncMap{
@@ -75,6 +125,7 @@ func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 			b, _ := json.Marshal(v)
 			return string(b)
 		},
+		"editable": modmanager.IsEditable,
 		"dict": func(values ...interface{}) (map[string]interface{}, error) {
 			if len(values)%2 != 0 {
 				return nil, fmt.Errorf("invalid dict call")
@@ -90,6 +141,9 @@ func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 			return dict, nil
 		},
 	}
+	for name, fn := range quotaFuncs {
+		funcMap[name] = fn
+	}
 
 	tmpl, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "templates/base.html", "templates/filemanager.html")
 	if err != nil {
@@ -102,14 +156,49 @@ func (h *WebHandler) FileManager(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleFileUpload handles uploading files.
+// HandleFileUpload handles uploading files. The file is written to a
+// temporary file and renamed into place, so a failed upload never leaves a
+// truncated file behind. The "conflict" form value decides what happens if
+// the file exists (overwrite, rename or skip); without it the upload is
+// refused with a structured 409 error.
 func (h *WebHandler) HandleFileUpload(w http.ResponseWriter, r *http.Request) {
-	// Limit 1GB (adjust as needed)
-	r.ParseMultipartForm(1024 << 20)
+	// The body is limited before anything is spooled to disk: by the quota
+	// of the server named in the URL, or else by EXTRACT_MAX_SIZE_MB.
+	urlServer := r.URL.Query().Get("serverName")
+	limit := h.Config.ExtractMaxSize
+	if urlServer != "" {
+		var err error
+		if limit, err = h.uploadBodyLimit(urlServer); err != nil {
+			writeQuotaError(w, r, err)
+			return
+		}
+	} else if limit > 0 {
+		limit += uploadOverhead
+	}
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	// Parts beyond 32MB are spooled to temporary files instead of memory.
+	// Large files should use the resumable upload API instead.
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeQuotaError(w, r, fmt.Errorf("%w: uploads to this server may be at most %s", modmanager.ErrFileTooLarge, formatSize(limit-uploadOverhead)))
+			return
+		}
+		http.Error(w, "Invalid upload form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
 
 	serverName := r.FormValue("serverName")
 	relPath := r.FormValue("path")
-	
+	if urlServer != "" && r.PostFormValue("serverName") != urlServer {
+		http.Error(w, "Server name in the URL and the form differ", http.StatusBadRequest)
+		return
+	}
+
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Error retrieving file", http.StatusBadRequest)
@@ -117,49 +206,121 @@ func (h *WebHandler) HandleFileUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if !isValidPath(serverName, relPath) {
+	if !isValidPath(serverName, relPath) || !isValidFilename(header.Filename) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-
-	targetDir := filepath.Join(h.Config.ModDataPath, serverName, relPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		http.Error(w, "Error creating directory", http.StatusInternalServerError)
+	policy, ok := conflictPolicy(w, r)
+	if !ok {
 		return
 	}
 
-	targetPath := filepath.Join(targetDir, header.Filename)
-	out, err := os.Create(targetPath)
-	if err != nil {
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
+	if r.FormValue("extract") == "1" {
+		if !modmanager.IsExtractable(header.Filename) {
+			http.Error(w, "Only .zip and .tar.gz archives can be extracted", http.StatusBadRequest)
+			return
+		}
+		limits, err := h.extractLimits(serverName)
+		if err != nil {
+			writeQuotaError(w, r, err)
+			return
+		}
+		destDir := filepath.Join(h.Config.ModDataPath, serverName, relPath)
+		report, err := modmanager.ExtractArchive(file, header.Size, header.Filename, destDir, policy, limits)
+		h.finishExtract(w, r, serverName, relPath, header.Filename, report, err)
 		return
 	}
-	defer out.Close()
 
-	if _, err := io.Copy(out, file); err != nil {
+	targetPath := filepath.Join(h.Config.ModDataPath, serverName, relPath, header.Filename)
+	if err := h.checkFileWrite(serverName, targetPath, policy, header.Size); err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+	before := existingFileInfo(targetPath)
+	res, err := modmanager.WriteFileAtomic(targetPath, file, policy)
+	var conflict *modmanager.ConflictError
+	if errors.As(err, &conflict) {
+		if auth.WantsJSON(r) {
+			writeJSON(w, http.StatusConflict, h.newConflictResponse(serverName, conflict))
+		} else {
+			http.Error(w, conflict.Error()+"; choose overwrite, rename or skip", http.StatusConflict)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error writing upload %s for server %s: %v", header.Filename, serverName, err)
 		http.Error(w, "Error writing file", http.StatusInternalServerError)
 		return
 	}
 
+	if !res.Skipped {
+		if res.Renamed {
+			before = nil
+		}
+		h.Index.Invalidate(serverName)
+		h.audit(r, "file.upload", filepath.Join(serverName, h.serverRelPath(serverName, res.Path)), before, map[string]interface{}{"size": res.Size})
+	}
+
+	if auth.WantsJSON(r) {
+		writeJSON(w, http.StatusOK, writeResultResponse{Path: h.serverRelPath(serverName, res.Path), Size: res.Size, Skipped: res.Skipped, Renamed: res.Renamed})
+		return
+	}
 	http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
 }
 
-// HandleFileDelete handles deleting files or directories.
+// HandleFileDelete handles deleting files or directories. Several "path"
+// values delete several items at once. Deleted items are moved to the
+// server's trash unless the trash is disabled.
 func (h *WebHandler) HandleFileDelete(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
 	serverName := r.FormValue("serverName")
-	relPath := r.FormValue("path") // full relative path including filename
+	relPaths := r.Form["path"] // full relative paths including filename
 
-	if !isValidPath(serverName, relPath) {
+	if len(relPaths) == 0 {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
+	for _, relPath := range relPaths {
+		if !isValidPath(serverName, relPath) || serverName == "" || strings.Trim(filepath.Clean("/"+relPath), "/") == "" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+	}
 
-	targetPath := filepath.Join(h.Config.ModDataPath, serverName, relPath)
-	if err := os.RemoveAll(targetPath); err != nil {
-		http.Error(w, "Error deleting file", http.StatusInternalServerError)
-		return
+	serverDir := filepath.Join(h.Config.ModDataPath, serverName)
+	for _, relPath := range relPaths {
+		targetPath := filepath.Join(serverDir, relPath)
+		var before, after map[string]interface{}
+		if info, err := os.Stat(targetPath); err == nil {
+			before = map[string]interface{}{"isDir": info.IsDir(), "size": info.Size()}
+		}
+
+		var err error
+		if h.Trash != nil {
+			var item *modmanager.TrashItem
+			item, err = h.Trash.Put(serverName, serverDir, relPath, h.Auth.GetUserEmail(r))
+			if errors.Is(err, modmanager.ErrSourceNotFound) {
+				continue
+			}
+			if err == nil {
+				after = map[string]interface{}{"trashId": item.ID}
+			}
+		} else {
+			err = os.RemoveAll(targetPath)
+		}
+		if err != nil {
+			log.Printf("Error deleting %s/%s: %v", serverName, relPath, err)
+			h.Index.Invalidate(serverName)
+			http.Error(w, "Error deleting file", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, "file.delete", filepath.Join(serverName, relPath), before, after)
 	}
 
+	h.Index.Invalidate(serverName)
 	http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
 }
 
@@ -180,6 +341,54 @@ func (h *WebHandler) HandleMkdir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.Index.Invalidate(serverName)
+	h.audit(r, "file.mkdir", filepath.Join(serverName, relPath, dirName), nil, nil)
+
+	http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
+}
+
+// HandleSideOverride sets or clears the admin override for the side (client,
+// server or both) a file is needed on.
+func (h *WebHandler) HandleSideOverride(w http.ResponseWriter, r *http.Request) {
+	serverName := r.FormValue("serverName")
+	relPath := r.FormValue("path")
+	side := r.FormValue("side")
+
+	if !isValidPath(serverName, relPath) || relPath == "" {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if side != "" && !modmanager.ValidSide(side) {
+		http.Error(w, "Invalid side", http.StatusBadRequest)
+		return
+	}
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	key := filepath.ToSlash(filepath.Clean(relPath))
+	overrides, err := h.Store.GetSideOverrides(server.ID)
+	if err != nil {
+		http.Error(w, "Error loading side overrides", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.SetSideOverride(server.ID, key, side); err != nil {
+		http.Error(w, "Error saving side override", http.StatusInternalServerError)
+		return
+	}
+
+	var before, after interface{}
+	if old, ok := overrides[key]; ok {
+		before = map[string]string{"side": old}
+	}
+	if side != "" {
+		after = map[string]string{"side": side}
+	}
+	h.audit(r, "file.side", filepath.Join(serverName, relPath), before, after)
+
 	http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
 }
 
@@ -205,8 +414,6 @@ func isValidPath(serverName, path string) bool {
 	return true
 }
 
-// ... (existing Create/Update/Delete handlers) ...
-
 // Home renders the main server list page.
 func (h *WebHandler) Home(w http.ResponseWriter, r *http.Request) {
 	allServers, err := h.Store.ListServers()
@@ -286,12 +493,26 @@ func (h *WebHandler) ServerDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A README.md in the root of the mod directory is shown on the page,
+	// rendered and sanitized by the index.
+	var readme template.HTML
+	if tree, err := h.Index.Tree(serverName); err == nil {
+		for _, child := range tree.Children {
+			if child.Type == modmanager.TypeMD && strings.EqualFold(child.Name, "README.md") {
+				readme = template.HTML(child.HTML)
+				break
+			}
+		}
+	}
+
 	data := struct {
 		Server        *database.Server
 		Authenticated bool
+		Readme        template.HTML
 	}{
 		Server:        server,
 		Authenticated: isAuthenticated,
+		Readme:        readme,
 	}
 
 	funcMap := template.FuncMap{
@@ -366,6 +587,14 @@ func (h *WebHandler) Admin(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// reservedServerNames are the top-level paths main.go registers before the
+// /{serverName} catch-all. A server with one of these names would have no
+// reachable detail page.
+var reservedServerNames = map[string]bool{
+	"admin": true, "api": true, "assets": true, "auth": true, "compare": true,
+	"files": true, "login": true, "logout": true, "packwiz": true,
+}
+
 // HandleServerCreate handles the creation of a new server.
 func (h *WebHandler) HandleServerCreate(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -384,11 +613,18 @@ func (h *WebHandler) HandleServerCreate(w http.ResponseWriter, r *http.Request)
 		Metadata:    h.parseMetadata(r),
 	}
 
+	if reservedServerNames[server.Name] {
+		http.Error(w, "The server name "+server.Name+" is reserved", http.StatusBadRequest)
+		return
+	}
+
 	if err := h.Store.CreateServer(server); err != nil {
 		http.Error(w, "Failed to create server: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.audit(r, "server.create", server.Name, nil, server)
+
 	http.Redirect(w, r, "/admin", http.StatusFound)
 }
 
@@ -417,11 +653,24 @@ func (h *WebHandler) HandleServerUpdate(w http.ResponseWriter, r *http.Request)
 		Metadata:    h.parseMetadata(r),
 	}
 
+	if reservedServerNames[server.Name] {
+		http.Error(w, "The server name "+server.Name+" is reserved", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Store.GetServerByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load server: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	if err := h.Store.UpdateServer(server); err != nil {
 		http.Error(w, "Failed to update server: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.audit(r, "server.update", server.Name, before, server)
+
 	http.Redirect(w, r, "/admin", http.StatusFound)
 }
 
@@ -460,10 +709,22 @@ func (h *WebHandler) HandleServerDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	before, err := h.Store.GetServerByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load server: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	if err := h.Store.DeleteServer(id); err != nil {
 		http.Error(w, "Failed to delete server: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	target := strconv.Itoa(id)
+	if before != nil {
+		target = before.Name
+	}
+	h.audit(r, "server.delete", target, before, nil)
+
 	http.Redirect(w, r, "/admin", http.StatusFound)
 }
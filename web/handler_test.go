@@ -0,0 +1,36 @@
+package web
+
+import (
+	"github.com/tionis/mcow/database"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleServerCreateReservedName(t *testing.T) {
+	store, err := database.NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.DB.Close()
+	h := &WebHandler{Store: store}
+
+	for _, name := range []string{"compare", "admin", "packwiz"} {
+		form := url.Values{"name": {name}, "address": {"localhost"}, "state": {"active"}}
+		r := httptest.NewRequest("POST", "/admin/servers/add", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.HandleServerCreate(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("creating %q: status %d, want %d", name, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	servers, err := store.ListServers()
+	if err != nil || len(servers) != 0 {
+		t.Errorf("servers = %+v, %v, want none", servers, err)
+	}
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"github.com/tionis/mcow/auth"
+	"html/template"
+	"net/http"
+)
+
+// LocalLogin renders the login form for the local break-glass admin account.
+func (h *WebHandler) LocalLogin(w http.ResponseWriter, r *http.Request) {
+	if h.Auth == nil || h.Auth.LocalAdmin == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Authenticated bool
+		Error         string
+		ReturnTo      string
+		TOTPRequired  bool
+		OIDCEnabled   bool
+	}{
+		Authenticated: h.Auth.IsAuthenticated(r),
+		Error:         r.URL.Query().Get("error"),
+		ReturnTo:      r.URL.Query().Get("return_to"),
+		TOTPRequired:  h.Auth.LocalAdmin.TOTPEnabled(),
+		OIDCEnabled:   h.Auth.OIDCEnabled(),
+	}
+
+	tmpl, err := template.New("base.html").ParseFS(templateFS, "templates/base.html", "templates/login.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// deniedMessages maps access policy denial reasons to user-facing explanations.
+var deniedMessages = map[string]string{
+	auth.DenyEmailNotAllowed:  "Your account is not permitted to access the admin area. Please sign in with an allowed email address.",
+	auth.DenyEmailNotVerified: "Your email address has not been verified with the identity provider. Please verify it and try again.",
+	auth.DenyMissingGroup:     "Your account is not a member of the group required for admin access.",
+}
+
+// AccessDenied renders the page shown when a login is rejected by the access policy.
+func (h *WebHandler) AccessDenied(w http.ResponseWriter, r *http.Request) {
+	message, ok := deniedMessages[r.URL.Query().Get("reason")]
+	if !ok {
+		message = "Your account is not permitted to access the admin area."
+	}
+
+	data := struct {
+		Authenticated bool
+		Message       string
+	}{
+		Authenticated: false,
+		Message:       message,
+	}
+
+	tmpl, err := template.New("base.html").ParseFS(templateFS, "templates/base.html", "templates/denied.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,284 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tionis/mcow/auth"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// serverQuota returns the quota of a server and the current usage of its
+// mod directory. Unknown servers have no quota.
+func (h *WebHandler) serverQuota(serverName string) (modmanager.Quota, modmanager.Usage, error) {
+	var quota modmanager.Quota
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		return quota, modmanager.Usage{}, err
+	}
+	if quota, err = h.Store.GetQuota(server.ID); err != nil {
+		return quota, modmanager.Usage{}, err
+	}
+	usage, err := h.serverUsage(serverName)
+	return quota, usage, err
+}
+
+// serverUsage returns the size and number of files of a server's mod
+// directory, taken from the index.
+func (h *WebHandler) serverUsage(serverName string) (modmanager.Usage, error) {
+	tree, err := h.Index.FullTree(serverName)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(h.Config.ModDataPath, serverName)); os.IsNotExist(statErr) {
+			return modmanager.Usage{}, nil
+		}
+		return modmanager.Usage{}, err
+	}
+	return modmanager.TreeUsage(tree), nil
+}
+
+// quotaStatus returns the HTTP status for a quota or upload policy error,
+// or 0 for other errors.
+func quotaStatus(err error) int {
+	switch {
+	case errors.Is(err, modmanager.ErrExtensionNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, modmanager.ErrFileTooLarge), errors.Is(err, modmanager.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	}
+	return 0
+}
+
+// writeQuotaError answers a write refused by checkFileWrite or a
+// quotaTracker, as JSON with the code "quota" if the client wants JSON.
+func writeQuotaError(w http.ResponseWriter, r *http.Request, err error) {
+	status := quotaStatus(err)
+	if status == 0 {
+		log.Printf("Error checking quota: %v", err)
+		status, err = http.StatusInternalServerError, errors.New("internal server error")
+	}
+	if auth.WantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": err.Error(), "code": "quota"})
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// checkFileWrite checks writing a file of size bytes to dest, a path in
+// serverName's mod directory, against the server's quota and upload policy.
+// A file replaced with the overwrite policy is subtracted from the usage.
+func (h *WebHandler) checkFileWrite(serverName, dest, policy string, size int64) error {
+	quota, usage, err := h.serverQuota(serverName)
+	if err != nil {
+		return err
+	}
+	if err := quota.CheckFile(filepath.Base(dest), size); err != nil {
+		return err
+	}
+	return quota.Check(usage, writeChange(dest, policy, modmanager.Usage{Bytes: size, Files: 1}))
+}
+
+// uploadOverhead is added to body limits for multipart headers and the
+// other form fields.
+const uploadOverhead = 1 << 20
+
+// uploadBodyLimit returns the largest request body a multipart upload to
+// serverName may send, or 0 if it is unlimited. A single file can be no
+// larger than the per-file limit or the whole quota, even when it replaces
+// another file, and an archive to be extracted no larger than what may be
+// extracted.
+func (h *WebHandler) uploadBodyLimit(serverName string) (int64, error) {
+	quota, _, err := h.serverQuota(serverName)
+	if err != nil {
+		return 0, err
+	}
+	var file int64
+	for _, n := range []int64{quota.MaxFileSize, quota.MaxBytes} {
+		if n > 0 && (file == 0 || n < file) {
+			file = n
+		}
+	}
+	if file == 0 {
+		return 0, nil
+	}
+	limits, err := h.extractLimits(serverName)
+	if err != nil && quotaStatus(err) == 0 {
+		return 0, err
+	}
+	if err == nil && limits.MaxTotalSize <= 0 {
+		return 0, nil
+	}
+	// A full quota refuses extraction, err is then a quota error.
+	if err == nil && limits.MaxTotalSize > file {
+		file = limits.MaxTotalSize
+	}
+	return file + uploadOverhead, nil
+}
+
+// writeChange returns the change in usage when storing added at dest.
+// Only the overwrite policy replaces an existing file.
+func writeChange(dest, policy string, added modmanager.Usage) modmanager.Usage {
+	if policy == modmanager.ConflictOverwrite {
+		if info, err := os.Lstat(dest); err == nil && info.Mode().IsRegular() {
+			added.Bytes -= info.Size()
+			added.Files--
+		}
+	}
+	return added
+}
+
+// quotaTracker checks a series of writes to one server, e.g. the items of a
+// bulk copy, counting each accepted write towards the usage.
+type quotaTracker struct {
+	quota modmanager.Quota
+	usage modmanager.Usage
+}
+
+// newQuotaTracker loads the quota and usage of a server.
+func (h *WebHandler) newQuotaTracker(serverName string) (*quotaTracker, error) {
+	quota, usage, err := h.serverQuota(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaTracker{quota: quota, usage: usage}, nil
+}
+
+// checkPath checks storing the file or directory at src as dest. If counts
+// is false, only the upload policy is checked, e.g. for moves within a
+// server. The returned change must be passed to add once the write is done.
+func (t *quotaTracker) checkPath(src, dest, policy string, counts bool) (modmanager.Usage, error) {
+	added, err := t.quota.CheckPath(src, filepath.Base(dest))
+	if err != nil || !counts {
+		return modmanager.Usage{}, err
+	}
+	change := writeChange(dest, policy, added)
+	return change, t.quota.Check(t.usage, change)
+}
+
+// add records a completed write.
+func (t *quotaTracker) add(change modmanager.Usage) {
+	t.usage.Bytes += change.Bytes
+	t.usage.Files += change.Files
+}
+
+// QuotaPage renders the form for a server's quota and upload policy
+// together with its current usage.
+func (h *WebHandler) QuotaPage(w http.ResponseWriter, r *http.Request) {
+	serverName := mux.Vars(r)["serverName"]
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	quota, usage, err := h.serverQuota(serverName)
+	if err != nil {
+		log.Printf("Error loading quota of %s: %v", serverName, err)
+		http.Error(w, "Failed to load quota", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Server        *database.Server
+		Authenticated bool
+		UserEmail     string
+		Quota         modmanager.Quota
+		Usage         modmanager.Usage
+	}{
+		Server:        server,
+		Authenticated: true,
+		UserEmail:     h.Auth.GetUserEmail(r),
+		Quota:         quota,
+		Usage:         usage,
+	}
+
+	tmpl, err := template.New("base.html").Funcs(quotaFuncs).ParseFS(templateFS, "templates/base.html", "templates/quota.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// quotaFuncs are the template functions for showing quotas and usage.
+var quotaFuncs = template.FuncMap{
+	"formatSize": formatSize,
+	"mib": func(n int64) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', -1, 64)
+	},
+	"percent": func(used, limit int64) int {
+		if limit <= 0 {
+			return 0
+		}
+		return int(math.Min(100, math.Round(float64(used)*100/float64(limit))))
+	},
+	"int64": func(n int) int64 { return int64(n) },
+	"join":  strings.Join,
+}
+
+// HandleQuotaUpdate saves a server's quota and upload policy. Sizes are
+// given in MiB; empty or zero values remove a limit.
+func (h *WebHandler) HandleQuotaUpdate(w http.ResponseWriter, r *http.Request) {
+	serverName := r.FormValue("serverName")
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	var quota modmanager.Quota
+	var errs []string
+	parseMiB := func(field string) int64 {
+		v := strings.TrimSpace(r.FormValue(field))
+		if v == "" {
+			return 0
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(f >= 0 && f <= math.MaxInt64>>20) {
+			errs = append(errs, fmt.Sprintf("%s: expected a size in MiB", field))
+			return 0
+		}
+		return int64(f * (1 << 20))
+	}
+	quota.MaxBytes = parseMiB("max_size_mb")
+	quota.MaxFileSize = parseMiB("max_file_size_mb")
+	if v := strings.TrimSpace(r.FormValue("max_files")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, "max_files: expected a number of files")
+		}
+		quota.MaxFiles = n
+	}
+	quota.Extensions = modmanager.ParseExtensions(r.FormValue("extensions"))
+	if len(errs) > 0 {
+		http.Error(w, strings.Join(errs, "\n"), http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Store.GetQuota(server.ID)
+	if err != nil {
+		http.Error(w, "Failed to load quota", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.SetQuota(server.ID, quota); err != nil {
+		log.Printf("Error saving quota of %s: %v", serverName, err)
+		http.Error(w, "Failed to save quota", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, "quota.update", serverName, before, quota)
+	http.Redirect(w, r, "/admin/quota/"+serverName, http.StatusFound)
+}
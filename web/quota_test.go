@@ -0,0 +1,91 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tionis/mcow/modmanager"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChange(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "mod.jar")
+	if err := os.WriteFile(existing, make([]byte, 300), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added := modmanager.Usage{Bytes: 100, Files: 1}
+
+	tests := []struct {
+		name   string
+		dest   string
+		policy string
+		want   modmanager.Usage
+	}{
+		{"new file", filepath.Join(dir, "new.jar"), modmanager.ConflictOverwrite, added},
+		{"overwrite", existing, modmanager.ConflictOverwrite, modmanager.Usage{Bytes: -200, Files: 0}},
+		{"rename keeps both", existing, modmanager.ConflictRename, added},
+		{"skip", existing, modmanager.ConflictSkip, added},
+		{"overwrite directory", dir, modmanager.ConflictOverwrite, added},
+	}
+	for _, tt := range tests {
+		if got := writeChange(tt.dest, tt.policy, added); got != tt.want {
+			t.Errorf("%s: writeChange() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuotaTracker(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jar")
+	if err := os.WriteFile(src, make([]byte, 400), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := &quotaTracker{
+		quota: modmanager.Quota{MaxBytes: 1000, MaxFiles: 3},
+		usage: modmanager.Usage{Bytes: 100, Files: 1},
+	}
+
+	// Each accepted copy counts towards the next check.
+	for i, wantOK := range []bool{true, true, false} {
+		change, err := tracker.checkPath(src, filepath.Join(dir, fmt.Sprintf("copy%d.jar", i)), modmanager.ConflictFail, true)
+		if (err == nil) != wantOK {
+			t.Fatalf("copy %d: checkPath() = %v, want ok %t", i, err, wantOK)
+		}
+		if err == nil {
+			tracker.add(change)
+		}
+	}
+	if tracker.usage != (modmanager.Usage{Bytes: 900, Files: 3}) {
+		t.Errorf("usage = %+v, want 900 bytes in 3 files", tracker.usage)
+	}
+
+	// Moves within a server only check the upload policy.
+	change, err := tracker.checkPath(src, filepath.Join(dir, "moved.jar"), modmanager.ConflictFail, false)
+	if err != nil || change != (modmanager.Usage{}) {
+		t.Errorf("uncounted checkPath() = %+v, %v", change, err)
+	}
+	// Replacing a file of the same size does not grow the usage.
+	if _, err := tracker.checkPath(src, src, modmanager.ConflictOverwrite, true); err != nil {
+		t.Errorf("overwrite with the same size refused: %v", err)
+	}
+}
+
+func TestQuotaStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: mod.exe", modmanager.ErrExtensionNotAllowed), http.StatusUnsupportedMediaType},
+		{fmt.Errorf("%w: mod.jar", modmanager.ErrFileTooLarge), http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: 1 file", modmanager.ErrQuotaExceeded), http.StatusRequestEntityTooLarge},
+		{errors.New("disk on fire"), 0},
+	}
+	for _, tt := range tests {
+		if got := quotaStatus(tt.err); got != tt.want {
+			t.Errorf("quotaStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"fmt"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// releaseVersionPattern restricts release versions to characters that are
+// safe in URLs and file names.
+var releaseVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// defaultReleaseVersion returns today's date as version, with a counter
+// appended if releases were already made today.
+func (h *WebHandler) defaultReleaseVersion(serverID int) (string, error) {
+	base := time.Now().Format("2006.01.02")
+	version := base
+	for i := 2; ; i++ {
+		existing, err := h.Store.GetRelease(serverID, version)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return version, nil
+		}
+		version = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// HandleReleaseCreate snapshots the server's mod directory into a new
+// release. The changelog is computed against the previous release; a release
+// without any changes is refused.
+func (h *WebHandler) HandleReleaseCreate(w http.ResponseWriter, r *http.Request) {
+	serverName := r.FormValue("serverName")
+	version := strings.TrimSpace(r.FormValue("version"))
+	notes := strings.TrimSpace(r.FormValue("notes"))
+
+	if !isValidPath(serverName, "") {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return
+	}
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	if version == "" {
+		if version, err = h.defaultReleaseVersion(server.ID); err != nil {
+			http.Error(w, "Error loading releases", http.StatusInternalServerError)
+			return
+		}
+	} else if !releaseVersionPattern.MatchString(version) {
+		http.Error(w, "Invalid version: use letters, digits, '.', '_' and '-'", http.StatusBadRequest)
+		return
+	}
+	if existing, err := h.Store.GetRelease(server.ID, version); err != nil {
+		http.Error(w, "Error loading releases", http.StatusInternalServerError)
+		return
+	} else if existing != nil {
+		http.Error(w, fmt.Sprintf("Release %s already exists", version), http.StatusConflict)
+		return
+	}
+
+	tree, err := h.Index.Tree(serverName)
+	if err != nil {
+		http.Error(w, "Error scanning files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	files, err := modmanager.Snapshot(filepath.Join(h.Config.ModDataPath, serverName), tree, h.Releases)
+	if err != nil {
+		log.Printf("Error snapshotting mod directory of server %s: %v", serverName, err)
+		http.Error(w, "Error storing release files", http.StatusInternalServerError)
+		return
+	}
+
+	var prevFiles []modmanager.SnapshotFile
+	prev, err := h.Store.GetLatestRelease(server.ID)
+	if err == nil && prev != nil {
+		prevFiles, err = h.Store.ListReleaseFiles(prev.ID)
+	}
+	if err != nil {
+		http.Error(w, "Error loading previous release", http.StatusInternalServerError)
+		return
+	}
+	changelog := modmanager.BuildChangelog(prevFiles, files)
+	if prev != nil && changelog.Empty() {
+		http.Error(w, fmt.Sprintf("No changes since release %s", prev.Version), http.StatusConflict)
+		return
+	}
+
+	release := &database.Release{
+		ServerID:  server.ID,
+		Version:   version,
+		Notes:     notes,
+		Changelog: changelog,
+		CreatedBy: h.Auth.GetUserEmail(r),
+	}
+	if err := h.Store.CreateRelease(release, files); err != nil {
+		http.Error(w, "Error saving release: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "release.create", serverName+"@"+version, nil, map[string]interface{}{
+		"files":   release.FileCount,
+		"size":    release.TotalSize,
+		"added":   len(changelog.Added),
+		"removed": len(changelog.Removed),
+		"updated": len(changelog.Updated),
+	})
+
+	http.Redirect(w, r, "/"+serverName+"/releases", http.StatusFound)
+}
+
+// ReleaseList renders the published releases of a server with their
+// changelogs and download links.
+func (h *WebHandler) ReleaseList(w http.ResponseWriter, r *http.Request) {
+	serverName := mux.Vars(r)["serverName"]
+
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	isAuthenticated := h.Auth != nil && h.Auth.IsAuthenticated(r)
+	if server == nil || (server.State == "offline" && !isAuthenticated) {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	releases, err := h.Store.ListReleases(server.ID)
+	if err != nil {
+		http.Error(w, "Failed to load releases", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Server        *database.Server
+		Releases      []database.Release
+		Authenticated bool
+	}{
+		Server:        server,
+		Releases:      releases,
+		Authenticated: isAuthenticated,
+	}
+
+	funcMap := template.FuncMap{
+		"nl2br": func(s string) template.HTML {
+			return template.HTML(strings.ReplaceAll(template.HTMLEscapeString(s), "\n", "<br>"))
+		},
+		"formatTime": func(t time.Time) string {
+			return t.Local().Format("2006-01-02 15:04")
+		},
+		"formatSize": formatSize,
+	}
+
+	tmpl, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "templates/base.html", "templates/releases.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// formatSize formats a byte count for display.
+func formatSize(n int64) string {
+	return modmanager.FormatBytes(n)
+}
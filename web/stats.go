@@ -0,0 +1,154 @@
+package web
+
+import (
+	"github.com/tionis/mcow/database"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// statsPeriods are the periods in days the statistics page offers; 0 is
+// all time.
+var statsPeriods = []int{7, 30, 90, 365, 0}
+
+// statsMaxDays bounds the "days" parameter, so the chart is never filled with
+// more than ten years of days.
+const statsMaxDays = 3650
+
+// statsTopLimit is the number of files listed on the statistics page.
+const statsTopLimit = 100
+
+// downloadRow is a file on the statistics page.
+type downloadRow struct {
+	database.FileDownloads
+	Zip     bool // downloads of a folder as zip
+	Removed bool // the file or folder no longer exists
+}
+
+// StatsPage renders the download statistics of a server: downloads per day
+// and the most downloaded files over the period given by the "days" query
+// parameter.
+func (h *WebHandler) StatsPage(w http.ResponseWriter, r *http.Request) {
+	serverName := mux.Vars(r)["serverName"]
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days < 0 {
+			http.Error(w, "Invalid number of days", http.StatusBadRequest)
+			return
+		}
+	}
+	days = min(days, statsMaxDays)
+	today := time.Now().UTC()
+	since := ""
+	if days > 0 {
+		since = today.AddDate(0, 0, 1-days).Format(database.DownloadDayFormat)
+	}
+
+	daily, err := h.Store.ListDailyDownloads(server.ID, since)
+	if err == nil && days > 0 {
+		daily = fillDays(daily, since, today.Format(database.DownloadDayFormat))
+	}
+	var top []database.FileDownloads
+	if err == nil {
+		top, err = h.Store.ListTopDownloads(server.ID, since, statsTopLimit)
+	}
+	if err != nil {
+		log.Printf("Error loading download statistics of %s: %v", serverName, err)
+		http.Error(w, "Failed to load download statistics", http.StatusInternalServerError)
+		return
+	}
+
+	total, peak := 0, 0
+	for _, d := range daily {
+		total += d.Count
+		if d.Count > peak {
+			peak = d.Count
+		}
+	}
+	modDir := filepath.Join(h.Config.ModDataPath, serverName)
+	rows := make([]downloadRow, len(top))
+	for i, f := range top {
+		rows[i] = downloadRow{FileDownloads: f, Zip: strings.HasSuffix(f.Path, "/")}
+		if _, err := os.Stat(filepath.Join(modDir, filepath.FromSlash(f.Path))); os.IsNotExist(err) {
+			rows[i].Removed = true
+		}
+	}
+
+	data := struct {
+		Server        *database.Server
+		Authenticated bool
+		UserEmail     string
+		Days          int
+		Periods       []int
+		Total         int
+		Peak          int
+		Daily         []database.DayDownloads
+		Top           []downloadRow
+		TopLimit      int
+	}{
+		Server:        server,
+		Authenticated: true,
+		UserEmail:     h.Auth.GetUserEmail(r),
+		Days:          days,
+		Periods:       statsPeriods,
+		Total:         total,
+		Peak:          peak,
+		Daily:         daily,
+		Top:           rows,
+		TopLimit:      statsTopLimit,
+	}
+
+	funcMap := template.FuncMap{
+		"percent": func(n, max int) int {
+			if max <= 0 {
+				return 0
+			}
+			return n * 100 / max
+		},
+	}
+
+	tmpl, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "templates/base.html", "templates/stats.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fillDays adds the days from first to last without downloads to daily, so
+// they show up as gaps.
+func fillDays(daily []database.DayDownloads, first, last string) []database.DayDownloads {
+	counts := make(map[string]int, len(daily))
+	for _, d := range daily {
+		counts[d.Day] = d.Count
+	}
+	start, err := time.Parse(database.DownloadDayFormat, first)
+	if err != nil {
+		return daily
+	}
+	var filled []database.DayDownloads
+	for t := start; ; t = t.AddDate(0, 0, 1) {
+		day := t.Format(database.DownloadDayFormat)
+		if day > last {
+			break
+		}
+		filled = append(filled, database.DayDownloads{Day: day, Count: counts[day]})
+	}
+	return filled
+}
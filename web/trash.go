@@ -0,0 +1,231 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tionis/mcow/database"
+	"github.com/tionis/mcow/modmanager"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// trashPurgeInterval is how often expired trash items are purged.
+const trashPurgeInterval = time.Hour
+
+// trashRetention returns how long deleted items are kept, or 0 to keep them
+// until purged manually.
+func (h *WebHandler) trashRetention() time.Duration {
+	return time.Duration(h.Config.TrashRetentionDays) * 24 * time.Hour
+}
+
+// PurgeTrashLoop periodically purges trash items older than the configured
+// retention. It does nothing if the trash or the retention is disabled.
+func (h *WebHandler) PurgeTrashLoop() {
+	if h.Trash == nil || h.trashRetention() <= 0 {
+		return
+	}
+	for {
+		purged, err := h.Trash.PurgeExpired(h.trashRetention())
+		if err != nil {
+			log.Printf("Error purging expired trash items: %v", err)
+		}
+		for _, item := range purged {
+			log.Printf("Purged %s/%s from the trash (deleted %s by %s)", item.Server, item.Path, item.DeletedAt.Format(time.RFC3339), item.DeletedBy)
+		}
+		time.Sleep(trashPurgeInterval)
+	}
+}
+
+// TrashList renders the trash of a server with options to restore or purge
+// deleted items.
+func (h *WebHandler) TrashList(w http.ResponseWriter, r *http.Request) {
+	serverName := mux.Vars(r)["serverName"]
+	server, err := h.Store.GetServerByName(serverName)
+	if err != nil || server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	if h.Trash == nil {
+		http.Error(w, "The trash is disabled", http.StatusNotFound)
+		return
+	}
+
+	items, err := h.Trash.List(serverName)
+	if err != nil {
+		log.Printf("Error listing trash of %s: %v", serverName, err)
+		http.Error(w, "Failed to load trash", http.StatusInternalServerError)
+		return
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+
+	data := struct {
+		Server        *database.Server
+		Authenticated bool
+		UserEmail     string
+		Items         []modmanager.TrashItem
+		TotalSize     int64
+		RetentionDays int
+	}{
+		Server:        server,
+		Authenticated: true,
+		UserEmail:     h.Auth.GetUserEmail(r),
+		Items:         items,
+		TotalSize:     total,
+		RetentionDays: h.Config.TrashRetentionDays,
+	}
+
+	funcMap := template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Local().Format("2006-01-02 15:04:05")
+		},
+		"formatSize": formatSize,
+		"expires": func(t time.Time) string {
+			return t.Add(h.trashRetention()).Local().Format("2006-01-02 15:04")
+		},
+	}
+
+	tmpl, err := template.New("base.html").Funcs(funcMap).ParseFS(templateFS, "templates/base.html", "templates/trash.html")
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleTrashRestore moves trash items back to their original location.
+// Existing files there are handled by the "conflict" policy.
+func (h *WebHandler) HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	serverName := r.FormValue("serverName")
+	if serverName == "" || !isValidPath(serverName, "") || h.Trash == nil {
+		http.Error(w, "Invalid server", http.StatusBadRequest)
+		return
+	}
+	policy := r.FormValue("conflict")
+	if policy == "fail" {
+		policy = modmanager.ConflictFail
+	}
+	if !modmanager.ValidConflictPolicy(policy) {
+		http.Error(w, "Invalid conflict policy, expected overwrite, rename or skip", http.StatusBadRequest)
+		return
+	}
+
+	serverDir := filepath.Join(h.Config.ModDataPath, serverName)
+	quota, err := h.newQuotaTracker(serverName)
+	if err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+	var problems []string
+	restored := false
+	for _, id := range r.Form["id"] {
+		// Restoring counts against the quota like a new upload.
+		var change modmanager.Usage
+		item, err := h.Trash.Get(serverName, id)
+		if err == nil {
+			change, err = quota.checkPath(h.Trash.ItemPath(item), filepath.Join(serverDir, filepath.FromSlash(item.Path)), policy, true)
+		}
+		var res *modmanager.WriteResult
+		if err == nil {
+			item, res, err = h.Trash.Restore(serverName, id, serverDir, policy)
+		}
+		var conflict *modmanager.ConflictError
+		switch {
+		case quotaStatus(err) != 0:
+			problems = append(problems, fmt.Sprintf("%s: %s", item.Path, err))
+		case errors.As(err, &conflict):
+			problems = append(problems, fmt.Sprintf("%s: %s, choose overwrite or rename", item.Path, conflict.Error()))
+		case item == nil:
+			if !errors.Is(err, modmanager.ErrTrashItemNotFound) {
+				log.Printf("Error loading trash item %s of %s: %v", id, serverName, err)
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", id, modmanager.ErrTrashItemNotFound))
+		case err != nil:
+			log.Printf("Error restoring trash item %s of %s: %v", id, serverName, err)
+			problems = append(problems, fmt.Sprintf("%s: could not be restored", item.Path))
+		case res.Skipped:
+			problems = append(problems, fmt.Sprintf("%s: skipped, the path exists", item.Path))
+		default:
+			restored = true
+			quota.add(change)
+			h.audit(r, "trash.restore", filepath.Join(serverName, item.Path), trashAuditInfo(item), map[string]interface{}{"path": h.serverRelPath(serverName, res.Path)})
+		}
+	}
+	if restored {
+		h.Index.Invalidate(serverName)
+	}
+
+	if len(problems) > 0 {
+		http.Error(w, strings.Join(problems, "\n"), http.StatusConflict)
+		return
+	}
+	http.Redirect(w, r, "/admin/trash/"+serverName, http.StatusFound)
+}
+
+// HandleTrashPurge permanently deletes trash items, or the whole trash of a
+// server with "all=1".
+func (h *WebHandler) HandleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	serverName := r.FormValue("serverName")
+	if serverName == "" || !isValidPath(serverName, "") || h.Trash == nil {
+		http.Error(w, "Invalid server", http.StatusBadRequest)
+		return
+	}
+
+	ids := r.Form["id"]
+	if r.FormValue("all") == "1" {
+		items, err := h.Trash.List(serverName)
+		if err != nil {
+			log.Printf("Error listing trash of %s: %v", serverName, err)
+			http.Error(w, "Failed to load trash", http.StatusInternalServerError)
+			return
+		}
+		ids = nil
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	for _, id := range ids {
+		item, err := h.Trash.Purge(serverName, id)
+		if errors.Is(err, modmanager.ErrTrashItemNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error purging trash item %s of %s: %v", id, serverName, err)
+			http.Error(w, "Error purging trash", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, "trash.purge", filepath.Join(serverName, item.Path), trashAuditInfo(item), nil)
+	}
+	http.Redirect(w, r, "/admin/trash/"+serverName, http.StatusFound)
+}
+
+// trashAuditInfo describes a trash item in audit entries.
+func trashAuditInfo(item *modmanager.TrashItem) map[string]interface{} {
+	return map[string]interface{}{
+		"trashId":   item.ID,
+		"isDir":     item.IsDir,
+		"size":      item.Size,
+		"deletedBy": item.DeletedBy,
+		"deletedAt": item.DeletedAt,
+	}
+}
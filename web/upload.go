@@ -0,0 +1,443 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tionis/mcow/auth"
+	"github.com/tionis/mcow/modmanager"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// uploadChunkSize is the chunk size suggested to clients.
+	uploadChunkSize = 8 << 20
+	// uploadMaxChunkSize is the largest chunk accepted in a single request.
+	uploadMaxChunkSize = 64 << 20
+	// uploadMaxAge is how long an upload may go without receiving data
+	// before it is discarded.
+	uploadMaxAge = 48 * time.Hour
+)
+
+// uploadResponse describes an upload to the client.
+type uploadResponse struct {
+	*modmanager.Upload
+	ChunkSize int64 `json:"chunkSize"`
+}
+
+// writeJSON sends v as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// writeUploadError maps upload store errors to responses. The current
+// offset is included so clients can resume from there.
+func writeUploadError(w http.ResponseWriter, err error, offset int64) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, modmanager.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, modmanager.ErrUploadOffset):
+		status = http.StatusConflict
+	case errors.Is(err, modmanager.ErrUploadChecksum):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, modmanager.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, modmanager.ErrUploadIncomplete):
+		status = http.StatusConflict
+	default:
+		log.Printf("Upload error: %v", err)
+		err = errors.New("internal server error")
+	}
+	writeJSON(w, status, map[string]interface{}{"error": err.Error(), "offset": offset})
+}
+
+// conflictResponse is the structured error returned when an upload target
+// exists and no conflict policy allows replacing it.
+type conflictResponse struct {
+	Error     string   `json:"error"`
+	Code      string   `json:"code"`
+	Path      string   `json:"path"`                // existing file, relative to the server directory
+	Suggested string   `json:"suggested,omitempty"` // name the "rename" policy would use
+	Policies  []string `json:"policies"`
+}
+
+// newConflictResponse describes a conflict with paths relative to the
+// server directory.
+func (h *WebHandler) newConflictResponse(serverName string, err *modmanager.ConflictError) conflictResponse {
+	return conflictResponse{
+		Error:     err.Error(),
+		Code:      "conflict",
+		Path:      h.serverRelPath(serverName, err.Path),
+		Suggested: h.serverRelPath(serverName, err.Suggested),
+		Policies:  []string{modmanager.ConflictOverwrite, modmanager.ConflictRename, modmanager.ConflictSkip},
+	}
+}
+
+// serverRelPath returns full relative to the server's mod directory, slash-separated.
+func (h *WebHandler) serverRelPath(serverName, full string) string {
+	if full == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(filepath.Join(h.Config.ModDataPath, serverName), full)
+	if err != nil {
+		return filepath.Base(full)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeResultResponse is returned after a file was written or skipped.
+type writeResultResponse struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Renamed bool   `json:"renamed,omitempty"`
+}
+
+// conflictPolicy reads the "conflict" form value. On an invalid value it
+// writes an error response and returns false.
+func conflictPolicy(w http.ResponseWriter, r *http.Request) (string, bool) {
+	policy := r.FormValue("conflict")
+	if policy == "fail" {
+		policy = modmanager.ConflictFail
+	}
+	if !modmanager.ValidConflictPolicy(policy) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid conflict policy, expected overwrite, rename or skip"})
+		return "", false
+	}
+	return policy, true
+}
+
+// extractLimits returns the limits for extracting an archive into a
+// server's directory: the configured limits, lowered to what is left of the
+// server's quota. Files refused by its upload policy are skipped.
+func (h *WebHandler) extractLimits(serverName string) (modmanager.ExtractLimits, error) {
+	limits := modmanager.ExtractLimits{MaxFiles: h.Config.ExtractMaxFiles, MaxTotalSize: h.Config.ExtractMaxSize}
+	quota, usage, err := h.serverQuota(serverName)
+	if err != nil {
+		return limits, err
+	}
+	// Zero means unlimited in ExtractLimits, so a full quota is refused here.
+	if err := quota.Check(usage, modmanager.Usage{Bytes: 1, Files: 1}); err != nil {
+		return limits, err
+	}
+	if left := quota.MaxFiles - usage.Files; quota.MaxFiles > 0 && (limits.MaxFiles <= 0 || left < limits.MaxFiles) {
+		limits.MaxFiles = left
+	}
+	if left := quota.MaxBytes - usage.Bytes; quota.MaxBytes > 0 && (limits.MaxTotalSize <= 0 || left < limits.MaxTotalSize) {
+		limits.MaxTotalSize = left
+	}
+	limits.MaxFileSize = quota.MaxFileSize
+	limits.CheckFile = quota.CheckFile
+	return limits, nil
+}
+
+// checkArchiveUpload checks the declared size of an archive that is to be
+// extracted into serverName's directory. An archive larger than what may be
+// extracted from it is refused before it is staged.
+func (h *WebHandler) checkArchiveUpload(serverName, filename string, size int64) error {
+	limits, err := h.extractLimits(serverName)
+	if err != nil {
+		return err
+	}
+	if limits.MaxTotalSize > 0 && size > limits.MaxTotalSize {
+		return fmt.Errorf("%w: %s is larger than the %s that may be extracted", modmanager.ErrFileTooLarge, filename, modmanager.FormatBytes(limits.MaxTotalSize))
+	}
+	return nil
+}
+
+// extractResponse is returned after an archive was unpacked.
+type extractResponse struct {
+	Archive string `json:"archive"`
+	Dir     string `json:"dir"`
+	*modmanager.ExtractReport
+	Error string `json:"error,omitempty"`
+}
+
+// finishExtract records and answers the result of unpacking an archive into
+// relDir. Files extracted before an error are kept and reported. Plain form
+// submissions are redirected back to the file manager instead.
+func (h *WebHandler) finishExtract(w http.ResponseWriter, r *http.Request, serverName, relDir, archive string, report *modmanager.ExtractReport, err error) {
+	resp := extractResponse{Archive: archive, Dir: filepath.ToSlash(relDir), ExtractReport: report}
+	status := http.StatusOK
+	if err != nil {
+		resp.Error = err.Error()
+		status = http.StatusUnprocessableEntity
+		if errors.Is(err, modmanager.ErrExtractLimit) {
+			status = http.StatusRequestEntityTooLarge
+			if quota, _, qerr := h.serverQuota(serverName); qerr == nil && quota.Limited() {
+				resp.Error += " (the limits include what is left of the server's quota)"
+			}
+		}
+		log.Printf("Error extracting %s for server %s: %v", archive, serverName, err)
+	}
+
+	if report != nil && (len(report.Extracted) > 0 || report.Dirs > 0) {
+		h.Index.Invalidate(serverName)
+		after := map[string]interface{}{"archive": archive, "files": len(report.Extracted), "size": report.TotalSize, "skipped": len(report.Skipped)}
+		if err != nil {
+			after["error"] = err.Error()
+		}
+		h.audit(r, "file.extract", filepath.Join(serverName, relDir), nil, after)
+	}
+	switch {
+	case auth.WantsJSON(r):
+		writeJSON(w, status, resp)
+	case err != nil:
+		http.Error(w, resp.Error, status)
+	default:
+		http.Redirect(w, r, "/admin/files/"+serverName, http.StatusFound)
+	}
+}
+
+// isValidFilename reports whether name is a plain file name without
+// directory components.
+func isValidFilename(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && !strings.ContainsRune(name, 0)
+}
+
+// HandleUploadCreate starts a resumable upload, or returns the pending
+// upload for the same file so the client can continue where it stopped.
+func (h *WebHandler) HandleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	serverName := r.FormValue("serverName")
+	relPath := r.FormValue("path")
+	filename := r.FormValue("filename")
+
+	if !isValidPath(serverName, relPath) || serverName == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid path"})
+		return
+	}
+	if !isValidFilename(filename) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid file name"})
+		return
+	}
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil || size < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid size"})
+		return
+	}
+	if server, err := h.Store.GetServerByName(serverName); err != nil || server == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "server not found"})
+		return
+	}
+	policy, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	extract := r.FormValue("extract") == "1"
+	if extract {
+		if !modmanager.IsExtractable(filename) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "only .zip and .tar.gz archives can be extracted"})
+			return
+		}
+		if err := h.checkArchiveUpload(serverName, filename, size); err != nil {
+			writeQuotaError(w, r, err)
+			return
+		}
+	} else {
+		// Refuse before any data is sent; the policy and the quota are
+		// applied again on completion.
+		dest := filepath.Join(h.Config.ModDataPath, serverName, relPath, filename)
+		if err := h.checkFileWrite(serverName, dest, policy, size); err != nil {
+			writeQuotaError(w, r, err)
+			return
+		}
+		res, err := modmanager.CheckConflict(dest, policy)
+		var conflict *modmanager.ConflictError
+		if errors.As(err, &conflict) {
+			writeJSON(w, http.StatusConflict, h.newConflictResponse(serverName, conflict))
+			return
+		} else if err != nil {
+			writeUploadError(w, err, 0)
+			return
+		}
+		if res.Skipped {
+			writeJSON(w, http.StatusOK, writeResultResponse{Path: h.serverRelPath(serverName, dest), Skipped: true})
+			return
+		}
+	}
+
+	if err := h.Uploads.Cleanup(uploadMaxAge); err != nil {
+		log.Printf("Error cleaning up stale uploads: %v", err)
+	}
+	upload, err := h.Uploads.Create(modmanager.Upload{
+		Server:    serverName,
+		Dir:       filepath.ToSlash(filepath.Clean("/" + relPath))[1:],
+		Filename:  filename,
+		Size:      size,
+		SHA256:    r.FormValue("sha256"),
+		Conflict:  policy,
+		Extract:   extract,
+		CreatedBy: h.Auth.GetUserEmail(r),
+	})
+	if err != nil {
+		writeUploadError(w, err, 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, uploadResponse{Upload: upload, ChunkSize: uploadChunkSize})
+}
+
+// HandleUploadStatus reports how much of an upload has been received.
+func (h *WebHandler) HandleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	upload, err := h.Uploads.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeUploadError(w, err, 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, uploadResponse{Upload: upload, ChunkSize: uploadChunkSize})
+}
+
+// HandleUploadChunk appends the request body to an upload. The "offset"
+// query parameter must match the bytes received so far; the optional
+// X-Chunk-SHA256 header is verified before the chunk is accepted.
+func (h *WebHandler) HandleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid offset"})
+		return
+	}
+
+	// Stop receiving data for uploads the server's quota no longer allows.
+	upload, err := h.Uploads.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeUploadError(w, err, 0)
+		return
+	}
+	if upload.Extract {
+		err = h.checkArchiveUpload(upload.Server, upload.Filename, upload.Size)
+	} else {
+		dest := filepath.Join(h.Config.ModDataPath, upload.Server, filepath.FromSlash(upload.Dir), upload.Filename)
+		err = h.checkFileWrite(upload.Server, dest, upload.Conflict, upload.Size)
+	}
+	if err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, uploadMaxChunkSize)
+	newOffset, err := h.Uploads.WriteChunk(upload.ID, offset, body, r.Header.Get("X-Chunk-SHA256"))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = modmanager.ErrUploadTooLarge
+		}
+		writeUploadError(w, err, newOffset)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"offset": newOffset})
+}
+
+// HandleUploadComplete verifies a fully received upload and moves it into
+// the server's mod directory.
+func (h *WebHandler) HandleUploadComplete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	upload, err := h.Uploads.Get(id)
+	if err != nil {
+		writeUploadError(w, err, 0)
+		return
+	}
+	if !isValidPath(upload.Server, upload.Dir) || !isValidFilename(upload.Filename) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid path"})
+		return
+	}
+
+	policy, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	// Whether the archive is extracted was decided when the upload was
+	// created; its size was checked against the extract limits then.
+	if upload.Extract {
+		if !modmanager.IsExtractable(upload.Filename) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "only .zip and .tar.gz archives can be extracted"})
+			return
+		}
+		limits, err := h.extractLimits(upload.Server)
+		if err != nil {
+			writeQuotaError(w, r, err)
+			return
+		}
+		destDir := filepath.Join(h.Config.ModDataPath, upload.Server, filepath.FromSlash(upload.Dir))
+		extracted, report, err := h.Uploads.Extract(id, destDir, policy, limits)
+		if extracted == nil {
+			writeUploadError(w, err, 0)
+			return
+		}
+		if errors.Is(err, modmanager.ErrUploadIncomplete) || errors.Is(err, modmanager.ErrUploadChecksum) {
+			writeUploadError(w, err, extracted.Offset)
+			return
+		}
+		h.finishExtract(w, r, upload.Server, upload.Dir, upload.Filename, report, err)
+		return
+	}
+
+	dest := filepath.Join(h.Config.ModDataPath, upload.Server, filepath.FromSlash(upload.Dir), upload.Filename)
+	// Checked again, the quota or the directory may have changed since the
+	// upload was created.
+	effective := policy
+	if effective == "" {
+		effective = upload.Conflict
+	}
+	if err := h.checkFileWrite(upload.Server, dest, effective, upload.Size); err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+	before := existingFileInfo(dest)
+	upload, res, err := h.Uploads.Complete(id, dest, policy)
+	var conflict *modmanager.ConflictError
+	if errors.As(err, &conflict) {
+		writeJSON(w, http.StatusConflict, h.newConflictResponse(upload.Server, conflict))
+		return
+	}
+	if err != nil {
+		offset := int64(0)
+		if upload != nil {
+			offset = upload.Offset
+		}
+		writeUploadError(w, err, offset)
+		return
+	}
+
+	resp := writeResultResponse{Path: h.serverRelPath(upload.Server, res.Path), Size: res.Size, Skipped: res.Skipped, Renamed: res.Renamed}
+	if !res.Skipped {
+		if res.Renamed {
+			before = nil
+		}
+		h.Index.Invalidate(upload.Server)
+		h.audit(r, "file.upload", filepath.Join(upload.Server, filepath.FromSlash(resp.Path)), before, map[string]interface{}{"size": res.Size, "resumable": true})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// existingFileInfo describes the file at path for the audit log, or returns
+// nil if there is none.
+func existingFileInfo(path string) map[string]interface{} {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	return map[string]interface{}{"size": info.Size()}
+}
+
+// HandleUploadAbort discards an unfinished upload.
+func (h *WebHandler) HandleUploadAbort(w http.ResponseWriter, r *http.Request) {
+	if err := h.Uploads.Abort(mux.Vars(r)["id"]); err != nil {
+		writeUploadError(w, err, 0)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}